@@ -0,0 +1,163 @@
+// alerts/evaluator.go
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"backend/models"
+	"backend/units"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Evaluator checks newly stored observations against alert rules and hands
+// triggered alerts to the notifiers of each rule's channels
+type Evaluator struct {
+	DB        *gorm.DB
+	Notifiers []Notifier
+	Timeout   time.Duration // Per delivery, for email and webhooks
+}
+
+// NewEvaluator creates an evaluator with in-app, email and webhook delivery
+func NewEvaluator(db *gorm.DB) *Evaluator {
+	return &Evaluator{
+		DB: db,
+		Notifiers: []Notifier{
+			&InAppNotifier{DB: db},
+			&EmailNotifier{Sender: EmailSenderFromEnv()},
+			&WebhookNotifier{
+				Client: NewWebhookClient(10 * time.Second),
+				Secret: os.Getenv("ALERT_WEBHOOK_SECRET"),
+			},
+		},
+		Timeout: 15 * time.Second,
+	}
+}
+
+// Evaluate runs on every write of observations. Errors are logged rather
+// than returned so a failing alert never loses the user's data.
+func (e *Evaluator) Evaluate(observations []models.Observation) {
+	byUser := map[uuid.UUID][]models.Observation{}
+	for _, obs := range observations {
+		if obs.Code != "" {
+			byUser[obs.UserID] = append(byUser[obs.UserID], obs)
+		}
+	}
+
+	for userID, obs := range byUser {
+		codes := make([]string, 0, len(obs))
+		for _, o := range obs {
+			codes = append(codes, o.Code)
+		}
+
+		var rules []models.AlertRule
+		if err := e.DB.Where("user_id = ? AND active = ? AND code IN ?", userID, true, codes).Find(&rules).Error; err != nil {
+			log.Println("Failed to load alert rules: ", err)
+			continue
+		}
+
+		for _, rule := range rules {
+			for _, o := range obs {
+				if o.Code != rule.Code || !Matches(rule, o) {
+					continue
+				}
+				persistent, err := e.persistent(rule, o)
+				if err != nil {
+					log.Println("Failed to check alert window: ", err)
+					continue
+				}
+				if persistent {
+					e.trigger(rule, o)
+				}
+			}
+		}
+	}
+}
+
+// persistent reports whether enough matching values fall inside the rule's
+// window ending at obs, so a single outlier does not page anyone
+func (e *Evaluator) persistent(rule models.AlertRule, obs models.Observation) (bool, error) {
+	if rule.WindowHours <= 0 || rule.MinOccurrences <= 1 {
+		return true, nil
+	}
+
+	var history []models.Observation
+	since := obs.EffectiveAt.Add(-time.Duration(rule.WindowHours) * time.Hour)
+	if err := e.DB.Where("user_id = ? AND code = ? AND effective_at BETWEEN ? AND ?",
+		obs.UserID, obs.Code, since, obs.EffectiveAt).Find(&history).Error; err != nil {
+		return false, err
+	}
+
+	count := 0
+	for _, h := range history {
+		if Matches(rule, h) {
+			count++
+		}
+	}
+	return count >= rule.MinOccurrences, nil
+}
+
+func (e *Evaluator) trigger(rule models.AlertRule, obs models.Observation) {
+	alert := Alert{
+		Rule:        rule,
+		Observation: obs,
+		Title:       fmt.Sprintf("%s %g %s", obs.Name, obs.Value, units.Symbol(obs.Unit)),
+		Message: fmt.Sprintf("%s was %g %s on %s, which meets the alert condition: %s.",
+			obs.Name, obs.Value, units.Symbol(obs.Unit), obs.EffectiveAt.Format("2 Jan 2006"), Describe(rule)),
+		TriggeredAt: time.Now(),
+	}
+	e.DB.First(&alert.Patient, "id = ?", rule.UserID)
+	e.DB.First(&alert.Author, "id = ?", rule.CreatedBy)
+
+	for _, n := range e.Notifiers {
+		if !hasChannel(rule, n.Channel()) {
+			continue
+		}
+
+		if n.Channel() == ChannelInApp {
+			ctx, cancel := context.WithTimeout(context.Background(), e.Timeout)
+			if err := n.Deliver(ctx, alert); err != nil {
+				log.Println("Failed to store in-app notification: ", err)
+			}
+			cancel()
+			continue
+		}
+
+		// Record the delivery first; the unique index stops duplicates
+		delivery := models.Notification{
+			ID:            uuid.New(),
+			UserID:        rule.CreatedBy,
+			RuleID:        rule.ID,
+			ObservationID: obs.ID,
+			Channel:       n.Channel(),
+			Title:         alert.Title,
+			Message:       alert.Message,
+			Status:        "pending",
+		}
+		result := e.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&delivery)
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+
+		go e.deliver(n, alert, delivery.ID)
+	}
+}
+
+// deliver sends an external notification and records the outcome
+func (e *Evaluator) deliver(n Notifier, alert Alert, deliveryID uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.Timeout)
+	defer cancel()
+
+	updates := map[string]interface{}{"status": "delivered"}
+	if err := n.Deliver(ctx, alert); err != nil {
+		log.Printf("Failed to deliver %s alert: %v", n.Channel(), err)
+		updates = map[string]interface{}{"status": "failed", "error": err.Error()}
+	}
+	e.DB.Model(&models.Notification{}).Where("id = ?", deliveryID).Updates(updates)
+}
@@ -0,0 +1,202 @@
+// alerts/notifier.go
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+
+	"backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Alert is a triggered rule with everything a notifier needs to deliver it
+type Alert struct {
+	Rule        models.AlertRule   `json:"rule"`
+	Observation models.Observation `json:"observation"`
+	Patient     models.User        `json:"-"`
+	Author      models.User        `json:"-"`
+	Title       string             `json:"title"`
+	Message     string             `json:"message"`
+	TriggeredAt time.Time          `json:"triggered_at"`
+}
+
+// Notifier delivers alerts on one channel
+type Notifier interface {
+	Channel() string
+	Deliver(ctx context.Context, alert Alert) error
+}
+
+// InAppNotifier stores notifications shown in the app. The patient is always
+// notified; a clinician who wrote the rule is notified as well.
+type InAppNotifier struct {
+	DB *gorm.DB
+}
+
+func (n *InAppNotifier) Channel() string { return ChannelInApp }
+
+func (n *InAppNotifier) Deliver(ctx context.Context, alert Alert) error {
+	recipients := []uuid.UUID{alert.Rule.UserID}
+	if alert.Rule.CreatedBy != alert.Rule.UserID {
+		recipients = append(recipients, alert.Rule.CreatedBy)
+	}
+	for _, recipient := range recipients {
+		notification := models.Notification{
+			ID:            uuid.New(),
+			UserID:        recipient,
+			RuleID:        alert.Rule.ID,
+			ObservationID: alert.Observation.ID,
+			Channel:       ChannelInApp,
+			Title:         alert.Title,
+			Message:       alert.Message,
+			Status:        "delivered",
+		}
+		// The unique index makes re-evaluating the same observation a no-op
+		if err := n.DB.WithContext(ctx).Where(models.Notification{
+			UserID: recipient, RuleID: alert.Rule.ID, ObservationID: alert.Observation.ID, Channel: ChannelInApp,
+		}).FirstOrCreate(&notification).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EmailSender sends a plain text email. Implementations are swappable so
+// deployments can plug in SMTP, a provider API or a test double.
+type EmailSender interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// SMTPSender sends email through an SMTP relay
+type SMTPSender struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTPSender) Send(ctx context.Context, to, subject, body string) error {
+	msg := "From: " + s.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n\r\n" + body
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	return smtp.SendMail(s.Host+":"+s.Port, auth, s.From, []string{to}, []byte(msg))
+}
+
+// LogSender writes emails to the server log, for development
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, to, subject, body string) error {
+	log.Printf("email to %s: %s\n%s", to, subject, body)
+	return nil
+}
+
+// EmailSenderFromEnv returns an SMTP sender when SMTP_HOST is set and a
+// LogSender otherwise
+func EmailSenderFromEnv() EmailSender {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return LogSender{}
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = "alerts@medibuddy.local"
+	}
+	return &SMTPSender{
+		Host:     host,
+		Port:     port,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     from,
+	}
+}
+
+// EmailNotifier emails the rule's address, or its author's account address.
+// Rules may only name the patient's or the author's own account address.
+type EmailNotifier struct {
+	Sender EmailSender
+}
+
+func (n *EmailNotifier) Channel() string { return ChannelEmail }
+
+func (n *EmailNotifier) Deliver(ctx context.Context, alert Alert) error {
+	to := alert.Rule.Email
+	if to == "" {
+		to = alert.Author.Email
+	}
+	if to == "" {
+		return fmt.Errorf("no email address for rule %s", alert.Rule.ID)
+	}
+	if !strings.EqualFold(to, alert.Patient.Email) && !strings.EqualFold(to, alert.Author.Email) {
+		return fmt.Errorf("email address of rule %s is not the patient's or the author's", alert.Rule.ID)
+	}
+	body := alert.Message + "\n\nThis is an automated MediBuddy alert. " +
+		"If you feel unwell, contact your doctor or emergency services."
+	return n.Sender.Send(ctx, to, "MediBuddy alert: "+alert.Title, body)
+}
+
+// WebhookNotifier posts the alert as JSON. When Secret is set the body is
+// signed with HMAC-SHA256 in the X-MediBuddy-Signature header. Client should
+// come from NewWebhookClient so internal addresses stay out of reach.
+type WebhookNotifier struct {
+	Client *http.Client
+	Secret string
+}
+
+func (n *WebhookNotifier) Channel() string { return ChannelWebhook }
+
+func (n *WebhookNotifier) Deliver(ctx context.Context, alert Alert) error {
+	if alert.Rule.WebhookURL == "" {
+		return fmt.Errorf("no webhook URL for rule %s", alert.Rule.ID)
+	}
+	target, err := ValidateWebhookURL(alert.Rule.WebhookURL)
+	if err != nil {
+		return fmt.Errorf("rule %s: %w", alert.Rule.ID, err)
+	}
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.Secret))
+		mac.Write(body)
+		req.Header.Set("X-MediBuddy-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
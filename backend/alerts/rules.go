@@ -0,0 +1,146 @@
+// alerts/rules.go
+package alerts
+
+import (
+	"fmt"
+	"strings"
+
+	"backend/labs"
+	"backend/models"
+	"backend/units"
+)
+
+// Channels alerts can be delivered on
+const (
+	ChannelInApp   = "in_app"
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+)
+
+var comparatorAliases = map[string]string{
+	"gt": "gt", ">": "gt",
+	"gte": "gte", ">=": "gte",
+	"lt": "lt", "<": "lt",
+	"lte": "lte", "<=": "lte",
+	"eq": "eq", "=": "eq", "==": "eq",
+	"outside_range": "outside_range",
+	"abnormal":      "abnormal",
+}
+
+var comparatorSymbols = map[string]string{
+	"gt": ">", "gte": "≥", "lt": "<", "lte": "≤", "eq": "=",
+}
+
+// NormalizeComparator maps symbols such as ">=" to stored comparator names
+func NormalizeComparator(c string) (string, bool) {
+	name, ok := comparatorAliases[strings.ToLower(strings.TrimSpace(c))]
+	return name, ok
+}
+
+// NeedsThreshold reports whether a comparator compares against a number
+func NeedsThreshold(comparator string) bool {
+	return comparator != "outside_range" && comparator != "abnormal"
+}
+
+// ParseChannels validates a channel list and returns it in stored form
+func ParseChannels(channels []string) (string, error) {
+	if len(channels) == 0 {
+		return ChannelInApp, nil
+	}
+	seen := map[string]bool{}
+	var out []string
+	for _, c := range channels {
+		c = strings.ToLower(strings.TrimSpace(c))
+		switch c {
+		case ChannelInApp, ChannelEmail, ChannelWebhook:
+		default:
+			return "", fmt.Errorf("unknown channel %q", c)
+		}
+		if !seen[c] {
+			seen[c] = true
+			out = append(out, c)
+		}
+	}
+	return strings.Join(out, ","), nil
+}
+
+// hasChannel reports whether a rule delivers on channel
+func hasChannel(rule models.AlertRule, channel string) bool {
+	for _, c := range strings.Split(rule.Channels, ",") {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether one observation meets the rule's condition
+func Matches(rule models.AlertRule, obs models.Observation) bool {
+	switch rule.Comparator {
+	case "abnormal":
+		return obs.Flag != ""
+	case "outside_range":
+		low, high := obs.RefLow, obs.RefHigh
+		if low == nil && high == nil {
+			if a, ok := labs.ByCode(obs.Code); ok && obs.Unit == a.Unit {
+				low, high = a.RefLow, a.RefHigh
+			}
+		}
+		return (low != nil && obs.Value < *low) || (high != nil && obs.Value > *high)
+	}
+
+	if rule.Threshold == nil {
+		return false
+	}
+	value, ok := valueIn(obs, rule.Unit)
+	if !ok {
+		return false
+	}
+	t := *rule.Threshold
+	switch rule.Comparator {
+	case "gt":
+		return value > t
+	case "gte":
+		return value >= t
+	case "lt":
+		return value < t
+	case "lte":
+		return value <= t
+	case "eq":
+		return value == t
+	}
+	return false
+}
+
+// valueIn expresses an observation in the unit a rule was written in
+func valueIn(obs models.Observation, unit string) (float64, bool) {
+	if unit == "" || obs.Unit == unit {
+		return obs.Value, true
+	}
+	a, ok := labs.ByCode(obs.Code)
+	if !ok {
+		return 0, false
+	}
+	v, err := a.Convert(obs.Value, obs.Unit, unit)
+	return v, err == nil
+}
+
+// Describe renders the rule's condition, e.g. "> 160 mg/dL twice within 48 hours"
+func Describe(rule models.AlertRule) string {
+	var cond string
+	switch rule.Comparator {
+	case "abnormal":
+		cond = "flagged abnormal"
+	case "outside_range":
+		cond = "outside the reference range"
+	default:
+		if rule.Threshold == nil {
+			return rule.Comparator
+		}
+		cond = fmt.Sprintf("%s %g %s", comparatorSymbols[rule.Comparator], *rule.Threshold, units.Symbol(rule.Unit))
+	}
+	if rule.WindowHours > 0 && rule.MinOccurrences > 1 {
+		cond += fmt.Sprintf(" %d times within %d hours", rule.MinOccurrences, rule.WindowHours)
+	}
+	return strings.TrimSpace(cond)
+}
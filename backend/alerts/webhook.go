@@ -0,0 +1,80 @@
+// alerts/webhook.go
+package alerts
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrWebhookURL is returned for webhook URLs alerts may not be posted to
+var ErrWebhookURL = errors.New("webhook URL must be https on a public host")
+
+// sharedAddress is the carrier-grade NAT range, which net/netip does not
+// count as private
+var sharedAddress = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicAddr reports whether ip is a routable public address. Loopback,
+// private, link-local (including cloud metadata services), unique local and
+// other special addresses are refused, so rules cannot aim alerts, which
+// carry health data, at services inside our network.
+func publicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if ip.Is4() && ip.As4()[0] == 0 { // "This network"
+		return false
+	}
+	return ip.IsValid() && ip.IsGlobalUnicast() && !ip.IsPrivate() &&
+		!ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !sharedAddress.Contains(ip)
+}
+
+// ValidateWebhookURL checks that raw is an https URL whose host, if given as
+// an address, is public. Names are checked again on every connection, as
+// they may resolve differently later.
+func ValidateWebhookURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" || u.User != nil {
+		return "", ErrWebhookURL
+	}
+	if ip, err := netip.ParseAddr(u.Hostname()); err == nil && !publicAddr(ip) {
+		return "", ErrWebhookURL
+	}
+	if u.Hostname() == "localhost" {
+		return "", ErrWebhookURL
+	}
+	return u.String(), nil
+}
+
+// NewWebhookClient returns a client that only connects to public addresses.
+// The check runs on the resolved address of each connection, so a name
+// that resolves to an internal address, at first or after a DNS change, is
+// refused too. Proxies are not used and redirects are not followed, as
+// either would bypass the check.
+func NewWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addr, err := netip.ParseAddrPort(address)
+			if err != nil || !publicAddr(addr.Addr()) {
+				return fmt.Errorf("%w: refusing to connect to %s", ErrWebhookURL, address)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
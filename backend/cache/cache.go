@@ -0,0 +1,247 @@
+// cache/cache.go
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+)
+
+// Entry is a cached value and when it expires
+type Entry struct {
+	Value     []byte
+	ExpiresAt time.Time
+}
+
+// Store keeps entries until they expire
+type Store interface {
+	Get(ctx context.Context, key string) (Entry, bool, error)
+	Set(ctx context.Context, key string, entry Entry) error
+}
+
+// Cache looks values up in a small in-memory store first and a shared one
+// second. Concurrent loads of the same key are coalesced, so a burst of
+// identical questions costs one call to the AI services. A nil *Cache is
+// valid and caches nothing.
+type Cache struct {
+	Local    Store     // In this process; may be nil
+	Shared   Store     // Across instances; may be nil
+	Versions *Versions // Data versions that keys are built with
+
+	group singleflight.Group
+}
+
+// Loader produces the value of a key on a miss, and how long it may be
+// cached. A ttl of 0 keeps the value out of the cache, for values that turn
+// out to depend on more than their key, such as an answer that looked up
+// the user's records.
+type Loader func(ctx context.Context) (value []byte, ttl time.Duration, err error)
+
+type loaded struct {
+	value []byte
+	ttl   time.Duration
+	hit   bool
+}
+
+// GetOrLoad returns the cached value of key or the one load produces. hit
+// reports whether the value came from the cache or from a concurrent
+// caller's load rather than from this call's.
+func (c *Cache) GetOrLoad(ctx context.Context, key string, load Loader) (value []byte, hit bool, err error) {
+	if c == nil {
+		value, _, err = load(ctx)
+		return value, false, err
+	}
+	if entry, ok := c.get(ctx, key); ok {
+		return entry.Value, true, nil
+	}
+
+	// The first caller loads under its own ctx, and later ones wait for its
+	// result until it is done
+	leader := false
+	v, err, _ := c.group.Do(key, func() (interface{}, error) {
+		leader = true
+		// Another instance may have stored it while this one waited
+		if entry, ok := c.get(ctx, key); ok {
+			return loaded{value: entry.Value, ttl: time.Until(entry.ExpiresAt), hit: true}, nil
+		}
+		value, ttl, err := load(ctx)
+		if err == nil && ttl > 0 {
+			c.set(ctx, key, Entry{Value: value, ExpiresAt: time.Now().Add(ttl)})
+		}
+		return loaded{value: value, ttl: ttl}, err
+	})
+	l, _ := v.(loaded)
+	if leader {
+		return l.value, l.hit, err
+	}
+	// The loading caller's own deadline or disconnect is no reason for this
+	// one to fail, and an uncacheable value is not this caller's to see
+	if isContextErr(err) || (err == nil && l.ttl <= 0) {
+		if ctx.Err() != nil {
+			return nil, false, ctx.Err()
+		}
+		value, _, err = load(ctx)
+		return value, false, err
+	}
+	return l.value, err == nil, err
+}
+
+// LoadJSON is GetOrLoad for values stored as JSON. load returns the value
+// and its ttl; out receives the cached or loaded value.
+func (c *Cache) LoadJSON(ctx context.Context, key string, out interface{}, load func(ctx context.Context) (interface{}, time.Duration, error)) (hit bool, err error) {
+	value, hit, err := c.GetOrLoad(ctx, key, func(ctx context.Context) ([]byte, time.Duration, error) {
+		v, ttl, err := load(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+		data, err := json.Marshal(v)
+		return data, ttl, err
+	})
+	if err != nil {
+		return hit, err
+	}
+	return hit, json.Unmarshal(value, out)
+}
+
+// Version returns the data version of scope. Without a version table every
+// scope is at version 0, and nothing is invalidated.
+func (c *Cache) Version(ctx context.Context, scope string) (int64, error) {
+	if c == nil || c.Versions == nil {
+		return 0, nil
+	}
+	return c.Versions.Get(ctx, scope)
+}
+
+// Invalidate bumps the data version of scope, so entries built from its
+// current data are not served again
+func (c *Cache) Invalidate(ctx context.Context, scope string) {
+	if c == nil || c.Versions == nil {
+		return
+	}
+	if err := c.Versions.Bump(ctx, scope); err != nil {
+		log.Printf("cache: invalidating %s: %v", scope, err)
+	}
+}
+
+// get checks the local store, then the shared one, copying shared hits
+// into the local store. Store errors count as misses.
+func (c *Cache) get(ctx context.Context, key string) (Entry, bool) {
+	if c.Local != nil {
+		if entry, ok, _ := c.Local.Get(ctx, key); ok {
+			return entry, true
+		}
+	}
+	if c.Shared != nil {
+		entry, ok, err := c.Shared.Get(ctx, key)
+		if err != nil {
+			log.Printf("cache: reading %s: %v", key, err)
+			return Entry{}, false
+		}
+		if ok {
+			if c.Local != nil {
+				c.Local.Set(ctx, key, entry)
+			}
+			return entry, true
+		}
+	}
+	return Entry{}, false
+}
+
+func (c *Cache) set(ctx context.Context, key string, entry Entry) {
+	if c.Local != nil {
+		c.Local.Set(ctx, key, entry)
+	}
+	if c.Shared != nil {
+		// Stored even when the caller has gone away; the value is complete
+		if err := c.Shared.Set(context.WithoutCancel(ctx), key, entry); err != nil {
+			log.Printf("cache: storing %s: %v", key, err)
+		}
+	}
+}
+
+func isContextErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// Key builds a cache key from a namespace and the parts that identify the
+// value. The parts are hashed, so keys have a fixed length and do not hold
+// question text.
+func Key(namespace string, parts ...interface{}) string {
+	h := sha256.New()
+	for _, p := range parts {
+		fmt.Fprintf(h, "%v\x00", p)
+	}
+	return namespace + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+// Normalize folds differences in case, spacing and trailing punctuation
+// that do not change what a question asks, so they share a cache entry
+func Normalize(query string) string {
+	query = strings.Join(strings.Fields(strings.ToLower(query)), " ")
+	return strings.TrimRight(query, "?!. ")
+}
+
+var (
+	shared     *Cache
+	sharedOnce sync.Once
+)
+
+// FromEnv returns the process-wide cache configured by CACHE_SIZE, the
+// number of entries kept in memory (default 1000, 0 for none), and
+// CACHE_SHARED, "postgres" (default) to share entries between instances
+// through the database or "none". It returns nil when both are off.
+func FromEnv(db *gorm.DB) *Cache {
+	sharedOnce.Do(func() {
+		c := &Cache{Versions: NewVersions(db)}
+		size := 1000
+		if v := os.Getenv("CACHE_SIZE"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				log.Fatalf("Invalid CACHE_SIZE %q", v)
+			}
+			size = n
+		}
+		if size > 0 {
+			c.Local = NewLRU(size)
+		}
+		switch strings.ToLower(os.Getenv("CACHE_SHARED")) {
+		case "", "postgres":
+			store := NewPostgres(db)
+			store.PurgeEvery(time.Hour)
+			c.Shared = store
+		case "none":
+		default:
+			log.Fatalf("Unknown CACHE_SHARED %q", os.Getenv("CACHE_SHARED"))
+		}
+		if c.Local != nil || c.Shared != nil {
+			shared = c
+		}
+	})
+	return shared
+}
+
+// TTL returns how long values of a kind are cached, from CACHE_<KIND>_TTL
+// (a duration such as "30m") or fallback. 0 turns that kind of caching off.
+func TTL(kind string, fallback time.Duration) time.Duration {
+	v := os.Getenv("CACHE_" + strings.ToUpper(kind) + "_TTL")
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Fatalf("Invalid CACHE_%s_TTL %q", strings.ToUpper(kind), v)
+	}
+	return d
+}
@@ -0,0 +1,70 @@
+// cache/lru.go
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// LRU is an in-memory store holding at most Size entries. The least
+// recently used entry is evicted to make room for a new one.
+type LRU struct {
+	Size int
+
+	mu      sync.Mutex
+	order   *list.List // Front is the most recently used
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key string
+	Entry
+}
+
+// NewLRU creates an empty LRU store
+func NewLRU(size int) *LRU {
+	return &LRU{Size: size, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (l *LRU) Get(ctx context.Context, key string) (Entry, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	el, ok := l.entries[key]
+	if !ok {
+		return Entry{}, false, nil
+	}
+	e := el.Value.(*lruEntry)
+	if !time.Now().Before(e.ExpiresAt) {
+		l.order.Remove(el)
+		delete(l.entries, key)
+		return Entry{}, false, nil
+	}
+	l.order.MoveToFront(el)
+	return e.Entry, true, nil
+}
+
+func (l *LRU) Set(ctx context.Context, key string, entry Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if el, ok := l.entries[key]; ok {
+		el.Value.(*lruEntry).Entry = entry
+		l.order.MoveToFront(el)
+		return nil
+	}
+	l.entries[key] = l.order.PushFront(&lruEntry{key: key, Entry: entry})
+	for l.order.Len() > l.Size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.entries, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
+
+// Len returns the number of entries, including expired ones not yet evicted
+func (l *LRU) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.order.Len()
+}
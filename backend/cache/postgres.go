@@ -0,0 +1,65 @@
+// cache/postgres.go
+package cache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Postgres is a store in the cache_entries table, shared by every backend
+// instance and kept across restarts
+type Postgres struct {
+	DB *gorm.DB
+}
+
+// NewPostgres creates a store over db
+func NewPostgres(db *gorm.DB) *Postgres {
+	return &Postgres{DB: db}
+}
+
+func (p *Postgres) Get(ctx context.Context, key string) (Entry, bool, error) {
+	var row models.CacheEntry
+	err := p.DB.WithContext(ctx).Where("key = ? AND expires_at > ?", key, time.Now()).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Entry{}, false, nil
+	}
+	if err != nil {
+		return Entry{}, false, err
+	}
+	return Entry{Value: row.Value, ExpiresAt: row.ExpiresAt}, true, nil
+}
+
+func (p *Postgres) Set(ctx context.Context, key string, entry Entry) error {
+	return p.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "expires_at", "created_at"}),
+	}).Create(&models.CacheEntry{Key: key, Value: entry.Value, ExpiresAt: entry.ExpiresAt}).Error
+}
+
+// Purge deletes expired entries and returns how many there were
+func (p *Postgres) Purge(ctx context.Context) (int64, error) {
+	result := p.DB.WithContext(ctx).Where("expires_at <= ?", time.Now()).Delete(&models.CacheEntry{})
+	return result.RowsAffected, result.Error
+}
+
+// PurgeEvery runs Purge in the background every interval
+func (p *Postgres) PurgeEvery(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			if n, err := p.Purge(ctx); err != nil {
+				log.Printf("cache: purging expired entries: %v", err)
+			} else if n > 0 {
+				log.Printf("cache: purged %d expired entries", n)
+			}
+			cancel()
+		}
+	}()
+}
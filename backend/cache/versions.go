@@ -0,0 +1,51 @@
+// cache/versions.go
+package cache
+
+import (
+	"context"
+	"time"
+
+	"backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Knowledge is the scope of the shared knowledge base
+const Knowledge = "knowledge"
+
+// UserScope is the scope of one user's health records
+func UserScope(userID uuid.UUID) string {
+	return "user:" + userID.String()
+}
+
+// Versions reads and bumps the data versions in data_versions. Bumping a
+// scope makes every cache key built with its old version unreachable, in
+// this process and every other one, so nothing has to be deleted.
+type Versions struct {
+	DB *gorm.DB
+}
+
+// NewVersions creates a version table over db
+func NewVersions(db *gorm.DB) *Versions {
+	return &Versions{DB: db}
+}
+
+// Get returns the current version of scope, 0 if it never changed
+func (v *Versions) Get(ctx context.Context, scope string) (int64, error) {
+	var row models.DataVersion
+	err := v.DB.WithContext(ctx).Where("scope = ?", scope).Limit(1).Find(&row).Error
+	return row.Version, err
+}
+
+// Bump records a change to the data of scope
+func (v *Versions) Bump(ctx context.Context, scope string) error {
+	return v.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "scope"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"version":    gorm.Expr("data_versions.version + 1"),
+			"updated_at": time.Now(),
+		}),
+	}).Create(&models.DataVersion{Scope: scope, Version: 1}).Error
+}
@@ -0,0 +1,599 @@
+// chatbot/chatbot.go
+package chatbot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"backend/cache"
+	"backend/llm"
+	"backend/models"
+	"backend/phi"
+	"backend/prompts"
+	"backend/rag"
+	"backend/safety"
+	"backend/usage"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrConversationNotFound = errors.New("conversation not found")
+	ErrGeneration           = errors.New("generation failed")
+)
+
+// Service answers health questions. It retrieves reference passages, adds
+// the user's health records and the conversation so far, and asks the
+// generator for an answer. Questions and answers pass safety checks on the
+// way. Both turns are stored on success.
+type Service struct {
+	DB              *gorm.DB
+	Retriever       rag.Retriever    // Knowledge base passages
+	Records         *rag.RecordIndex // The user's own health records
+	Passages        int              // Knowledge passages retrieved per question
+	RecordPassages  int              // Record passages retrieved per question
+	Generator       llm.Generator    // Answers questions
+	Summarizer      llm.Generator    // Condenses long conversations
+	Translator      llm.Generator    // Translates questions to English for retrieval, and fixed texts to the user's language
+	HistoryBudget   int              // Approximate tokens of summary and prior turns per prompt
+	RecordTokens    int              // Approximate tokens of record passages per prompt
+	KnowledgeTokens int              // Approximate tokens of knowledge passages per prompt
+	Safety          *safety.Guard    // Emergency escalation, refusals and disclaimers
+	ToolRounds      int              // Generator turns that may call tools before it must answer; 0 disables tools
+	Prompts         *prompts.Store   // Versioned answer prompts and their A/B rollout
+	Cache           *cache.Cache     // Answers to questions that do not involve the user's data; nil disables
+	AnswerTTL       time.Duration
+	TranslationTTL  time.Duration // How long translations of fixed texts are cached
+	Usage           *usage.Meter  // Budgets checked before answering; nil allows everything
+}
+
+// NewService creates a chatbot service using the retriever selected by
+// rag.RetrieverFromEnv, the generators configured for the "chat" and
+// "summary" and "translate" features (see llm.ConfigFromEnv) and the
+// safety rules selected by safety.RulesFromEnv. Generic answers are cached
+// in cache.FromEnv for CACHE_ANSWERS_TTL (default 24h), translations of
+// fixed texts for CACHE_TRANSLATIONS_TTL (default 30 days). Generator calls
+// are metered, and budgets enforced, by usage.FromEnv.
+func NewService(db *gorm.DB) *Service {
+	retriever, err := rag.RetrieverFromEnv(db)
+	if err != nil {
+		log.Fatal("Failed to configure retriever: ", err)
+	}
+	records, err := rag.RecordIndexFromEnv(db)
+	if err != nil {
+		log.Fatal("Failed to configure record index: ", err)
+	}
+	guard, err := safety.GuardFromEnv()
+	if err != nil {
+		log.Fatal("Failed to load safety rules: ", err)
+	}
+	meter := usage.FromEnv(db)
+	return &Service{
+		DB:              db,
+		Retriever:       retriever,
+		Records:         records,
+		Passages:        6,
+		RecordPassages:  8,
+		Generator:       mustGenerator("chat", meter),
+		Summarizer:      mustGenerator("summary", meter),
+		Translator:      mustGenerator("translate", meter),
+		HistoryBudget:   1500,
+		RecordTokens:    1200,
+		KnowledgeTokens: 1000,
+		Safety:          guard,
+		ToolRounds:      4,
+		Prompts:         prompts.NewStore(db),
+		Cache:           cache.FromEnv(db),
+		AnswerTTL:       cache.TTL("answers", 24*time.Hour),
+		TranslationTTL:  cache.TTL("translations", 30*24*time.Hour),
+		Usage:           meter,
+	}
+}
+
+// mustGenerator creates the generator of a feature, redacting identifiers
+// from its prompts as configured by LLM_<FEATURE>_PHI or LLM_PHI, and
+// recording its calls in meter
+func mustGenerator(feature string, meter *usage.Meter) llm.Generator {
+	cfg := llm.ConfigFromEnv(feature)
+	g, err := llm.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to configure %s generator: %v", feature, err)
+	}
+	policy, err := phi.PolicyFor(cfg.Provider, cfg.PHI)
+	if err != nil {
+		log.Fatalf("Failed to configure %s redaction: %v", feature, err)
+	}
+	return usage.WrapGenerator(phi.WrapGenerator(g, policy), feature, meter)
+}
+
+// Request is one question, optionally continuing a conversation
+type Request struct {
+	UserID         uuid.UUID
+	ConversationID *uuid.UUID // nil starts a new conversation
+	Question       string
+	Language       string // BCP 47 tag of the question and answer; detected when empty
+}
+
+// Answer is the stored reply to a question
+type Answer struct {
+	ConversationID uuid.UUID  `json:"conversation_id"`
+	MessageID      uuid.UUID  `json:"message_id"`
+	GeneratedText  string     `json:"generated_text"`
+	Citations      []Citation `json:"citations"`
+	Safety         string     `json:"safety,omitempty"`   // emergency, refuse or disclaimer when a safety rule applied
+	Degraded       bool       `json:"degraded,omitempty"` // Answered without reference passages because retrieval failed
+	PromptVersion  string     `json:"prompt_version,omitempty"`
+	Cached         bool       `json:"cached,omitempty"` // Generated earlier for the same question
+	Language       string     `json:"language"`         // BCP 47 tag of the answer's language
+}
+
+// Conversation loads a conversation owned by userID
+func (s *Service) Conversation(userID, id uuid.UUID) (*models.Conversation, error) {
+	var conv models.Conversation
+	if err := s.DB.Where("id = ? AND user_id = ?", id, userID).First(&conv).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrConversationNotFound
+		}
+		return nil, err
+	}
+	return &conv, nil
+}
+
+// Sink receives an answer while it is being produced. Sources is called
+// again with the longer list when tools add records as sources.
+type Sink interface {
+	RetrievalStarted()
+	Sources(citations []Citation)
+	Token(text string)
+}
+
+// Ask answers a question and records it in its conversation
+func (s *Service) Ask(ctx context.Context, req Request) (*Answer, error) {
+	return s.answer(ctx, req, nil)
+}
+
+// Stream answers a question like Ask, reporting progress and generated
+// tokens to sink. When ctx is cancelled mid-answer the upstream call is
+// abandoned and the text generated so far is stored as a truncated reply.
+func (s *Service) Stream(ctx context.Context, req Request, sink Sink) (*Answer, error) {
+	return s.answer(ctx, req, sink)
+}
+
+func (s *Service) answer(ctx context.Context, req Request, sink Sink) (*Answer, error) {
+	asked := time.Now()
+	ctx = usage.WithUser(s.withIdentity(ctx, req.UserID), req.UserID)
+
+	conv := &models.Conversation{ID: uuid.New(), UserID: req.UserID, Title: titleFor(req.Question)}
+	isNew := req.ConversationID == nil
+	if !isNew {
+		var err error
+		if conv, err = s.Conversation(req.UserID, *req.ConversationID); err != nil {
+			return nil, err
+		}
+	}
+
+	// Red flags get emergency advice straight away, without waiting on
+	// translation, retrieval or the generator. Detecting the language is
+	// local, so the reviewed reply for it can be given.
+	language := s.language(ctx, req)
+	checked := s.Safety.CheckQuestion(req.Question)
+	query := req.Question
+	if !checked.Blocks() {
+		// Emergency advice and refusals are given regardless of budget, but
+		// every later step is metered
+		if err := s.Usage.Check(ctx, req.UserID); err != nil {
+			return nil, err
+		}
+		// The knowledge base and safety rules are in English, so other
+		// questions are looked up and checked by their translation
+		query = s.englishQuery(ctx, req.Question, language)
+		if query != req.Question {
+			if translated := s.Safety.CheckQuestion(query); len(translated.Matches) > 0 {
+				checked = translated
+			}
+		}
+	}
+	var out generated
+	if checked.Blocks() {
+		out.text, out.model = s.Safety.Response(checked, language), "safety"
+		if sink != nil {
+			sink.Sources([]Citation{})
+			sink.Token(out.text)
+		}
+	} else {
+		var err error
+		if out, err = s.reply(ctx, req, conv, isNew, query, language, checked.Instructions, sink); err != nil {
+			return nil, err
+		}
+	}
+	text, citations, truncated := out.text, out.citations, out.cancelled != nil
+
+	var reviewed safety.Verdict
+	if !checked.Blocks() {
+		reviewed = s.Safety.CheckAnswer(text)
+		disclaimers := append(append([]string{}, checked.Disclaimers...), reviewed.Disclaimers...)
+		for i, d := range disclaimers {
+			disclaimers[i] = s.localize(ctx, d, language)
+		}
+		if final := safety.WithDisclaimers(text, disclaimers); final != text {
+			if sink != nil {
+				sink.Token(final[len(text):])
+			}
+			text = final
+		}
+	}
+
+	question := models.Message{
+		ID:             uuid.New(),
+		ConversationID: conv.ID,
+		UserID:         req.UserID,
+		Role:           models.MessageRoleUser,
+		Content:        req.Question,
+		Language:       language,
+		CreatedAt:      asked,
+	}
+	if citations == nil {
+		citations = []Citation{}
+	}
+	markCited(text, citations)
+	citationsJSON, _ := json.Marshal(citations)
+	reply := models.Message{
+		ID:             uuid.New(),
+		ConversationID: conv.ID,
+		UserID:         req.UserID,
+		Role:           models.MessageRoleAssistant,
+		Content:        text,
+		Citations:      datatypes.JSON(citationsJSON),
+		Truncated:      truncated,
+		Model:          out.model,
+		PromptVersion:  out.prompt,
+		Language:       language,
+		CreatedAt:      time.Now(),
+	}
+	// Saved without ctx so a disconnected client does not lose the turn
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if isNew {
+			if err := tx.Create(conv).Error; err != nil {
+				return err
+			}
+		} else {
+			updates := map[string]interface{}{"updated_at": reply.CreatedAt}
+			if conv.Title == "" {
+				updates["title"] = titleFor(req.Question)
+			}
+			if err := tx.Model(conv).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(&[]models.Message{question, reply}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.logSafety(reply, safety.StageQuestion, checked)
+	s.logSafety(reply, safety.StageAnswer, reviewed)
+
+	answer := &Answer{
+		ConversationID: conv.ID,
+		MessageID:      reply.ID,
+		GeneratedText:  text,
+		Citations:      citations,
+		Safety:         strongest(checked.Action, reviewed.Action),
+		Degraded:       out.degraded,
+		PromptVersion:  out.prompt,
+		Cached:         out.cached,
+		Language:       language,
+	}
+	if truncated {
+		return answer, fmt.Errorf("%w: %w", ErrGeneration, out.cancelled)
+	}
+	return answer, nil
+}
+
+// generated is the outcome of retrieval and generation
+type generated struct {
+	text      string
+	model     string
+	prompt    string // Label of the prompt version used
+	citations []Citation
+	degraded  bool  // Knowledge retrieval failed and was skipped
+	cached    bool  // The text was generated for an earlier identical prompt
+	cancelled error // ctx ended after some text was generated; text is partial
+}
+
+// reply retrieves sources for query, the question in English, and
+// generates the answer text in language. A failing knowledge base only
+// costs the answer its reference passages.
+func (s *Service) reply(ctx context.Context, req Request, conv *models.Conversation, isNew bool, query, language string, instructions []string, sink Sink) (generated, error) {
+	var out generated
+	var summary string
+	var turns []Turn
+	if !isNew {
+		var err error
+		if summary, turns, err = s.history(ctx, conv); err != nil {
+			return out, err
+		}
+	}
+
+	if sink != nil {
+		sink.RetrievalStarted()
+	}
+	records := s.userRecords(ctx, req.UserID, query)
+	passages, err := s.Retriever.Retrieve(ctx, query, s.Passages)
+	if err != nil {
+		if ctx.Err() != nil {
+			return out, ctx.Err()
+		}
+		log.Printf("chatbot: knowledge retrieval failed, answering without it: %v", err)
+		passages, out.degraded = nil, true
+	}
+	records = fitBudget(records, s.RecordTokens)
+	passages = fitBudget(passages, s.KnowledgeTokens)
+	citations, recordSources, knowledgeSources := s.numberSources(req.UserID, records, passages)
+	if sink != nil {
+		sink.Sources(citations)
+	}
+
+	// Tools are offered for ToolRounds turns; after that the generator has
+	// to answer with what it has looked up
+	useTools := s.ToolRounds > 0 && llm.SupportsTools(s.Generator)
+	input := promptInput{
+		Template:     s.promptFor(ctx, req.UserID),
+		Question:     req.Question,
+		Context:      knowledgeSources,
+		Records:      recordSources,
+		Summary:      summary,
+		History:      turns,
+		Profile:      s.profile(ctx, req.UserID),
+		Instructions: instructions,
+		Tools:        useTools,
+		Language:     language,
+	}
+	messages, err := buildPrompt(input)
+	if err != nil {
+		// A stored version that fails on real data must not stop answers
+		log.Printf("chatbot: %v, using the built-in prompt", err)
+		input.Template = builtinPrompt
+		if messages, err = buildPrompt(input); err != nil {
+			return out, err
+		}
+	}
+	out.prompt = input.Template.Label()
+	box := s.newToolbox(ctx, req.UserID, &citations)
+	generate := func(ctx context.Context) generation {
+		return s.generate(ctx, messages, useTools, box, &citations, sink)
+	}
+	var g generation
+	// Without records or earlier turns in the prompt an answer is only about
+	// the question, and can be reused for everyone asking it
+	if s.Cache != nil && s.AnswerTTL > 0 && len(records) == 0 && summary == "" && len(turns) == 0 && !out.degraded {
+		g, out.cached = s.generateCached(ctx, answerKey(s.Generator.Name(), useTools, messages), generate, sink)
+	} else {
+		g = generate(ctx)
+	}
+	out.text, out.model = g.text, g.model
+	if g.err != nil {
+		if ctx.Err() == nil || strings.TrimSpace(out.text) == "" {
+			return out, fmt.Errorf("%w: %w", ErrGeneration, g.err)
+		}
+		out.cancelled = ctx.Err() // The client went away; keep what was generated
+	}
+	out.citations = citations
+	return out, nil
+}
+
+// generation is the text of an answer and how it was produced
+type generation struct {
+	text  string
+	model string
+	tools bool // Tools were called, so the text depends on the user's data
+	err   error
+}
+
+// generate asks the generator for the answer to messages, running the tool
+// calls it makes
+func (s *Service) generate(ctx context.Context, messages []llm.Message, useTools bool, box *toolbox, citations *[]Citation, sink Sink) generation {
+	g := generation{model: s.Generator.Name()}
+	var text strings.Builder
+	for round := 0; ; round++ {
+		prompt := llm.Request{Messages: messages}
+		switch {
+		case useTools && round < s.ToolRounds:
+			prompt.Tools = toolDefinitions()
+		case round > 0:
+			prompt.Messages = append(messages, llm.Message{Role: llm.RoleSystem, Content: toolsExhaustedPrompt})
+		}
+		var resp *llm.Response
+		var err error
+		if sink != nil {
+			resp, err = s.Generator.Stream(ctx, prompt, sink.Token)
+		} else {
+			resp, err = s.Generator.Generate(ctx, prompt)
+		}
+		if resp != nil {
+			text.WriteString(resp.Text)
+			if resp.Model != "" {
+				g.model = resp.Model
+			}
+		}
+		if err != nil || len(resp.ToolCalls) == 0 || prompt.Tools == nil {
+			g.err = err
+			break
+		}
+
+		g.tools = true
+		sourced := len(*citations)
+		messages = append(messages, llm.Message{Role: llm.RoleAssistant, Content: resp.Text, ToolCalls: resp.ToolCalls})
+		messages = append(messages, box.run(ctx, resp.ToolCalls)...)
+		if sink != nil && len(*citations) > sourced {
+			sink.Sources(*citations)
+		}
+	}
+	g.text = text.String()
+	return g
+}
+
+// cachedAnswer is a generic answer as stored in the cache
+type cachedAnswer struct {
+	Text  string `json:"text"`
+	Model string `json:"model"`
+}
+
+// generateCached returns the cached answer of key, or generates and caches
+// it. Concurrent identical questions wait for one generation. Answers that
+// called tools are not cached. cached reports whether the text was
+// generated for another request.
+func (s *Service) generateCached(ctx context.Context, key string, generate func(context.Context) generation, sink Sink) (g generation, cached bool) {
+	ran := false
+	var stored cachedAnswer
+	hit, err := s.Cache.LoadJSON(ctx, key, &stored, func(ctx context.Context) (interface{}, time.Duration, error) {
+		ran = true
+		g = generate(ctx)
+		if g.err != nil {
+			return nil, 0, g.err
+		}
+		ttl := s.AnswerTTL
+		if g.tools {
+			ttl = 0
+		}
+		return cachedAnswer{Text: g.text, Model: g.model}, ttl, nil
+	})
+	if ran {
+		return g, false
+	}
+	if err != nil {
+		return generation{model: s.Generator.Name(), err: err}, false
+	}
+	if sink != nil {
+		sink.Token(stored.Text)
+	}
+	return generation{text: stored.Text, model: stored.Model}, hit
+}
+
+// answerKey identifies an answer by the generator and the full prompt, so a
+// new prompt version, knowledge passages or profile data make a new entry
+func answerKey(generator string, tools bool, messages []llm.Message) string {
+	var b strings.Builder
+	for _, m := range messages {
+		fmt.Fprintf(&b, "%s\x00%s\x00", m.Role, m.Content)
+	}
+	return cache.Key("answer", generator, tools, b.String())
+}
+
+// builtinPrompt is the chat prompt shipped with the backend
+var builtinPrompt = func() *prompts.Template {
+	t, err := prompts.Builtin(prompts.Chat)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}()
+
+// promptFor picks the chat prompt version of the user's cohort
+func (s *Service) promptFor(ctx context.Context, userID uuid.UUID) *prompts.Template {
+	if s.Prompts == nil {
+		return builtinPrompt
+	}
+	t, err := s.Prompts.Select(ctx, userID, prompts.Chat)
+	if err != nil {
+		log.Printf("chatbot: selecting prompt: %v, using the built-in prompt", err)
+		return builtinPrompt
+	}
+	return t
+}
+
+// profile reads the health data of the user's profile for prompts
+func (s *Service) profile(ctx context.Context, userID uuid.UUID) prompts.Profile {
+	var user models.User
+	var p prompts.Profile
+	if err := s.DB.WithContext(ctx).Select("id, gender, birth_date, height, weight").
+		First(&user, "id = ?", userID).Error; err != nil {
+		return p
+	}
+	p.Gender = user.Gender
+	if user.BirthDate != nil {
+		p.Age = ageOn(*user.BirthDate, time.Now())
+	}
+	if user.Height > 0 && user.Weight > 0 {
+		p.BMI = bmi(user.Height, user.Weight)
+	}
+	return p
+}
+
+// logSafety records the rules that applied to a reply
+func (s *Service) logSafety(reply models.Message, stage string, v safety.Verdict) {
+	if len(v.Matches) == 0 {
+		return
+	}
+	events := make([]models.SafetyEvent, len(v.Matches))
+	for i, m := range v.Matches {
+		log.Printf("chatbot: safety rule %s (%s) applied to %s of message %s", m.Rule.ID, m.Rule.Action, stage, reply.ID)
+		events[i] = models.SafetyEvent{
+			UserID:         reply.UserID,
+			ConversationID: reply.ConversationID,
+			MessageID:      reply.ID,
+			Stage:          stage,
+			RuleID:         m.Rule.ID,
+			Category:       m.Rule.Category,
+			Action:         m.Rule.Action,
+			Excerpt:        m.Excerpt,
+		}
+	}
+	if err := s.DB.Create(&events).Error; err != nil {
+		log.Printf("chatbot: storing safety events of message %s: %v", reply.ID, err)
+	}
+}
+
+// strongest returns the question action unless only the answer triggered a
+// rule
+func strongest(question, answer string) string {
+	if question != "" {
+		return question
+	}
+	return answer
+}
+
+// withIdentity adds the user's name, email and birth date to ctx, so they
+// are redacted wherever they appear in prompts
+func (s *Service) withIdentity(ctx context.Context, userID uuid.UUID) context.Context {
+	var user models.User
+	if err := s.DB.Select("name, email, birth_date").Where("id = ?", userID).First(&user).Error; err != nil {
+		return ctx
+	}
+	ids := []phi.Identifier{{Category: phi.Name, Value: user.Name}, {Category: phi.Email, Value: user.Email}}
+	if user.BirthDate != nil {
+		ids = append(ids, phi.Identifier{Category: phi.Date, Value: user.BirthDate.Format("2006-01-02")})
+	}
+	return phi.WithKnown(ctx, ids...)
+}
+
+// userRecords retrieves the user's records relevant to question. Records
+// are supporting context, so failures are logged and the answer goes ahead
+// without them.
+func (s *Service) userRecords(ctx context.Context, userID uuid.UUID, question string) []rag.Passage {
+	if err := s.Records.EnsureIndexed(ctx, userID); err != nil {
+		log.Printf("chatbot: indexing records of %s: %v", userID, err)
+	}
+	records, err := s.Records.Retrieve(ctx, userID, question, s.RecordPassages)
+	if err != nil {
+		log.Printf("chatbot: retrieving records of %s: %v", userID, err)
+		return nil
+	}
+	return records
+}
+
+// titleFor names a new conversation after its first question
+func titleFor(question string) string {
+	title := strings.Join(strings.Fields(question), " ")
+	if r := []rune(title); len(r) > 80 {
+		title = string(r[:80]) + "…"
+	}
+	return title
+}
@@ -0,0 +1,152 @@
+// chatbot/citations.go
+package chatbot
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/models"
+	"backend/rag"
+
+	"github.com/google/uuid"
+)
+
+// Citation is a numbered source given to the generator. The answer refers
+// to it inline as [Number].
+type Citation struct {
+	Number     int        `json:"number"`
+	ID         string     `json:"id"`   // Stable: knowledge passage hash or health record ID
+	Kind       string     `json:"kind"` // knowledge, health_record or health_concern
+	Title      string     `json:"title"`
+	Snippet    string     `json:"snippet"`
+	RecordID   string     `json:"record_id,omitempty"`
+	ImageID    string     `json:"image_id,omitempty"` // Uploaded image the record was read from
+	Link       string     `json:"link,omitempty"`
+	RecordedAt *time.Time `json:"recorded_at,omitempty"`
+	Cited      bool       `json:"cited"` // Referenced in the answer text
+}
+
+// source is a passage with the citation number it is shown under
+type source struct {
+	Number  int
+	Passage rag.Passage
+}
+
+// numberSources assigns citation numbers: one per health record, shared by
+// all of its passages, then one per knowledge passage
+func (s *Service) numberSources(userID uuid.UUID, records, passages []rag.Passage) ([]Citation, []source, []source) {
+	var citations []Citation
+	var recordSources, knowledgeSources []source
+	byRecord := map[string]int{}
+
+	for _, p := range records {
+		n, ok := byRecord[p.RecordID]
+		if !ok {
+			n = len(citations) + 1
+			byRecord[p.RecordID] = n
+			citations = append(citations, Citation{
+				Number:     n,
+				ID:         p.RecordID,
+				Kind:       p.Kind,
+				Title:      recordTitle(p),
+				Snippet:    snippet(withoutTitle(p.Content)),
+				RecordID:   p.RecordID,
+				Link:       "/api/healthdata/" + p.RecordID,
+				RecordedAt: p.RecordedAt,
+			})
+		}
+		recordSources = append(recordSources, source{Number: n, Passage: p})
+	}
+	s.linkImages(userID, citations)
+
+	for _, p := range passages {
+		n := len(citations) + 1
+		title := p.Source
+		if title == "" {
+			title = "Medical reference"
+		}
+		citations = append(citations, Citation{
+			Number:  n,
+			ID:      p.ID,
+			Kind:    p.Kind,
+			Title:   title,
+			Snippet: snippet(p.Content),
+			Link:    "/api/knowledge/" + p.ID,
+		})
+		knowledgeSources = append(knowledgeSources, source{Number: n, Passage: p})
+	}
+	return citations, recordSources, knowledgeSources
+}
+
+// linkImages attaches the uploaded image a record was read from, matched by
+// file name
+func (s *Service) linkImages(userID uuid.UUID, citations []Citation) {
+	names := map[string][]int{}
+	for i, c := range citations {
+		if c.Kind == rag.KindHealthRecord && c.Title != "" {
+			names[c.Title] = append(names[c.Title], i)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	list := make([]string, 0, len(names))
+	for name := range names {
+		list = append(list, name)
+	}
+
+	var images []models.UserImage
+	if err := s.DB.Select("id, image_name").
+		Where("user_id = ? AND image_name IN ?", userID, list).Find(&images).Error; err != nil {
+		return // Image links are a convenience; answer without them
+	}
+	for _, img := range images {
+		for _, i := range names[img.ImageName] {
+			citations[i].ImageID = img.ID
+		}
+	}
+}
+
+func recordTitle(p rag.Passage) string {
+	switch {
+	case p.Kind == rag.KindHealthConcern:
+		return "Health concerns"
+	case p.Source != "" && p.Source != "Unknown":
+		return p.Source
+	}
+	return "Health record"
+}
+
+// withoutTitle drops the title line that record chunks start with
+func withoutTitle(content string) string {
+	if i := strings.IndexByte(content, '\n'); i >= 0 {
+		return content[i+1:]
+	}
+	return content
+}
+
+// snippet shortens passage text for display
+func snippet(content string) string {
+	const max = 200
+	content = strings.Join(strings.Fields(content), " ")
+	if r := []rune(content); len(r) > max {
+		content = string(r[:max]) + "…"
+	}
+	return content
+}
+
+var citationRef = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// markCited flags the citations referenced in text as [1] or [1, 2]
+func markCited(text string, citations []Citation) {
+	for _, m := range citationRef.FindAllStringSubmatch(text, -1) {
+		for _, part := range strings.Split(m[1], ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(part))
+			if err == nil && n >= 1 && n <= len(citations) {
+				citations[n-1].Cited = true
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// chatbot/history.go
+package chatbot
+
+import (
+	"context"
+	"log"
+
+	"backend/models"
+)
+
+// estimateTokens approximates the token count of text at four bytes a token
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// history returns the conversation summary and the most recent turns that fit
+// the history budget. Turns pushed out of the budget are folded into the
+// stored summary, so each message is summarized at most once.
+func (s *Service) history(ctx context.Context, conv *models.Conversation) (string, []Turn, error) {
+	query := s.DB.Where("conversation_id = ?", conv.ID)
+	if conv.SummaryUntil != nil {
+		query = query.Where("created_at > ?", *conv.SummaryUntil)
+	}
+	var messages []models.Message
+	if err := query.Order("created_at ASC").Find(&messages).Error; err != nil {
+		return "", nil, err
+	}
+
+	// Walk back from the newest turn until the budget is spent
+	used, keepFrom := estimateTokens(conv.Summary), len(messages)
+	for keepFrom > 0 {
+		cost := estimateTokens(messages[keepFrom-1].Content)
+		if used+cost > s.HistoryBudget {
+			break
+		}
+		used += cost
+		keepFrom--
+	}
+
+	if keepFrom > 0 {
+		older := toTurns(messages[:keepFrom])
+		summary, err := s.summarize(ctx, conv.Summary, older)
+		if err != nil {
+			// Answer without the oldest turns rather than failing the question
+			log.Printf("chatbot: summarizing conversation %s: %v", conv.ID, err)
+		} else {
+			until := messages[keepFrom-1].CreatedAt
+			if err := s.DB.Model(conv).Updates(map[string]interface{}{
+				"summary":       summary,
+				"summary_until": until,
+			}).Error; err != nil {
+				return "", nil, err
+			}
+			conv.Summary, conv.SummaryUntil = summary, &until
+		}
+	}
+
+	return conv.Summary, toTurns(messages[keepFrom:]), nil
+}
+
+func toTurns(messages []models.Message) []Turn {
+	turns := make([]Turn, 0, len(messages))
+	for _, m := range messages {
+		turns = append(turns, Turn{Role: m.Role, Content: m.Content})
+	}
+	return turns
+}
@@ -0,0 +1,99 @@
+// chatbot/language.go
+package chatbot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"backend/cache"
+	"backend/lang"
+	"backend/llm"
+	"backend/models"
+)
+
+const translatePrompt = `Translate the user's message from %s to %s.
+Keep medical terms, numbers, units and placeholders such as [NAME_1] as they are.
+Reply with the translation only, without notes or quotes.`
+
+// language picks the language of a question: the one the request names,
+// else the one it is detected to be written in, else the user's preferred
+// language, else English
+func (s *Service) language(ctx context.Context, req Request) string {
+	if req.Language != "" {
+		return req.Language
+	}
+	var user models.User
+	s.DB.WithContext(ctx).Select("id, language").Where("id = ?", req.UserID).First(&user)
+	tag, _ := lang.Detect(req.Question, user.Language)
+	if tag == "" {
+		return lang.English
+	}
+	return tag
+}
+
+// translate asks the translator for text in another language
+func (s *Service) translate(ctx context.Context, text, from, to string) (string, error) {
+	resp, err := s.Translator.Generate(ctx, llm.Request{
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Content: fmt.Sprintf(translatePrompt, lang.Name(from), lang.Name(to))},
+			{Role: llm.RoleUser, Content: text},
+		},
+		MaxTokens:   64 + 2*estimateTokens(text),
+		Temperature: 0.01, // 0 would use the generator default
+	})
+	if err != nil {
+		return "", err
+	}
+	translated := strings.TrimSpace(resp.Text)
+	if translated == "" {
+		return "", fmt.Errorf("empty translation")
+	}
+	return translated, nil
+}
+
+// englishQuery translates a question for retrieval from the English
+// knowledge base and for the safety rules. A failed translation leaves the
+// question as asked; keyword and vector search still find some passages.
+func (s *Service) englishQuery(ctx context.Context, question, language string) string {
+	if lang.IsEnglish(language) || s.Translator == nil {
+		return question
+	}
+	english, err := s.translate(ctx, question, language, lang.English)
+	if err != nil {
+		log.Printf("chatbot: translating question from %s: %v", language, err)
+		return question
+	}
+	return english
+}
+
+// localize translates a fixed English text, such as a disclaimer, into
+// language. Emergency replies and refusals are not machine translated; see
+// safety.Rules.ResponseIn. Translations are cached, so each text is
+// translated once per language. The English text is used when translation
+// fails.
+func (s *Service) localize(ctx context.Context, text, language string) string {
+	if lang.IsEnglish(language) || s.Translator == nil || strings.TrimSpace(text) == "" {
+		return text
+	}
+	var translated string
+	key := cache.Key("translation", s.Translator.Name(), language, text)
+	_, err := s.Cache.LoadJSON(ctx, key, &translated, func(ctx context.Context) (interface{}, time.Duration, error) {
+		t, err := s.translate(ctx, text, lang.English, language)
+		return t, s.TranslationTTL, err
+	})
+	if err != nil {
+		log.Printf("chatbot: translating to %s: %v", language, err)
+		return text
+	}
+	return translated
+}
+
+// languageInstruction asks for the answer in the question's language
+func languageInstruction(language string) string {
+	name := lang.Name(language)
+	return fmt.Sprintf("The user writes in %s. Write your whole answer in %s, even though the records and reference passages are in English. "+
+		"Keep source numbers like [1] and lab values with their units unchanged.", name, name)
+}
@@ -0,0 +1,137 @@
+// chatbot/prompt.go
+package chatbot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"backend/lang"
+	"backend/llm"
+	"backend/prompts"
+	"backend/rag"
+)
+
+// Turn is one prior message sent along with a follow-up question
+type Turn struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// promptInput is everything an answer prompt is built from
+type promptInput struct {
+	Template *prompts.Template
+	Question string
+	Context  []source // Knowledge base passages
+	Records  []source // Passages of the user's own records
+	Profile  prompts.Profile
+	Summary  string
+	History  []Turn
+
+	Instructions []string // From safety rules that applied to the question
+	Tools        bool     // The generator is offered tools
+	Language     string   // BCP 47 tag of the language to answer in
+}
+
+// buildPrompt lays out the template's system message, the earlier
+// conversation as chat turns, and the template's message carrying the
+// user's data, reference passages and question
+func buildPrompt(in promptInput) ([]llm.Message, error) {
+	data := prompts.Data{Question: in.Question, Profile: in.Profile, Language: lang.Name(lang.English), Today: time.Now()}
+	if in.Language != "" {
+		data.Language = lang.Name(in.Language)
+	}
+	for _, r := range in.Records {
+		data.Records = append(data.Records, prompts.Source{
+			Number: r.Number, Title: recordTitle(r.Passage), Date: r.Passage.RecordedAt, Content: r.Passage.Content,
+		})
+	}
+	for _, c := range in.Context {
+		data.Context = append(data.Context, prompts.Source{Number: c.Number, Title: c.Passage.Source, Content: c.Passage.Content})
+	}
+	system, user, err := in.Template.Render(data)
+	if err != nil {
+		return nil, fmt.Errorf("rendering prompt %s: %w", in.Template.Label(), err)
+	}
+
+	messages := []llm.Message{{Role: llm.RoleSystem, Content: system}}
+	if in.Tools {
+		messages = append(messages, llm.Message{Role: llm.RoleSystem, Content: toolsPrompt})
+	}
+	if !lang.IsEnglish(in.Language) {
+		messages = append(messages, llm.Message{Role: llm.RoleSystem, Content: languageInstruction(in.Language)})
+	}
+	for _, instruction := range in.Instructions {
+		messages = append(messages, llm.Message{Role: llm.RoleSystem, Content: instruction})
+	}
+	if in.Summary != "" {
+		messages = append(messages, llm.Message{
+			Role:    llm.RoleSystem,
+			Content: "Summary of the earlier conversation: " + in.Summary,
+		})
+	}
+	for _, t := range in.History {
+		messages = append(messages, llm.Message{Role: llmRole(t.Role), Content: t.Content})
+	}
+	return append(messages, llm.Message{Role: llm.RoleUser, Content: user}), nil
+}
+
+// fitBudget keeps passages, best first, while their estimated tokens fit in
+// budget. A passage too large for the remaining budget is skipped so a
+// smaller one further down can still be used.
+func fitBudget(passages []rag.Passage, budget int) []rag.Passage {
+	var out []rag.Passage
+	used := 0
+	for _, p := range passages {
+		cost := estimateTokens(p.Content)
+		if used+cost > budget {
+			continue
+		}
+		used += cost
+		out = append(out, p)
+	}
+	return out
+}
+
+// llmRole maps a stored message role to a chat role
+func llmRole(role string) string {
+	if role == llm.RoleAssistant {
+		return llm.RoleAssistant
+	}
+	return llm.RoleUser
+}
+
+const summaryPrompt = `Summarize the following conversation between a user and MediBuddy, a medical assistant chatbot.
+Keep symptoms, conditions, medications, test results and advice already given. Use at most 150 words.`
+
+// summarize folds turns into an existing conversation summary
+func (s *Service) summarize(ctx context.Context, summary string, turns []Turn) (string, error) {
+	var b strings.Builder
+	if summary != "" {
+		fmt.Fprintf(&b, "Summary so far: %s\n", summary)
+	}
+	for _, t := range turns {
+		speaker := "User"
+		if t.Role == llm.RoleAssistant {
+			speaker = "MediBuddy"
+		}
+		fmt.Fprintf(&b, "%s: %s\n", speaker, t.Content)
+	}
+
+	resp, err := s.Summarizer.Generate(ctx, llm.Request{
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Content: summaryPrompt},
+			{Role: llm.RoleUser, Content: b.String()},
+		},
+		MaxTokens:   250,
+		Temperature: 0.2,
+	})
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(resp.Text) == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	return strings.TrimSpace(resp.Text), nil
+}
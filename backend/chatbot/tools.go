@@ -0,0 +1,730 @@
+// chatbot/tools.go
+package chatbot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/labs"
+	"backend/llm"
+	"backend/models"
+	"backend/rag"
+	"backend/trends"
+	"backend/units"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const toolsPrompt = `You can call tools that look up the user's stored health data exactly. Use them for specific values, dates, changes over time, medications and personal details such as BMI, instead of guessing from the passages you are given.
+Tool results give a source number for each record they draw on; cite it like any other source. If a tool finds nothing, say the data is not on file.`
+
+const toolsExhaustedPrompt = `No more tools are available. Answer now with the information you have.`
+
+// maxCallsPerTurn bounds the tool calls run for one generator turn
+const maxCallsPerTurn = 8
+
+// toolbox runs the lookups the generator may call. It is bound to one user:
+// no tool takes a user as an argument and every query is scoped to userID.
+type toolbox struct {
+	service   *Service
+	db        *gorm.DB
+	userID    uuid.UUID
+	prefs     units.Preferences
+	citations *[]Citation // Records the tools draw on are added as sources
+	records   []toolRecord
+	loaded    bool
+}
+
+// toolRecord is a stored health record with what the tools show of it
+type toolRecord struct {
+	ID    uuid.UUID
+	Type  string // lab_report, measurements, health_concerns or triage
+	Kind  string // Citation kind
+	Title string
+	Text  string
+	Data  map[string]interface{}
+	Date  *time.Time
+}
+
+type tool struct {
+	llm.Tool
+	run func(tb *toolbox, ctx context.Context, args json.RawMessage) (interface{}, error)
+}
+
+var chatTools = []tool{
+	{
+		Tool: llm.Tool{
+			Name:        "list_records",
+			Description: "List the user's health records, newest first, with the results extracted from each.",
+			Parameters: json.RawMessage(`{"type":"object","properties":{
+				"type":{"type":"string","enum":["any","lab_report","measurements","health_concerns","triage"],"description":"Kind of record, any by default"},
+				"from":{"type":"string","description":"Earliest record date, YYYY-MM-DD"},
+				"to":{"type":"string","description":"Latest record date, YYYY-MM-DD"},
+				"limit":{"type":"integer","minimum":1,"maximum":25,"description":"Records to return, 10 by default"}}}`),
+		},
+		run: (*toolbox).listRecords,
+	},
+	{
+		Tool: llm.Tool{
+			Name:        "get_latest_observation",
+			Description: "Get the user's most recent value of a lab test or vital sign, e.g. HbA1c, LDL cholesterol, blood pressure systolic, weight.",
+			Parameters: json.RawMessage(`{"type":"object","properties":{
+				"analyte":{"type":"string","description":"Test name or LOINC code"}},"required":["analyte"]}`),
+		},
+		run: (*toolbox).latestObservation,
+	},
+	{
+		Tool: llm.Tool{
+			Name:        "compute_trend",
+			Description: "Compute how a lab test or vital sign changed over time: first, latest, minimum and maximum values, percent change, direction and the values themselves.",
+			Parameters: json.RawMessage(`{"type":"object","properties":{
+				"analyte":{"type":"string","description":"Test name or LOINC code"},
+				"from":{"type":"string","description":"Start date, YYYY-MM-DD"},
+				"to":{"type":"string","description":"End date, YYYY-MM-DD"}},"required":["analyte"]}`),
+		},
+		run: (*toolbox).computeTrend,
+	},
+	{
+		Tool: llm.Tool{
+			Name:        "list_medications",
+			Description: "List the medications written in the user's records and health data, newest record first.",
+			Parameters:  json.RawMessage(`{"type":"object","properties":{}}`),
+		},
+		run: (*toolbox).listMedications,
+	},
+	{
+		Tool: llm.Tool{
+			Name:        "get_personal_info",
+			Description: "Get the user's age, gender, height, weight and BMI from their profile.",
+			Parameters:  json.RawMessage(`{"type":"object","properties":{}}`),
+		},
+		run: (*toolbox).personalInfo,
+	},
+}
+
+// toolDefinitions lists the tools offered to the generator
+func toolDefinitions() []llm.Tool {
+	defs := make([]llm.Tool, len(chatTools))
+	for i, t := range chatTools {
+		defs[i] = t.Tool
+	}
+	return defs
+}
+
+func (s *Service) newToolbox(ctx context.Context, userID uuid.UUID, citations *[]Citation) *toolbox {
+	db := s.DB.WithContext(ctx)
+	var user models.User
+	db.Select("id, unit_system, lab_units").First(&user, "id = ?", userID)
+	return &toolbox{service: s, db: db, userID: userID, prefs: units.PreferencesOf(user), citations: citations}
+}
+
+// run executes tool calls and returns their results as tool messages.
+// Failures are reported to the model, which may retry or answer without.
+func (tb *toolbox) run(ctx context.Context, calls []llm.ToolCall) []llm.Message {
+	messages := make([]llm.Message, len(calls))
+	for i, call := range calls {
+		var result interface{}
+		var err error
+		switch t := findTool(call.Name); {
+		case i >= maxCallsPerTurn:
+			err = fmt.Errorf("too many tool calls at once, at most %d", maxCallsPerTurn)
+		case t == nil:
+			err = fmt.Errorf("unknown tool %q", call.Name)
+		default:
+			result, err = t.run(tb, ctx, call.Arguments)
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("chatbot: tool %s for %s: %v", call.Name, tb.userID, err)
+			}
+			result = map[string]string{"error": err.Error()}
+		}
+		content, _ := json.Marshal(result)
+		messages[i] = llm.Message{Role: llm.RoleTool, Content: string(content), ToolCallID: call.ID, Name: call.Name}
+	}
+	return messages
+}
+
+func findTool(name string) *tool {
+	for i := range chatTools {
+		if chatTools[i].Name == name {
+			return &chatTools[i]
+		}
+	}
+	return nil
+}
+
+// errArguments marks arguments the model should correct
+var errArguments = errors.New("invalid arguments")
+
+func decodeArgs(raw json.RawMessage, v interface{}) error {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		raw = json.RawMessage("{}")
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", errArguments, err)
+	}
+	return nil
+}
+
+// dateRange parses optional YYYY-MM-DD bounds; to is inclusive
+func dateRange(from, to string) (*time.Time, *time.Time, error) {
+	var start, end *time.Time
+	if from != "" {
+		t, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: from must be YYYY-MM-DD", errArguments)
+		}
+		start = &t
+	}
+	if to != "" {
+		t, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: to must be YYYY-MM-DD", errArguments)
+		}
+		t = t.AddDate(0, 0, 1)
+		end = &t
+	}
+	return start, end, nil
+}
+
+func (tb *toolbox) listRecords(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Type  string `json:"type"`
+		From  string `json:"from"`
+		To    string `json:"to"`
+		Limit int    `json:"limit"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	switch args.Type {
+	case "", "any", "lab_report", "measurements", "health_concerns", "triage":
+	default:
+		return nil, fmt.Errorf("%w: type must be any, lab_report, measurements, health_concerns or triage", errArguments)
+	}
+	from, to, err := dateRange(args.From, args.To)
+	if err != nil {
+		return nil, err
+	}
+	if args.Limit < 1 || args.Limit > 25 {
+		args.Limit = 10
+	}
+
+	records, err := tb.allRecords()
+	if err != nil {
+		return nil, err
+	}
+	var selected []toolRecord
+	for _, r := range records {
+		if args.Type != "" && args.Type != "any" && r.Type != args.Type {
+			continue
+		}
+		if (from != nil || to != nil) && r.Date == nil {
+			continue
+		}
+		if (from != nil && r.Date.Before(*from)) || (to != nil && !r.Date.Before(*to)) {
+			continue
+		}
+		selected = append(selected, r)
+	}
+	total := len(selected)
+	if len(selected) > args.Limit {
+		selected = selected[:args.Limit]
+	}
+
+	ids := make([]uuid.UUID, len(selected))
+	for i, r := range selected {
+		ids[i] = r.ID
+	}
+	var observations []models.Observation
+	if len(ids) > 0 {
+		if err := tb.db.Where("user_id = ? AND health_data_id IN ?", tb.userID, ids).
+			Order("name").Find(&observations).Error; err != nil {
+			return nil, err
+		}
+	}
+	labs.Localize(observations, tb.prefs)
+	results := map[uuid.UUID][]string{}
+	for _, obs := range observations {
+		results[obs.HealthDataID] = append(results[obs.HealthDataID], describeObservation(obs))
+	}
+
+	type listed struct {
+		Source  int      `json:"source"`
+		Type    string   `json:"type"`
+		Title   string   `json:"title"`
+		Date    string   `json:"date,omitempty"`
+		Results []string `json:"results,omitempty"`
+		Text    string   `json:"text,omitempty"` // Concerns and records nothing was extracted from
+	}
+	out := make([]listed, len(selected))
+	for i, r := range selected {
+		out[i] = listed{Source: tb.cite(r), Type: r.Type, Title: r.Title, Date: formatDate(r.Date)}
+		if res := results[r.ID]; len(res) > 0 {
+			if len(res) > 15 {
+				res = append(res[:15], fmt.Sprintf("and %d more", len(res)-15))
+			}
+			out[i].Results = res
+		} else {
+			out[i].Text = truncateRunes(strings.Join(strings.Fields(r.Text), " "), 400)
+		}
+	}
+	return map[string]interface{}{"records": out, "total": total}, nil
+}
+
+func (tb *toolbox) latestObservation(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Analyte string `json:"analyte"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	analyte, err := tb.resolve(args.Analyte)
+	if err != nil {
+		return nil, err
+	}
+
+	var latest []models.Observation
+	if err := tb.db.Where("user_id = ? AND code = ?", tb.userID, analyte.Code).
+		Order("effective_at DESC, created_at DESC").Limit(1).Find(&latest).Error; err != nil {
+		return nil, err
+	}
+	if len(latest) == 0 {
+		return map[string]string{"analyte": analyte.Name, "result": "no values on file"}, nil
+	}
+	labs.Localize(latest, tb.prefs)
+	obs := latest[0]
+	out := map[string]interface{}{
+		"analyte": analyte.Name,
+		"value":   formatValue(obs),
+		"unit":    units.Symbol(obs.Unit),
+		"date":    obs.EffectiveAt.Format("2006-01-02"),
+	}
+	if obs.Flag != "" {
+		out["flag"] = obs.Flag
+	}
+	if r := describeRange(obs.RefLow, obs.RefHigh, obs.RefText); r != "" {
+		out["reference_range"] = r
+	}
+	if record, ok := tb.record(obs.HealthDataID); ok {
+		out["source"] = tb.cite(record)
+	}
+	return out, nil
+}
+
+func (tb *toolbox) computeTrend(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Analyte string `json:"analyte"`
+		From    string `json:"from"`
+		To      string `json:"to"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	analyte, err := tb.resolve(args.Analyte)
+	if err != nil {
+		return nil, err
+	}
+	from, to, err := dateRange(args.From, args.To)
+	if err != nil {
+		return nil, err
+	}
+
+	query := tb.db.Where("user_id = ? AND code = ?", tb.userID, analyte.Code)
+	if from != nil {
+		query = query.Where("effective_at >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("effective_at < ?", *to)
+	}
+	var observations []models.Observation
+	if err := query.Order("effective_at").Find(&observations).Error; err != nil {
+		return nil, err
+	}
+	unit := analyte.DisplayUnit(tb.prefs)
+	points := trends.Series(analyte, observations, unit)
+	if len(points) == 0 {
+		return map[string]string{"analyte": analyte.Name, "result": "no values on file"}, nil
+	}
+	stats := trends.Analyze(points)
+
+	type value struct {
+		Date   string  `json:"date"`
+		Value  float64 `json:"value"`
+		Flag   string  `json:"flag,omitempty"`
+		Source int     `json:"source,omitempty"`
+	}
+	describe := func(p trends.Point) value {
+		v := value{Date: p.Time.Format("2006-01-02"), Value: p.Value, Flag: p.Flag}
+		if id, err := uuid.Parse(p.SourceID); err == nil {
+			if record, ok := tb.record(id); ok {
+				v.Source = tb.cite(record)
+			}
+		}
+		return v
+	}
+	// The most recent values, where questions about change usually look
+	recent := points
+	if len(recent) > 12 {
+		recent = recent[len(recent)-12:]
+	}
+	values := make([]value, len(recent))
+	for i, p := range recent {
+		values[i] = describe(p)
+	}
+
+	out := map[string]interface{}{
+		"analyte":        analyte.Name,
+		"unit":           units.Symbol(unit),
+		"count":          stats.Count,
+		"first":          describe(points[0]),
+		"latest":         describe(*stats.Latest),
+		"min":            describe(*stats.Min),
+		"max":            describe(*stats.Max),
+		"mean":           stats.Mean,
+		"direction":      stats.Direction,
+		"slope_per_year": stats.SlopePerYear,
+		"out_of_range":   stats.OutOfRange,
+		"values":         values,
+	}
+	if stats.PercentChange != nil {
+		out["percent_change"] = *stats.PercentChange
+	}
+	if r := describeRange(points[len(points)-1].RefLow, points[len(points)-1].RefHigh, ""); r != "" {
+		out["reference_range"] = r
+	}
+	return out, nil
+}
+
+// medicationKeys name the fields of structured records that list medications
+var medicationKeys = []string{"medications", "medication", "current_medications", "prescriptions", "drugs"}
+
+// medicationLine finds a medication list printed in a report
+var medicationLine = regexp.MustCompile(`(?im)^\s*(?:current\s+)?(?:medications?|meds|prescriptions?|rx)\s*[:\-]\s*(.+)$`)
+
+func (tb *toolbox) listMedications(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	var args struct{}
+	if err := decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	records, err := tb.allRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	type medication struct {
+		Name   string `json:"name"`
+		Date   string `json:"date,omitempty"`
+		Source int    `json:"source"`
+	}
+	var out []medication
+	for _, r := range records {
+		var names []string
+		for _, key := range medicationKeys {
+			names = append(names, medicationNames(r.Data[key])...)
+		}
+		if text, ok := r.Data["extracted_text"].(string); ok {
+			for _, m := range medicationLine.FindAllStringSubmatch(text, -1) {
+				names = append(names, splitList(m[1])...)
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+		source := tb.cite(r)
+		for _, name := range names {
+			out = append(out, medication{Name: name, Date: formatDate(r.Date), Source: source})
+		}
+		if len(out) >= 50 {
+			break
+		}
+	}
+	if len(out) == 0 {
+		return map[string]string{"result": "no medications are written in the user's records"}, nil
+	}
+	return map[string]interface{}{"medications": out}, nil
+}
+
+// medicationNames reads a medication field: a list in a string, a list of
+// strings, or a list of objects such as {"name": ..., "dose": ...}
+func medicationNames(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return splitList(v)
+	case []interface{}:
+		var names []string
+		for _, item := range v {
+			switch item := item.(type) {
+			case string:
+				names = append(names, splitList(item)...)
+			case map[string]interface{}:
+				var parts []string
+				for _, key := range []string{"name", "dose", "dosage", "frequency"} {
+					if s, ok := item[key].(string); ok && strings.TrimSpace(s) != "" {
+						parts = append(parts, strings.TrimSpace(s))
+					}
+				}
+				if len(parts) > 0 {
+					names = append(names, strings.Join(parts, " "))
+				}
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' || r == '\n' }) {
+		if part = strings.TrimSpace(part); part != "" && !strings.EqualFold(part, "none") {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func (tb *toolbox) personalInfo(ctx context.Context, raw json.RawMessage) (interface{}, error) {
+	var args struct{}
+	if err := decodeArgs(raw, &args); err != nil {
+		return nil, err
+	}
+	var user models.User
+	if err := tb.db.Select("id, gender, birth_date, height, weight, ethnicity, country, unit_system, lab_units").
+		First(&user, "id = ?", tb.userID).Error; err != nil {
+		return nil, err
+	}
+
+	out := map[string]interface{}{}
+	if user.Gender != "" {
+		out["gender"] = user.Gender
+	}
+	if user.BirthDate != nil {
+		out["age"] = ageOn(*user.BirthDate, time.Now())
+	}
+	if user.Height > 0 && user.Weight > 0 {
+		value := bmi(user.Height, user.Weight)
+		out["bmi"] = value
+		out["bmi_category"] = bmiCategory(value)
+	}
+	units.LocalizeUser(&user)
+	if user.Height > 0 {
+		out["height"] = fmt.Sprintf("%s %s", strconv.FormatFloat(user.Height, 'f', -1, 64), user.HeightUnit)
+	}
+	if user.Weight > 0 {
+		out["weight"] = fmt.Sprintf("%s %s", strconv.FormatFloat(user.Weight, 'f', -1, 64), user.WeightUnit)
+	}
+	if user.Ethnicity != "" {
+		out["ethnicity"] = user.Ethnicity
+	}
+	if user.Country != "" {
+		out["country"] = user.Country
+	}
+	if len(out) == 0 {
+		return map[string]string{"result": "the profile has no personal details"}, nil
+	}
+	return out, nil
+}
+
+func ageOn(birth, now time.Time) int {
+	age := now.Year() - birth.Year()
+	if now.Month() < birth.Month() || (now.Month() == birth.Month() && now.Day() < birth.Day()) {
+		age--
+	}
+	return age
+}
+
+// bmi computes the body mass index from centimeters and kilograms
+func bmi(height, weight float64) float64 {
+	meters := height / 100
+	return units.Round(weight/(meters*meters), 1)
+}
+
+// bmiCategory uses the WHO adult categories
+func bmiCategory(bmi float64) string {
+	switch {
+	case bmi < 18.5:
+		return "underweight"
+	case bmi < 25:
+		return "normal"
+	case bmi < 30:
+		return "overweight"
+	}
+	return "obese"
+}
+
+// resolve names an analyte, listing the user's tests when it is unknown
+func (tb *toolbox) resolve(name string) (*labs.Analyte, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, fmt.Errorf("%w: analyte is required", errArguments)
+	}
+	if a, ok := labs.Resolve(strings.ToLower(strings.TrimSpace(name))); ok {
+		return a, nil
+	}
+	var known []string
+	tb.db.Model(&models.Observation{}).Where("user_id = ? AND code <> ''", tb.userID).
+		Distinct().Order("name").Limit(40).Pluck("name", &known)
+	if len(known) == 0 {
+		return nil, fmt.Errorf("unknown analyte %q and the user has no test results on file", name)
+	}
+	return nil, fmt.Errorf("unknown analyte %q; the user has results for: %s", name, strings.Join(known, ", "))
+}
+
+// allRecords loads the user's records once per answer, newest first and
+// undated ones last
+func (tb *toolbox) allRecords() ([]toolRecord, error) {
+	if tb.loaded {
+		return tb.records, nil
+	}
+	var stored []models.HealthData
+	if err := tb.db.Where("user_id = ?", tb.userID).Find(&stored).Error; err != nil {
+		return nil, err
+	}
+	var dated []struct {
+		HealthDataID uuid.UUID
+		EffectiveAt  time.Time
+	}
+	if err := tb.db.Model(&models.Observation{}).
+		Select("health_data_id, MIN(effective_at) AS effective_at").
+		Where("user_id = ?", tb.userID).Group("health_data_id").Scan(&dated).Error; err != nil {
+		return nil, err
+	}
+	dates := map[uuid.UUID]time.Time{}
+	for _, d := range dated {
+		dates[d.HealthDataID] = d.EffectiveAt
+	}
+
+	for _, hd := range stored {
+		var data map[string]interface{}
+		if err := json.Unmarshal(hd.Data, &data); err != nil {
+			continue
+		}
+		kind, _, text := rag.RecordText(data)
+		r := toolRecord{ID: hd.ID, Kind: kind, Text: text, Data: data, Type: "measurements", Title: "Health record"}
+		if name, ok := data["file_name"].(string); ok && name != "" && name != "Unknown" {
+			r.Title = name
+		}
+		switch {
+		case kind == rag.KindHealthConcern:
+			r.Type, r.Title = "health_concerns", "Health concerns"
+		case data["type"] == "triage":
+			r.Type, r.Title = "triage", "Symptom triage"
+		case data["extracted_text"] != nil:
+			r.Type = "lab_report"
+		}
+		if t, ok := dates[hd.ID]; ok {
+			r.Date = &t
+		} else if t, ok := recordDate(data, text); ok {
+			r.Date = &t
+		}
+		tb.records = append(tb.records, r)
+	}
+	sort.SliceStable(tb.records, func(i, j int) bool {
+		a, b := tb.records[i].Date, tb.records[j].Date
+		return a != nil && (b == nil || a.After(*b))
+	})
+	tb.loaded = true
+	return tb.records, nil
+}
+
+// recordDate dates a record without observations by a date field or a date
+// printed in its text
+func recordDate(data map[string]interface{}, text string) (time.Time, bool) {
+	for _, key := range []string{"date", "start_date", "recorded_at"} {
+		if s, ok := data[key].(string); ok {
+			if t, err := time.Parse("2006-01-02", s); err == nil {
+				return t, true
+			}
+		}
+	}
+	return labs.ParseDate(text)
+}
+
+func (tb *toolbox) record(id uuid.UUID) (toolRecord, bool) {
+	records, err := tb.allRecords()
+	if err != nil {
+		return toolRecord{}, false
+	}
+	for _, r := range records {
+		if r.ID == id {
+			return r, true
+		}
+	}
+	return toolRecord{}, false
+}
+
+// cite returns the citation number of a record, adding it as a source when
+// retrieval did not already
+func (tb *toolbox) cite(r toolRecord) int {
+	id := r.ID.String()
+	for _, c := range *tb.citations {
+		if c.RecordID == id {
+			return c.Number
+		}
+	}
+	n := len(*tb.citations) + 1
+	*tb.citations = append(*tb.citations, Citation{
+		Number:     n,
+		ID:         id,
+		Kind:       r.Kind,
+		Title:      r.Title,
+		Snippet:    snippet(r.Text),
+		RecordID:   id,
+		Link:       "/api/healthdata/" + id,
+		RecordedAt: r.Date,
+	})
+	tb.service.linkImages(tb.userID, (*tb.citations)[n-1:])
+	return n
+}
+
+func describeObservation(obs models.Observation) string {
+	s := fmt.Sprintf("%s %s%s %s", obs.Name, obs.Comparator, formatValue(obs), units.Symbol(obs.Unit))
+	if obs.Flag != "" {
+		s += " (" + obs.Flag + ")"
+	}
+	return strings.TrimSpace(s)
+}
+
+func formatValue(obs models.Observation) string {
+	return strconv.FormatFloat(obs.Value, 'f', -1, 64)
+}
+
+func describeRange(low, high *float64, text string) string {
+	format := func(v float64) string { return strconv.FormatFloat(units.Round(v, 3), 'f', -1, 64) }
+	switch {
+	case low != nil && high != nil:
+		return format(*low) + "-" + format(*high)
+	case high != nil:
+		return "<" + format(*high)
+	case low != nil:
+		return ">" + format(*low)
+	}
+	return text
+}
+
+func formatDate(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
+
+func truncateRunes(s string, max int) string {
+	if r := []rune(s); len(r) > max {
+		return string(r[:max]) + "…"
+	}
+	return s
+}
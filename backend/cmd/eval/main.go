@@ -0,0 +1,117 @@
+// Command eval runs a suite of questions through the chatbot pipeline on
+// behalf of synthetic patients, grades the answers and compares the run with
+// an earlier one, so prompt and retriever changes can be checked before they
+// ship.
+//
+//	go run ./cmd/eval -suite eval/suites/basic.yaml -out base.json
+//	go run ./cmd/eval -suite eval/suites/basic.yaml -baseline base.json -label new-prompt
+//	LLM_JUDGE_MODEL=llama3.1 go run ./cmd/eval -graders keyword,citations,safety,judge
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"backend/chatbot"
+	"backend/config"
+	"backend/eval"
+	"backend/llm"
+	"backend/rag"
+)
+
+func main() {
+	suitePath := flag.String("suite", "eval/suites/basic.yaml", "YAML suite to run")
+	out := flag.String("out", "", "write the run as JSON to this file, for use as a later -baseline")
+	baselinePath := flag.String("baseline", "", "compare with a run written by -out")
+	report := flag.String("report", "", "write the Markdown report to this file instead of stdout")
+	label := flag.String("label", "", "name of this run in reports")
+	graders := flag.String("graders", "keyword,citations,safety", "graders to apply: keyword, citations, safety, judge")
+	keep := flag.Bool("keep", false, "leave the synthetic patients and their conversations in the database")
+	timeout := flag.Duration("timeout", 2*time.Minute, "time allowed per question")
+	failOnRegression := flag.Bool("fail-on-regression", false, "exit with status 1 when a case regressed against the baseline")
+	flag.Parse()
+
+	suite, err := eval.LoadSuite(*suitePath)
+	if err != nil {
+		log.Fatal("Failed to load suite: ", err)
+	}
+	var baseline *eval.Report
+	if *baselinePath != "" {
+		if baseline, err = eval.LoadReport(*baselinePath); err != nil {
+			log.Fatal("Failed to load baseline: ", err)
+		}
+	}
+
+	// The judge is configured like any other feature, LLM_JUDGE_* falling
+	// back to LLM_*
+	var judge llm.Generator
+	names := strings.Split(*graders, ",")
+	for _, name := range names {
+		if strings.TrimSpace(name) == "judge" {
+			if judge, err = llm.FromEnv("judge"); err != nil {
+				log.Fatal("Failed to configure judge: ", err)
+			}
+		}
+	}
+	selected, err := eval.Graders(names, judge)
+	if err != nil {
+		log.Fatal("Failed to configure graders: ", err)
+	}
+
+	db := config.InitialMigration()
+	service := chatbot.NewService(db)
+	// Every run measures fresh answers and retrievals, so no cache layer
+	// may serve results from an earlier run
+	service.Cache = nil
+	service.Records.Cache = nil
+	if cached, ok := service.Retriever.(*rag.CachedRetriever); ok {
+		service.Retriever = cached.Retriever
+	}
+	service.Usage = nil // Evaluation users are not held to budgets; their metered usage is removed with them
+	runner := &eval.Runner{
+		DB:      db,
+		Service: service,
+		Graders: selected,
+		Timeout: *timeout,
+		Keep:    *keep,
+	}
+	run, err := runner.Run(context.Background(), suite, *label)
+	if err != nil {
+		log.Fatal("Evaluation failed: ", err)
+	}
+
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatal("Failed to write run: ", err)
+		}
+		if err := run.WriteJSON(f); err != nil {
+			log.Fatal("Failed to write run: ", err)
+		}
+		f.Close()
+	}
+
+	var comparison *eval.Comparison
+	if baseline != nil {
+		comparison = eval.Compare(baseline, run)
+	}
+	w := os.Stdout
+	if *report != "" {
+		if w, err = os.Create(*report); err != nil {
+			log.Fatal("Failed to write report: ", err)
+		}
+		defer w.Close()
+	}
+	eval.WriteMarkdown(w, run, comparison)
+
+	log.Printf("%d of %d cases passed", run.Summary.Passed, run.Summary.Cases)
+	if *failOnRegression && comparison != nil && len(comparison.Regressions) > 0 {
+		log.Printf("%d cases regressed", len(comparison.Regressions))
+		w.Close()
+		os.Exit(1)
+	}
+}
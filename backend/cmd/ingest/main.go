@@ -0,0 +1,89 @@
+// Command ingest chunks and embeds reference documents into the knowledge
+// base used by the chatbot, and can backfill the index of users' records.
+//
+//	go run ./cmd/ingest -dir ../galerag/Data
+//	EMBEDDING_URL=http://localhost:8082 go run ./cmd/ingest -replace guide.pdf
+//	go run ./cmd/ingest -records
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"backend/config"
+	"backend/rag"
+	"backend/usage"
+)
+
+func main() {
+	dir := flag.String("dir", "", "ingest every .pdf, .txt and .md file in this directory")
+	size := flag.Int("size", 500, "chunk size in bytes")
+	overlap := flag.Int("overlap", 20, "bytes repeated between neighbouring chunks")
+	batch := flag.Int("batch", 32, "chunks per embedding request")
+	replace := flag.Bool("replace", false, "remove earlier chunks of each document first")
+	records := flag.Bool("records", false, "index users' health records that have no chunks yet")
+	flag.Parse()
+
+	files := flag.Args()
+	if *dir != "" {
+		entries, err := os.ReadDir(*dir)
+		if err != nil {
+			log.Fatal("Failed to read directory: ", err)
+		}
+		for _, e := range entries {
+			switch strings.ToLower(filepath.Ext(e.Name())) {
+			case ".pdf", ".txt", ".md":
+				if !e.IsDir() {
+					files = append(files, filepath.Join(*dir, e.Name()))
+				}
+			}
+		}
+	}
+	if len(files) == 0 && !*records {
+		log.Fatal("No documents given; pass files, -dir or -records")
+	}
+
+	embedder, err := rag.EmbedderFromEnv()
+	if err != nil {
+		log.Fatal("Failed to configure embedder: ", err)
+	}
+
+	db := config.InitialMigration()
+	embedder = rag.MeterEmbedder(embedder, usage.FromEnv(db))
+	ingester := rag.NewIngester(db, embedder)
+	ingester.Size, ingester.Overlap, ingester.Batch = *size, *overlap, *batch
+
+	ctx := context.Background()
+	failed := false
+	for _, path := range files {
+		text, err := rag.ReadDocument(path)
+		if err != nil {
+			log.Printf("Skipping %s: %v", path, err)
+			failed = true
+			continue
+		}
+		added, err := ingester.Ingest(ctx, filepath.Base(path), text, *replace)
+		if err != nil {
+			log.Printf("Failed to ingest %s after %d chunks: %v", path, added, err)
+			failed = true
+			continue
+		}
+		log.Printf("Ingested %s: %d new chunks", path, added)
+	}
+
+	if *records {
+		if err := rag.NewRecordIndex(db, embedder).IndexAll(ctx); err != nil {
+			log.Printf("Failed to index health records: %v", err)
+			failed = true
+		} else {
+			log.Println("Indexed health records")
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,95 @@
+// Command migrateblobs moves the bytes of user images still kept in the
+// database into the blob store selected by BLOB_STORE, leaving only the
+// metadata and the object key in user_images. It can be rerun safely: each
+// image is copied before its row is updated, and only rows without a key
+// are picked up.
+//
+//	go run ./cmd/migrateblobs -dry-run
+//	BLOB_STORE=s3 S3_ENDPOINT=http://localhost:9000 S3_BUCKET=medibuddy go run ./cmd/migrateblobs
+//	go run ./cmd/migrateblobs -vacuum
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"backend/config"
+	"backend/models"
+	"backend/storage"
+
+	"gorm.io/gorm"
+)
+
+func main() {
+	batch := flag.Int("batch", 50, "images loaded per query")
+	dryRun := flag.Bool("dry-run", false, "count the images to move without moving them")
+	vacuum := flag.Bool("vacuum", false, "return the freed table space to the system afterwards (locks user_images)")
+	flag.Parse()
+
+	blobs, err := storage.FromEnv()
+	if err != nil {
+		log.Fatal("Failed to configure blob store: ", err)
+	}
+	db := config.InitialMigration()
+
+	pending := db.Model(&models.UserImage{}).
+		Where("(blob_key IS NULL OR blob_key = '') AND image_data IS NOT NULL")
+	var count int64
+	if err := pending.Session(&gorm.Session{}).Count(&count).Error; err != nil {
+		log.Fatal("Failed to count images: ", err)
+	}
+	log.Printf("%d images to move to %s", count, blobs.Name())
+	if *dryRun || count == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	moved, failed := 0, map[string]bool{}
+	for {
+		var images []models.UserImage
+		query := pending.Session(&gorm.Session{}).Order("id").Limit(*batch)
+		if len(failed) > 0 {
+			ids := make([]string, 0, len(failed))
+			for id := range failed {
+				ids = append(ids, id)
+			}
+			query = query.Where("id NOT IN ?", ids)
+		}
+		if err := query.Find(&images).Error; err != nil {
+			log.Fatal("Failed to load images: ", err)
+		}
+		if len(images) == 0 {
+			break
+		}
+		for _, img := range images {
+			key := models.ImageBlobKey(img.UserID, img.ID)
+			if err := blobs.Put(ctx, key, img.ImageData, img.ImageType); err != nil {
+				log.Printf("Failed to store image %s: %v", img.ID, err)
+				failed[img.ID] = true
+				continue
+			}
+			if err := db.Model(&models.UserImage{}).
+				Where("id = ? AND (blob_key IS NULL OR blob_key = '')", img.ID).
+				Updates(map[string]interface{}{"blob_key": key, "image_data": nil}).Error; err != nil {
+				log.Printf("Failed to update image %s: %v", img.ID, err)
+				failed[img.ID] = true
+				continue
+			}
+			moved++
+		}
+		log.Printf("Moved %d of %d images", moved, count)
+	}
+
+	if len(failed) > 0 {
+		log.Printf("%d images could not be moved and keep their bytes in the database", len(failed))
+		os.Exit(1)
+	}
+	if *vacuum {
+		if err := db.Exec("VACUUM FULL user_images").Error; err != nil {
+			log.Fatal("Failed to vacuum user_images: ", err)
+		}
+		log.Println("Vacuumed user_images")
+	}
+}
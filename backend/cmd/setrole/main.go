@@ -0,0 +1,40 @@
+// Command setrole gives a registered user a role. Roles are otherwise only
+// granted by an admin through PUT /api/admin/users/{id}/role, so this is how
+// a new deployment gets its first admin.
+//
+//	go run ./cmd/setrole -email admin@example.com
+//	go run ./cmd/setrole -email doctor@example.com -role clinician
+package main
+
+import (
+	"flag"
+	"log"
+
+	"backend/config"
+	"backend/models"
+)
+
+func main() {
+	email := flag.String("email", "", "account email of the user")
+	role := flag.String("role", models.RoleAdmin, "patient, clinician or admin")
+	flag.Parse()
+
+	if *email == "" {
+		log.Fatal("No user given; pass -email")
+	}
+	switch *role {
+	case models.RolePatient, models.RoleClinician, models.RoleAdmin:
+	default:
+		log.Fatalf("Invalid role %q, expected patient, clinician or admin", *role)
+	}
+
+	db := config.InitialMigration()
+	result := db.Model(&models.User{}).Where("LOWER(email) = LOWER(?)", *email).Update("role", *role)
+	if result.Error != nil {
+		log.Fatal("Failed to update role: ", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		log.Fatalf("No user with email %s; register the account first", *email)
+	}
+	log.Printf("%s is now %s", *email, *role)
+}
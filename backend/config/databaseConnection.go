@@ -21,12 +21,23 @@ func InitialMigration() *gorm.DB {
 		log.Fatal("Failed to connect to database: ", err)
 	}
 
+	// pgvector backs the knowledge base embeddings
+	if err := DB.Exec("CREATE EXTENSION IF NOT EXISTS vector").Error; err != nil {
+		log.Fatal("Failed to enable pgvector: ", err)
+	}
+
 	// Migrate the User and HealthData models
-	err = DB.AutoMigrate(&models.User{}, &models.HealthData{}, &models.UserImage{})
+	err = DB.AutoMigrate(&models.User{}, &models.HealthData{}, &models.UserImage{}, &models.Observation{},
+		&models.AlertRule{}, &models.Notification{}, &models.CareRelationship{}, &models.Conversation{}, &models.Message{},
+		&models.KnowledgeChunk{}, &models.RecordChunk{}, &models.SafetyEvent{}, &models.Feedback{}, &models.PromptTemplate{},
+		&models.CacheEntry{}, &models.DataVersion{}, &models.TriageSession{}, &models.UsageEvent{}, &models.UsageDay{},
+		&models.UsageBudget{})
 	if err != nil {
 		log.Fatal("Failed to migrate database: ", err)
 	}
 
+	createSearchIndexes(DB)
+
 	sqlDB, err := DB.DB()
 	if err != nil {
 		log.Fatal("Failed to get database instance: ", err)
@@ -43,3 +54,27 @@ func InitialMigration() *gorm.DB {
 func GetDB() *gorm.DB {
 	return DB
 }
+
+// createSearchIndexes adds the GIN indexes backing /api/search and the
+// indexes used by knowledge base retrieval
+func createSearchIndexes(db *gorm.DB) {
+	statements := []string{
+		`CREATE INDEX IF NOT EXISTS idx_health_data_fts ON health_data
+			USING GIN (jsonb_to_tsvector('english', data, '["string"]'))`,
+		`CREATE INDEX IF NOT EXISTS idx_user_images_fts ON user_images
+			USING GIN (to_tsvector('simple', regexp_replace(COALESCE(image_name, ''), '[._-]+', ' ', 'g')))`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_fts ON messages
+			USING GIN (to_tsvector('english', content))`,
+		`CREATE INDEX IF NOT EXISTS idx_knowledge_chunks_fts ON knowledge_chunks
+			USING GIN (to_tsvector('english', content))`,
+		`CREATE INDEX IF NOT EXISTS idx_knowledge_chunks_embedding ON knowledge_chunks
+			USING hnsw (embedding vector_cosine_ops)`,
+		`CREATE INDEX IF NOT EXISTS idx_record_chunks_fts ON record_chunks
+			USING GIN (to_tsvector('english', content))`,
+	}
+	for _, stmt := range statements {
+		if err := db.Exec(stmt).Error; err != nil {
+			log.Println("Failed to create search index: ", err)
+		}
+	}
+}
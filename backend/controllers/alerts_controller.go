@@ -0,0 +1,444 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"backend/alerts"
+	"backend/labs"
+	"backend/models"
+	"backend/utils"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type AlertsController struct {
+	DB *gorm.DB
+}
+
+func NewAlertsController(db *gorm.DB) *AlertsController {
+	return &AlertsController{DB: db}
+}
+
+type alertRuleInput struct {
+	UserID         string   `json:"user_id"` // Patient, when a clinician writes the rule
+	Analyte        string   `json:"analyte"` // LOINC code or test name
+	Comparator     string   `json:"comparator"`
+	Threshold      *float64 `json:"threshold"`
+	Unit           string   `json:"unit"` // Unit of threshold, defaults to the analyte's unit
+	WindowHours    int      `json:"window_hours"`
+	MinOccurrences int      `json:"min_occurrences"`
+	Channels       []string `json:"channels"`
+	Email          string   `json:"email"`
+	WebhookURL     string   `json:"webhook_url"`
+	Active         *bool    `json:"active"`
+}
+
+// GetRules lists rules on the user's data and rules the user wrote for patients
+func (ac *AlertsController) GetRules(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	var rules []models.AlertRule
+	if err := ac.DB.Where("user_id = ? OR created_by = ?", userID, userID).
+		Order("created_at DESC").Find(&rules).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving alert rules")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, rules)
+}
+
+// CreateRule adds an alert rule for the user, or for a patient of a clinician
+func (ac *AlertsController) CreateRule(w http.ResponseWriter, r *http.Request) {
+	author, err := uuid.Parse(r.Context().Value("user_id").(string))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid user ID format")
+		return
+	}
+
+	var input alertRuleInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	rule := models.AlertRule{
+		ID:        uuid.New(),
+		UserID:    author,
+		CreatedBy: author,
+		Source:    "user",
+		Active:    true,
+	}
+
+	if input.UserID != "" && input.UserID != author.String() {
+		patient, err := uuid.Parse(input.UserID)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid user_id format")
+			return
+		}
+		if !ac.isClinicianOf(author, patient) {
+			utils.RespondWithError(w, http.StatusForbidden, "Only a clinician on the patient's care team can add rules for them")
+			return
+		}
+		rule.UserID = patient
+		rule.Source = "clinician"
+	}
+
+	if msg := applyRuleInput(&rule, input, ac.accountEmails(&rule)); msg != "" {
+		utils.RespondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	if err := ac.DB.Create(&rule).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error creating alert rule")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, rule)
+}
+
+// UpdateRule changes a rule. Patients may only pause or resume rules a
+// clinician wrote for them.
+func (ac *AlertsController) UpdateRule(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	rule, ok := ac.findRule(w, r, userID)
+	if !ok {
+		return
+	}
+
+	var input alertRuleInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if rule.CreatedBy.String() == userID {
+		// Unset fields keep their current values
+		if input.Analyte == "" {
+			input.Analyte = rule.Code
+		}
+		if input.Comparator == "" {
+			input.Comparator = rule.Comparator
+		}
+		if input.Threshold == nil {
+			input.Threshold, input.Unit = rule.Threshold, rule.Unit
+		}
+		if input.WindowHours == 0 && input.MinOccurrences == 0 {
+			input.WindowHours, input.MinOccurrences = rule.WindowHours, rule.MinOccurrences
+		}
+		if len(input.Channels) == 0 {
+			input.Channels = splitChannels(rule.Channels)
+		}
+		if input.Email == "" {
+			input.Email = rule.Email
+		}
+		if input.WebhookURL == "" {
+			input.WebhookURL = rule.WebhookURL
+		}
+		if msg := applyRuleInput(rule, input, ac.accountEmails(rule)); msg != "" {
+			utils.RespondWithError(w, http.StatusBadRequest, msg)
+			return
+		}
+	}
+	if input.Active != nil {
+		rule.Active = *input.Active
+	}
+
+	if err := ac.DB.Save(rule).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error updating alert rule")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, rule)
+}
+
+// DeleteRule removes a rule; both the author and the patient may do so
+func (ac *AlertsController) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	rule, ok := ac.findRule(w, r, userID)
+	if !ok {
+		return
+	}
+
+	if err := ac.DB.Delete(rule).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error deleting alert rule")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Alert rule deleted"})
+}
+
+// GetNotifications lists the user's in-app notifications, newest first
+func (ac *AlertsController) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	query := ac.DB.Where("user_id = ? AND channel = ?", userID, alerts.ChannelInApp)
+	if r.URL.Query().Get("unread") == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var notifications []models.Notification
+	if err := query.Order("created_at DESC").Limit(100).Find(&notifications).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving notifications")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, notifications)
+}
+
+// MarkNotificationRead marks one notification as read
+func (ac *AlertsController) MarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	notificationID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid notification ID format")
+		return
+	}
+
+	result := ac.DB.Model(&models.Notification{}).
+		Where("id = ? AND user_id = ? AND read_at IS NULL", notificationID, userID).
+		Update("read_at", time.Now())
+	if result.Error != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error updating notification")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]int64{"updated": result.RowsAffected})
+}
+
+// MarkAllNotificationsRead marks every unread notification as read
+func (ac *AlertsController) MarkAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	result := ac.DB.Model(&models.Notification{}).
+		Where("user_id = ? AND channel = ? AND read_at IS NULL", userID, alerts.ChannelInApp).
+		Update("read_at", time.Now())
+	if result.Error != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error updating notifications")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]int64{"updated": result.RowsAffected})
+}
+
+// GetCareTeam lists the user's clinicians, or a clinician's patients
+func (ac *AlertsController) GetCareTeam(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	var clinicians, patients []models.User
+	if err := ac.DB.Select("id, name, email, role").
+		Where("id IN (?)", ac.DB.Model(&models.CareRelationship{}).Select("clinician_id").Where("patient_id = ?", userID)).
+		Find(&clinicians).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving care team")
+		return
+	}
+	if err := ac.DB.Select("id, name, email, role").
+		Where("id IN (?)", ac.DB.Model(&models.CareRelationship{}).Select("patient_id").Where("clinician_id = ?", userID)).
+		Find(&patients).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving care team")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"clinicians": clinicians,
+		"patients":   patients,
+	})
+}
+
+// AddClinician lets a patient grant a clinician access to their alerts
+func (ac *AlertsController) AddClinician(w http.ResponseWriter, r *http.Request) {
+	patientID, err := uuid.Parse(r.Context().Value("user_id").(string))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid user ID format")
+		return
+	}
+
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Email == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	var clinician models.User
+	if err := ac.DB.Where("email = ? AND role = ?", input.Email, models.RoleClinician).First(&clinician).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Clinician not found")
+		return
+	}
+
+	relationship := models.CareRelationship{
+		PatientID:   patientID,
+		ClinicianID: uuid.MustParse(clinician.ID),
+	}
+	if err := ac.DB.FirstOrCreate(&relationship, relationship).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error adding clinician")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, relationship)
+}
+
+// RemoveClinician revokes a clinician's access and the rules they wrote
+func (ac *AlertsController) RemoveClinician(w http.ResponseWriter, r *http.Request) {
+	patientID := r.Context().Value("user_id").(string)
+	clinicianID := mux.Vars(r)["id"]
+	if _, err := uuid.Parse(clinicianID); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid clinician ID format")
+		return
+	}
+
+	err := ac.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("patient_id = ? AND clinician_id = ?", patientID, clinicianID).
+			Delete(&models.CareRelationship{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ? AND created_by = ?", patientID, clinicianID).
+			Delete(&models.AlertRule{}).Error
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error removing clinician")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Clinician removed"})
+}
+
+// isClinicianOf reports whether userID is a clinician on the patient's care team
+func (ac *AlertsController) isClinicianOf(userID, patientID uuid.UUID) bool {
+	var count int64
+	ac.DB.Model(&models.CareRelationship{}).
+		Joins("JOIN users ON users.id = care_relationships.clinician_id").
+		Where("care_relationships.patient_id = ? AND care_relationships.clinician_id = ? AND users.role = ?",
+			patientID, userID, models.RoleClinician).
+		Count(&count)
+	return count > 0
+}
+
+// findRule loads the rule named in the URL if the user wrote it or is its patient
+func (ac *AlertsController) findRule(w http.ResponseWriter, r *http.Request, userID string) (*models.AlertRule, bool) {
+	ruleID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid rule ID format")
+		return nil, false
+	}
+
+	var rule models.AlertRule
+	if err := ac.DB.Where("id = ? AND (user_id = ? OR created_by = ?)", ruleID, userID, userID).
+		First(&rule).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.RespondWithError(w, http.StatusNotFound, "Alert rule not found")
+		} else {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving alert rule")
+		}
+		return nil, false
+	}
+	return &rule, true
+}
+
+// accountEmails returns the account addresses of a rule's patient and author
+func (ac *AlertsController) accountEmails(rule *models.AlertRule) []string {
+	var emails []string
+	ac.DB.Model(&models.User{}).Where("id IN ?", []uuid.UUID{rule.UserID, rule.CreatedBy}).Pluck("email", &emails)
+	return emails
+}
+
+// applyRuleInput validates input into rule, returning a message on failure.
+// ownEmails are the account addresses of the patient and the author.
+func applyRuleInput(rule *models.AlertRule, input alertRuleInput, ownEmails []string) string {
+	analyte, ok := labs.Resolve(input.Analyte)
+	if !ok {
+		return "Unknown analyte"
+	}
+	comparator, ok := alerts.NormalizeComparator(input.Comparator)
+	if !ok {
+		return "Invalid comparator, expected gt, gte, lt, lte, eq, outside_range or abnormal"
+	}
+
+	rule.Code = analyte.Code
+	rule.Comparator = comparator
+	rule.Threshold = nil
+	rule.Unit = analyte.Unit
+
+	if alerts.NeedsThreshold(comparator) {
+		if input.Threshold == nil {
+			return "A threshold is required for this comparator"
+		}
+		threshold := *input.Threshold
+		if input.Unit != "" {
+			// Store thresholds in the unit observations are stored in
+			v, err := analyte.Convert(threshold, input.Unit, analyte.Unit)
+			if err != nil {
+				return "Threshold unit is not compatible with the analyte"
+			}
+			threshold = v
+		}
+		rule.Threshold = &threshold
+	}
+
+	if input.WindowHours < 0 || input.WindowHours > 24*365 {
+		return "window_hours must be between 0 and 8760"
+	}
+	if input.MinOccurrences < 0 || input.MinOccurrences > 100 {
+		return "min_occurrences must be between 0 and 100"
+	}
+	rule.WindowHours = input.WindowHours
+	rule.MinOccurrences = input.MinOccurrences
+	if rule.MinOccurrences == 0 {
+		rule.MinOccurrences = 1
+	}
+
+	channels, err := alerts.ParseChannels(input.Channels)
+	if err != nil {
+		return "Invalid channels, expected in_app, email or webhook"
+	}
+	rule.Channels = channels
+
+	// Alerts carry health data, so they are only emailed to the patient's or
+	// the author's own account address
+	rule.Email = ""
+	if input.Email != "" {
+		addr, err := mail.ParseAddress(input.Email)
+		if err != nil {
+			return "Invalid email"
+		}
+		allowed := false
+		for _, own := range ownEmails {
+			allowed = allowed || strings.EqualFold(addr.Address, own)
+		}
+		if !allowed {
+			return "email must be the account address of the patient or the rule's author"
+		}
+		rule.Email = addr.Address
+	}
+
+	rule.WebhookURL = ""
+	if input.WebhookURL != "" {
+		target, err := alerts.ValidateWebhookURL(input.WebhookURL)
+		if err != nil {
+			return "Invalid webhook_url, expected an https URL on a public host"
+		}
+		rule.WebhookURL = target
+	}
+	for _, c := range splitChannels(channels) {
+		if c == alerts.ChannelWebhook && rule.WebhookURL == "" {
+			return "webhook_url is required for the webhook channel"
+		}
+	}
+	return ""
+}
+
+func splitChannels(channels string) []string {
+	if channels == "" {
+		return nil
+	}
+	return strings.Split(channels, ",")
+}
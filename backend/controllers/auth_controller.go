@@ -5,9 +5,12 @@ import (
 	"net/http"
 	"time"
 
+	"backend/lang"
 	"backend/models"
+	"backend/units"
 	"backend/utils"
 
+	"github.com/gorilla/mux"
 	"gorm.io/gorm"
 )
 
@@ -54,6 +57,8 @@ func (ac *AuthController) SignUp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	units.LocalizeUser(&user)
+
 	utils.RespondWithJSON(w, http.StatusCreated, map[string]interface{}{
 		"user":  user,
 		"token": token,
@@ -84,6 +89,8 @@ func (ac *AuthController) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	units.LocalizeUser(&user)
+
 	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
 		"user":  user,
 		"token": token,
@@ -113,6 +120,8 @@ func (ac *AuthController) GetProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	units.LocalizeUser(&user)
+
 	utils.RespondWithJSON(w, http.StatusOK, user)
 }
 
@@ -138,19 +147,67 @@ func (ac *AuthController) UpdateProfile(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	units.LocalizeUser(&user)
+
 	utils.RespondWithJSON(w, http.StatusOK, user)
 }
 
+// UpdatePreferences changes how measurements are displayed to the user
+func (ac *AuthController) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	var input units.Preferences
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if input.System != "" && !units.ValidSystem(input.System) {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid unitSystem, expected metric or imperial")
+		return
+	}
+	if input.LabUnits != "" && !units.ValidLabUnits(input.LabUnits) {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid labUnits, expected conventional or si")
+		return
+	}
+
+	var user models.User
+	if err := ac.DB.First(&user, "id = ?", userID).Error; err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if input.System != "" {
+		user.UnitSystem = input.System
+	}
+	if input.LabUnits != "" {
+		user.LabUnits = input.LabUnits
+	}
+
+	if err := ac.DB.Model(&user).Updates(map[string]interface{}{
+		"unit_system": user.UnitSystem,
+		"lab_units":   user.LabUnits,
+	}).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error updating preferences")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, units.PreferencesOf(user))
+}
+
 func (ac *AuthController) UpdatePersonalInfo(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(string)
 
 	var input struct {
-		Gender    string `json:"gender"`
-		BirthDate string `json:"birthDate"`
-		Height    int    `json:"height"`
-		Weight    int    `json:"weight"`
-		Ethnicity string `json:"ethnicity"`
-		Country   string `json:"country"`
+		Gender     string  `json:"gender"`
+		BirthDate  string  `json:"birthDate"`
+		Height     float64 `json:"height"`
+		HeightUnit string  `json:"heightUnit"` // Defaults to cm or in, per the user's unit system
+		Weight     float64 `json:"weight"`
+		WeightUnit string  `json:"weightUnit"` // Defaults to kg or lb, per the user's unit system
+		Ethnicity  string  `json:"ethnicity"`
+		Country    string  `json:"country"`
+		UnitSystem string  `json:"unitSystem"`
+		Language   string  `json:"language"` // BCP 47 tag, e.g. es or pt-BR
 	}
 
 	// Decode request body
@@ -166,13 +223,41 @@ func (ac *AuthController) UpdatePersonalInfo(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if input.UnitSystem != "" {
+		if !units.ValidSystem(input.UnitSystem) {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid unitSystem, expected metric or imperial")
+			return
+		}
+		user.UnitSystem = input.UnitSystem
+	}
+	if input.Language != "" {
+		tag, err := lang.Parse(input.Language)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid language, expected a tag such as en, es or pt-BR")
+			return
+		}
+		user.Language = tag
+	}
+
+	// Store height and weight in centimeters and kilograms
+	height, err := units.ToCentimeters(input.Height, input.HeightUnit, user.UnitSystem)
+	if err != nil || height < 0 || height > 300 {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid height or heightUnit")
+		return
+	}
+	weight, err := units.ToKilograms(input.Weight, input.WeightUnit, user.UnitSystem)
+	if err != nil || weight < 0 || weight > 700 {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid weight or weightUnit")
+		return
+	}
+
 	// Start database transaction
 	tx := ac.DB.Begin()
 
 	// Update user's personal information
 	user.Gender = input.Gender
-	user.Height = input.Height
-	user.Weight = input.Weight
+	user.Height = units.Round(height, 2)
+	user.Weight = units.Round(weight, 2)
 	user.Ethnicity = input.Ethnicity
 	user.Country = input.Country
 
@@ -198,9 +283,40 @@ func (ac *AuthController) UpdatePersonalInfo(w http.ResponseWriter, r *http.Requ
 
 	tx.Commit() // Commit transaction if everything is successful
 
+	units.LocalizeUser(&user)
+
 	// Send success response
 	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
 		"message": "Personal information updated successfully",
 		"user":    user,
 	})
 }
+
+// UpdateUserRole lets an admin make a user a patient, clinician or admin
+func (ac *AuthController) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	switch input.Role {
+	case models.RolePatient, models.RoleClinician, models.RoleAdmin:
+	default:
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid role")
+		return
+	}
+
+	result := ac.DB.Model(&models.User{}).Where("id = ?", mux.Vars(r)["id"]).Update("role", input.Role)
+	if result.Error != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error updating role")
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Role updated"})
+}
@@ -3,108 +3,451 @@ package controllers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"io/ioutil"
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
+	"backend/chatbot"
+	"backend/lang"
 	"backend/models"
+	"backend/transcript"
+	"backend/upstream"
+	"backend/usage"
 	"backend/utils"
 
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 	"gorm.io/gorm"
 )
 
 type ChatbotController struct {
-	DB *gorm.DB
+	DB   *gorm.DB
+	Chat *chatbot.Service
 }
 
 func NewChatbotController(db *gorm.DB) *ChatbotController {
-	return &ChatbotController{DB: db}
+	return &ChatbotController{DB: db, Chat: chatbot.NewService(db)}
 }
 
+// AskChatbot answers a question, continuing conversation_id when given and
+// starting a new conversation otherwise
 func (cc *ChatbotController) AskChatbot(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("user_id").(string)
+	req, ok := decodeChatRequest(w, r)
 	if !ok {
+		return
+	}
+	cc.ask(w, r, req)
+}
+
+// StreamChatbot answers like AskChatbot but relays the answer as server-sent
+// events: retrieval-started, sources, token (repeated), then done or error.
+// Closing the connection cancels generation; the partial answer is kept.
+func (cc *ChatbotController) StreamChatbot(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeChatRequest(w, r)
+	if !ok {
+		return
+	}
+	if req.Question == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Question is required")
+		return
+	}
+	if req.ConversationID != nil {
+		// Fail before the stream starts so the client gets a plain 404
+		if _, err := cc.Chat.Conversation(req.UserID, *req.ConversationID); err != nil {
+			status, message := chatError(err)
+			utils.RespondWithError(w, status, message)
+			return
+		}
+	}
+
+	stream, err := utils.NewEventStream(w)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Streaming unsupported")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	keepAliveDone := make(chan struct{})
+	go func() {
+		stream.KeepAlive(ctx, 15*time.Second)
+		close(keepAliveDone)
+	}()
+	defer func() {
+		cancel()
+		<-keepAliveDone
+	}()
+
+	answer, err := cc.Chat.Stream(ctx, req, streamSink{stream})
+	if err != nil {
+		if r.Context().Err() == nil {
+			_, message := chatError(err)
+			stream.Send("error", map[string]string{"error": message})
+		}
+		return
+	}
+	stream.Send("done", answer)
+}
+
+// streamSink relays chatbot progress as server-sent events
+type streamSink struct {
+	stream *utils.EventStream
+}
+
+func (s streamSink) RetrievalStarted() {
+	s.stream.Send("retrieval-started", map[string]string{})
+}
+
+func (s streamSink) Sources(citations []chatbot.Citation) {
+	s.stream.Send("sources", map[string]interface{}{"citations": citations})
+}
+
+func (s streamSink) Token(text string) {
+	s.stream.Send("token", map[string]string{"text": text})
+}
+
+// decodeChatRequest reads a question and optional conversation_id and
+// language
+func decodeChatRequest(w http.ResponseWriter, r *http.Request) (chatbot.Request, bool) {
+	userID, err := uuid.Parse(r.Context().Value("user_id").(string))
+	if err != nil {
 		utils.RespondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return chatbot.Request{}, false
+	}
+
+	var input struct {
+		Question       string `json:"question"`
+		ConversationID string `json:"conversation_id"`
+		Language       string `json:"language"` // Detected from the question when empty
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return chatbot.Request{}, false
+	}
+
+	req := chatbot.Request{UserID: userID, Question: strings.TrimSpace(input.Question)}
+	if input.ConversationID != "" {
+		id, err := uuid.Parse(input.ConversationID)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid conversation ID format")
+			return chatbot.Request{}, false
+		}
+		req.ConversationID = &id
+	}
+	language, ok := parseLanguage(w, input.Language)
+	if !ok {
+		return chatbot.Request{}, false
+	}
+	req.Language = language
+	return req, true
+}
+
+// SendMessage asks a follow-up question in an existing conversation
+func (cc *ChatbotController) SendMessage(w http.ResponseWriter, r *http.Request) {
+	conv, ok := cc.findConversation(w, r)
+	if !ok {
 		return
 	}
 
 	var input struct {
 		Question string `json:"question"`
+		Language string `json:"language"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
-
-	var healthData []models.HealthData
-	if err := cc.DB.Where("user_id = ?", userID).Find(&healthData).Error; err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving health data")
+	language, ok := parseLanguage(w, input.Language)
+	if !ok {
 		return
 	}
 
-	healthDataStr, _ := json.Marshal(healthData)
+	cc.ask(w, r, chatbot.Request{UserID: conv.UserID, ConversationID: &conv.ID, Question: strings.TrimSpace(input.Question), Language: language})
+}
 
-	// Step 1: Get Relevant Text from Python API
-	pythonPayload := map[string]interface{}{
-		"query": input.Question,
+// parseLanguage validates an optional language tag
+func parseLanguage(w http.ResponseWriter, tag string) (string, bool) {
+	if tag == "" {
+		return "", true
 	}
-	responseData, err := sendToPythonAPI(pythonPayload)
+	language, err := lang.Parse(tag)
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Error processing data with Python API")
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid language, expected a tag such as en, es or pt-BR")
+		return "", false
+	}
+	return language, true
+}
+
+func (cc *ChatbotController) ask(w http.ResponseWriter, r *http.Request, req chatbot.Request) {
+	if req.Question == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Question is required")
 		return
 	}
 
-	// Step 2: Send to Mistral API using Python Server
-	finalPayload := map[string]interface{}{
-		"user_query":    input.Question,
-		"relevant_text": responseData.Texts,
-		"health_data":   string(healthDataStr),
+	answer, err := cc.Chat.Ask(r.Context(), req)
+	if err != nil {
+		status, message := chatError(err)
+		utils.RespondWithError(w, status, message)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, answer)
+}
+
+// chatError maps a chatbot error to a status code and message
+func chatError(err error) (int, string) {
+	switch {
+	case errors.Is(err, chatbot.ErrConversationNotFound):
+		return http.StatusNotFound, "Conversation not found"
+	case errors.Is(err, usage.ErrBudgetExceeded):
+		return http.StatusTooManyRequests, "You have reached your usage limit for the assistant; please try again later"
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, "The assistant took too long to answer, please try again"
+	case upstream.Unavailable(err):
+		return http.StatusServiceUnavailable, "The assistant is temporarily unavailable, please try again shortly"
+	case errors.Is(err, chatbot.ErrGeneration):
+		return http.StatusBadGateway, "Error generating response"
+	}
+	return http.StatusInternalServerError, "Error answering question"
+}
+
+type conversationSummary struct {
+	models.Conversation
+	MessageCount int `json:"message_count"`
+}
+
+// GetConversations lists the user's conversations, most recently active first
+func (cc *ChatbotController) GetConversations(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	var conversations []conversationSummary
+	if err := cc.DB.Model(&models.Conversation{}).
+		Select("conversations.*, (SELECT COUNT(*) FROM messages m WHERE m.conversation_id = conversations.id) AS message_count").
+		Where("user_id = ?", userID).
+		Order("updated_at DESC").
+		Scan(&conversations).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving conversations")
+		return
 	}
-	finalResponse, err := sendToMistralAPI(finalPayload)
+
+	utils.RespondWithJSON(w, http.StatusOK, conversations)
+}
+
+// CreateConversation starts an empty conversation
+func (cc *ChatbotController) CreateConversation(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.Context().Value("user_id").(string))
 	if err != nil {
-		utils.RespondWithError(w, http.StatusInternalServerError, "Error generating response with Mistral")
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid user ID format")
+		return
+	}
+
+	var input struct {
+		Title string `json:"title"`
+	}
+	// An empty body is fine; an untitled conversation is named after its first question
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+	}
+
+	title, ok := conversationTitle(input.Title)
+	if !ok {
+		utils.RespondWithError(w, http.StatusBadRequest, "Title must be at most 200 characters")
+		return
+	}
+	conv := models.Conversation{ID: uuid.New(), UserID: userID, Title: title}
+	if err := cc.DB.Create(&conv).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error creating conversation")
 		return
 	}
 
-	utils.RespondWithJSON(w, http.StatusOK, finalResponse)
+	utils.RespondWithJSON(w, http.StatusCreated, conv)
 }
 
-type PythonAPIResponse struct {
-	Texts []string `json:"texts"`
+// GetConversation returns a conversation with all of its messages, so a
+// client can resume it
+func (cc *ChatbotController) GetConversation(w http.ResponseWriter, r *http.Request) {
+	conv, ok := cc.findConversation(w, r)
+	if !ok {
+		return
+	}
+
+	if err := cc.DB.Where("conversation_id = ?", conv.ID).Order("created_at ASC").
+		Find(&conv.Messages).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving messages")
+		return
+	}
+	if conv.Messages == nil {
+		conv.Messages = []models.Message{}
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, conv)
+}
+
+// ExportConversation downloads a conversation with its timestamps, sources
+// and disclaimers to share with a doctor: format=md (the default) or pdf.
+// Times are shown in the IANA time zone tz, UTC by default. Conversations
+// in scripts the PDF fonts lack get 422 for pdf.
+func (cc *ChatbotController) ExportConversation(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "md"
+	}
+	if format != "md" && format != "pdf" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid format; use pdf or md")
+		return
+	}
+	loc := time.UTC
+	if tz := r.URL.Query().Get("tz"); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid time zone")
+			return
+		}
+	}
+
+	conv, ok := cc.findConversation(w, r)
+	if !ok {
+		return
+	}
+	if err := cc.DB.Where("conversation_id = ?", conv.ID).Order("created_at ASC").
+		Find(&conv.Messages).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving messages")
+		return
+	}
+	var user models.User
+	cc.DB.Select("name").Where("id = ?", conv.UserID).First(&user)
+
+	t := transcript.New(conv, user.Name, time.Now(), loc)
+	var buf bytes.Buffer
+	var err error
+	contentType := "application/pdf"
+	if format == "pdf" {
+		err = transcript.PDF(&buf, t)
+	} else {
+		contentType = "text/markdown; charset=utf-8"
+		err = transcript.Markdown(&buf, t)
+	}
+	if errors.Is(err, transcript.ErrUnsupportedScript) {
+		utils.RespondWithError(w, http.StatusUnprocessableEntity,
+			"This conversation uses a script the PDF export cannot show; export it with format=md instead")
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error exporting conversation")
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+t.Filename(format)+`"`)
+	w.Write(buf.Bytes())
 }
 
-type MistralAPIResponse struct {
-	GeneratedText string `json:"generated_text"`
+// RenameConversation changes a conversation's title
+func (cc *ChatbotController) RenameConversation(w http.ResponseWriter, r *http.Request) {
+	conv, ok := cc.findConversation(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Title string `json:"title"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	title, ok := conversationTitle(input.Title)
+	if !ok || title == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Title must be 1 to 200 characters")
+		return
+	}
+
+	if err := cc.DB.Model(conv).Update("title", title).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error updating conversation")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, conv)
 }
 
-func sendToPythonAPI(payload map[string]interface{}) (*PythonAPIResponse, error) {
-	requestBody, _ := json.Marshal(payload)
-	resp, err := http.Post("http://localhost:5000/query", "application/json", bytes.NewBuffer(requestBody))
+// DeleteConversation removes a conversation with its messages and the
+// feedback given on them. Safety events are kept for the rule statistics,
+// without the text they matched.
+func (cc *ChatbotController) DeleteConversation(w http.ResponseWriter, r *http.Request) {
+	conv, ok := cc.findConversation(w, r)
+	if !ok {
+		return
+	}
+
+	err := cc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.SafetyEvent{}).Where("conversation_id = ?", conv.ID).
+			Update("excerpt", "").Error; err != nil {
+			return err
+		}
+		if err := tx.Where("conversation_id = ?", conv.ID).Delete(&models.Feedback{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("conversation_id = ?", conv.ID).Delete(&models.Message{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(conv).Error
+	})
 	if err != nil {
-		return nil, err
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error deleting conversation")
+		return
 	}
-	defer resp.Body.Close()
 
-	body, _ := ioutil.ReadAll(resp.Body)
-	var responseData PythonAPIResponse
-	if err := json.Unmarshal(body, &responseData); err != nil {
-		return nil, err
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Conversation deleted"})
+}
+
+// GetKnowledgePassage returns a knowledge base passage cited by an answer
+func (cc *ChatbotController) GetKnowledgePassage(w http.ResponseWriter, r *http.Request) {
+	var chunk models.KnowledgeChunk
+	if err := cc.DB.Where("hash = ?", mux.Vars(r)["id"]).First(&chunk).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.RespondWithError(w, http.StatusNotFound, "Passage not found")
+		} else {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving passage")
+		}
+		return
 	}
-	return &responseData, nil
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"id":      chunk.Hash,
+		"source":  chunk.Source,
+		"content": chunk.Content,
+	})
 }
 
-func sendToMistralAPI(payload map[string]interface{}) (*MistralAPIResponse, error) {
-	requestBody, _ := json.Marshal(payload)
-	resp, err := http.Post("http://localhost:5001/generate", "application/json", bytes.NewBuffer(requestBody))
+// findConversation loads the user's conversation named in the URL
+func (cc *ChatbotController) findConversation(w http.ResponseWriter, r *http.Request) (*models.Conversation, bool) {
+	userID, err := uuid.Parse(r.Context().Value("user_id").(string))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid user ID format")
+		return nil, false
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
 	if err != nil {
-		return nil, err
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid conversation ID format")
+		return nil, false
 	}
-	defer resp.Body.Close()
 
-	body, _ := ioutil.ReadAll(resp.Body)
-	var responseData MistralAPIResponse
-	if err := json.Unmarshal(body, &responseData); err != nil {
-		return nil, err
+	conv, err := cc.Chat.Conversation(userID, id)
+	if err != nil {
+		if errors.Is(err, chatbot.ErrConversationNotFound) {
+			utils.RespondWithError(w, http.StatusNotFound, "Conversation not found")
+		} else {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving conversation")
+		}
+		return nil, false
 	}
-	return &responseData, nil
+	return conv, true
+}
+
+func conversationTitle(title string) (string, bool) {
+	title = strings.Join(strings.Fields(title), " ")
+	return title, len([]rune(title)) <= 200
 }
@@ -0,0 +1,267 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/chatbot"
+	"backend/models"
+	"backend/utils"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type FeedbackController struct {
+	DB *gorm.DB
+}
+
+func NewFeedbackController(db *gorm.DB) *FeedbackController {
+	return &FeedbackController{DB: db}
+}
+
+// RateMessage records the user's rating of an answer, replacing an earlier
+// rating of the same answer
+func (fc *FeedbackController) RateMessage(w http.ResponseWriter, r *http.Request) {
+	reply, ok := fc.findReply(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Rating  string   `json:"rating"`
+		Reasons []string `json:"reasons"`
+		Comment string   `json:"comment"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	rating := strings.ToLower(strings.TrimSpace(input.Rating))
+	if rating != models.RatingUp && rating != models.RatingDown {
+		utils.RespondWithError(w, http.StatusBadRequest, "Rating must be up or down")
+		return
+	}
+	reasons, ok := feedbackReasons(input.Reasons)
+	if !ok {
+		utils.RespondWithError(w, http.StatusBadRequest, "Reasons must be among: "+strings.Join(models.FeedbackReasons, ", "))
+		return
+	}
+	comment := strings.TrimSpace(input.Comment)
+	if len([]rune(comment)) > 2000 {
+		utils.RespondWithError(w, http.StatusBadRequest, "Comment must be at most 2000 characters")
+		return
+	}
+
+	// The question is the user's message just before the answer
+	var question models.Message
+	if err := fc.DB.Where("conversation_id = ? AND role = ? AND created_at <= ?",
+		reply.ConversationID, models.MessageRoleUser, reply.CreatedAt).
+		Order("created_at DESC").First(&question).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving question")
+		return
+	}
+
+	feedback := models.Feedback{
+		UserID:         reply.UserID,
+		ConversationID: reply.ConversationID,
+		MessageID:      reply.ID,
+		Rating:         rating,
+		Reasons:        reasons,
+		Comment:        comment,
+		Question:       question.Content,
+		Answer:         reply.Content,
+		Context:        reply.Citations,
+		Model:          reply.Model,
+		PromptVersion:  reply.PromptVersion,
+	}
+	if err := fc.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "message_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rating", "reasons", "comment", "updated_at"}),
+	}).Create(&feedback).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error saving feedback")
+		return
+	}
+	if err := fc.DB.Where("message_id = ?", reply.ID).First(&feedback).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving feedback")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, feedback)
+}
+
+// DeleteFeedback withdraws the user's rating of an answer
+func (fc *FeedbackController) DeleteFeedback(w http.ResponseWriter, r *http.Request) {
+	reply, ok := fc.findReply(w, r)
+	if !ok {
+		return
+	}
+
+	if err := fc.DB.Where("message_id = ?", reply.ID).Delete(&models.Feedback{}).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error deleting feedback")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Feedback deleted"})
+}
+
+// ExportFeedback lists ratings for review, thumbs down by default. Filters:
+// rating (up, down or all), reason, model, prompt_version, from and to
+// (YYYY-MM-DD) and limit. format=csv downloads a spreadsheet instead of JSON.
+func (fc *FeedbackController) ExportFeedback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	query := fc.DB.Model(&models.Feedback{})
+
+	switch rating := strings.ToLower(q.Get("rating")); rating {
+	case "", models.RatingDown:
+		query = query.Where("rating = ?", models.RatingDown)
+	case models.RatingUp:
+		query = query.Where("rating = ?", models.RatingUp)
+	case "all":
+	default:
+		utils.RespondWithError(w, http.StatusBadRequest, "Rating must be up, down or all")
+		return
+	}
+	if reason := q.Get("reason"); reason != "" {
+		// Only known reasons, which hold no LIKE wildcards, are matched
+		reason, ok := feedbackReasons([]string{reason})
+		if !ok {
+			utils.RespondWithError(w, http.StatusBadRequest, "Unknown feedback reason")
+			return
+		}
+		query = query.Where("(',' || reasons || ',') LIKE ?", "%,"+reason+",%")
+	}
+	if model := q.Get("model"); model != "" {
+		query = query.Where("model = ?", model)
+	}
+	if version := q.Get("prompt_version"); version != "" {
+		query = query.Where("prompt_version = ?", version)
+	}
+	for _, bound := range []struct{ param, cond string }{{"from", "created_at >= ?"}, {"to", "created_at < ?"}} {
+		v := q.Get(bound.param)
+		if v == "" {
+			continue
+		}
+		day, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid "+bound.param+" date, use YYYY-MM-DD")
+			return
+		}
+		if bound.param == "to" {
+			day = day.AddDate(0, 0, 1) // Inclusive
+		}
+		query = query.Where(bound.cond, day)
+	}
+
+	var feedback []models.Feedback
+	if err := query.Order("created_at DESC").Limit(queryInt(r, "limit", 500, 1, 5000)).
+		Find(&feedback).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving feedback")
+		return
+	}
+
+	if q.Get("format") == "csv" {
+		writeFeedbackCSV(w, feedback)
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, feedback)
+}
+
+// writeFeedbackCSV writes feedback as CSV. Comments, questions and answers
+// come from users and the model, so cells are escaped against formulas.
+func writeFeedbackCSV(w http.ResponseWriter, feedback []models.Feedback) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="chatbot-feedback.csv"`)
+	out := csv.NewWriter(w)
+	out.Write([]string{"created_at", "rating", "reasons", "comment", "question", "answer", "sources", "model",
+		"prompt_version", "user_id", "conversation_id", "message_id"})
+	for _, f := range feedback {
+		row := []string{
+			f.CreatedAt.Format(time.RFC3339), f.Rating, f.Reasons, f.Comment, f.Question, f.Answer,
+			sourceTitles(f.Context), f.Model, f.PromptVersion, f.UserID.String(), f.ConversationID.String(), f.MessageID.String(),
+		}
+		for i := range row {
+			row[i] = spreadsheetCell(row[i])
+		}
+		out.Write(row)
+	}
+	out.Flush()
+}
+
+// spreadsheetCell prefixes text a spreadsheet would run as a formula with a
+// quote, so it is shown as text instead
+func spreadsheetCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// sourceTitles lists stored citations as "[1] Title; [2] Title"
+func sourceTitles(context []byte) string {
+	var citations []chatbot.Citation
+	if len(context) == 0 || json.Unmarshal(context, &citations) != nil {
+		return ""
+	}
+	parts := make([]string, len(citations))
+	for i, c := range citations {
+		parts[i] = "[" + strconv.Itoa(c.Number) + "] " + c.Title
+	}
+	return strings.Join(parts, "; ")
+}
+
+// feedbackReasons validates reason categories and returns them in stored form
+func feedbackReasons(reasons []string) (string, bool) {
+	seen := map[string]bool{}
+	var out []string
+	for _, reason := range reasons {
+		reason = strings.ToLower(strings.TrimSpace(reason))
+		known := false
+		for _, r := range models.FeedbackReasons {
+			known = known || r == reason
+		}
+		if !known {
+			return "", false
+		}
+		if !seen[reason] {
+			seen[reason] = true
+			out = append(out, reason)
+		}
+	}
+	return strings.Join(out, ","), true
+}
+
+// findReply loads the user's assistant message named in the URL
+func (fc *FeedbackController) findReply(w http.ResponseWriter, r *http.Request) (*models.Message, bool) {
+	userID := r.Context().Value("user_id").(string)
+	vars := mux.Vars(r)
+	convID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid conversation ID format")
+		return nil, false
+	}
+	messageID, err := uuid.Parse(vars["messageId"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid message ID format")
+		return nil, false
+	}
+
+	var reply models.Message
+	if err := fc.DB.Where("id = ? AND conversation_id = ? AND user_id = ? AND role = ?",
+		messageID, convID, userID, models.MessageRoleAssistant).First(&reply).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.RespondWithError(w, http.StatusNotFound, "Answer not found")
+		} else {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving answer")
+		}
+		return nil, false
+	}
+	return &reply, true
+}
@@ -2,9 +2,15 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"time"
 
+	"backend/alerts"
+	"backend/labs"
 	"backend/models"
+	"backend/rag"
 	"backend/utils"
 
 	"github.com/google/uuid"
@@ -14,11 +20,17 @@ import (
 )
 
 type HealthDataController struct {
-	DB *gorm.DB
+	DB      *gorm.DB
+	Alerts  *alerts.Evaluator
+	Records *rag.RecordIndex
 }
 
 func NewHealthDataController(db *gorm.DB) *HealthDataController {
-	return &HealthDataController{DB: db}
+	records, err := rag.RecordIndexFromEnv(db)
+	if err != nil {
+		log.Fatal("Failed to configure record index: ", err)
+	}
+	return &HealthDataController{DB: db, Alerts: alerts.NewEvaluator(db), Records: records}
 }
 
 // Add Health Data
@@ -46,15 +58,31 @@ func (hc *HealthDataController) AddHealthData(w http.ResponseWriter, r *http.Req
 	}
 
 	healthData := models.HealthData{
+		ID:     uuid.New(),
 		UserID: userID,
 		Data:   datatypes.JSON(jsonData), // Store JSON data as byte slice
 	}
 
-	if err := hc.DB.Create(&healthData).Error; err != nil {
+	// Record structured vitals and lab values for trends
+	observations := labs.ExtractFields(userID, healthData.ID, input, time.Now())
+
+	err = hc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&healthData).Error; err != nil {
+			return err
+		}
+		if len(observations) > 0 {
+			return tx.Create(&observations).Error
+		}
+		return nil
+	})
+	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error adding health data")
 		return
 	}
 
+	hc.Alerts.Evaluate(observations)
+	hc.Records.IndexAsync(healthData)
+
 	utils.RespondWithJSON(w, http.StatusCreated, healthData)
 }
 
@@ -87,6 +115,36 @@ func (hc *HealthDataController) GetUserHealthData(w http.ResponseWriter, r *http
 	utils.RespondWithJSON(w, http.StatusOK, healthData)
 }
 
+// Get a single Health Data record
+func (hc *HealthDataController) GetHealthDataByID(w http.ResponseWriter, r *http.Request) {
+	userIDStr := r.Context().Value("user_id").(string)
+	dataIDStr := mux.Vars(r)["id"]
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid user ID format")
+		return
+	}
+
+	dataID, err := uuid.Parse(dataIDStr)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid data ID format")
+		return
+	}
+
+	var healthData models.HealthData
+	if err := hc.DB.Where("id = ? AND user_id = ?", dataID, userID).First(&healthData).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.RespondWithError(w, http.StatusNotFound, "Health data not found")
+		} else {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving health data")
+		}
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, healthData)
+}
+
 // Delete Health Data
 func (hc *HealthDataController) DeleteHealthData(w http.ResponseWriter, r *http.Request) {
 	userIDStr := r.Context().Value("user_id").(string)
@@ -109,6 +167,8 @@ func (hc *HealthDataController) DeleteHealthData(w http.ResponseWriter, r *http.
 		utils.RespondWithError(w, http.StatusInternalServerError, "Error deleting health data")
 		return
 	}
+	// Chunks go with the record; answers must not keep citing it from cache
+	hc.Records.Invalidate(r.Context(), userID)
 
 	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Health data deleted"})
 }
@@ -189,12 +249,31 @@ func (hc *HealthDataController) StoreHealthData(w http.ResponseWriter, r *http.R
 		Data:   datatypes.JSON(dataJSON),
 	}
 
-	if err := hc.DB.Create(&healthData).Error; err != nil {
+	// Pull structured lab results out of the report text
+	observations := labs.Extract(userUUID, healthData.ID, extractedText, time.Now())
+
+	err = hc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&healthData).Error; err != nil {
+			return err
+		}
+		if len(observations) > 0 {
+			return tx.Create(&observations).Error
+		}
+		return nil
+	})
+	if err != nil {
 		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to store health data")
 		return
 	}
 
-	utils.RespondWithJSON(w, http.StatusOK, map[string]string{"message": "Data stored successfully"})
+	hc.Alerts.Evaluate(observations)
+	hc.Records.IndexAsync(healthData)
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"message":      "Data stored successfully",
+		"id":           healthData.ID.String(),
+		"observations": len(observations),
+	})
 }
 
 func (hc *HealthDataController) StoreHealthConcerns(w http.ResponseWriter, r *http.Request) {
@@ -247,6 +326,8 @@ func (hc *HealthDataController) StoreHealthConcerns(w http.ResponseWriter, r *ht
 		return
 	}
 
+	hc.Records.IndexAsync(healthData)
+
 	utils.RespondWithJSON(w, http.StatusOK, map[string]string{
 		"message": "Health concerns data stored successfully",
 		"id":      healthData.ID.String(),
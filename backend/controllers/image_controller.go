@@ -1,27 +1,44 @@
 package controllers
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"io"
+	"io/ioutil"
+	"log"
 	"net/http"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
+	"backend/imagecheck"
 	"backend/models"
+	"backend/storage"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ImageController struct {
-	DB *gorm.DB
+	DB    *gorm.DB
+	Blobs storage.BlobStore
 }
 
-// NewImageController creates a new image controller with the given database connection
+// NewImageController creates a new image controller with the given database
+// connection, keeping image bytes in the blob store selected by
+// storage.FromEnv
 func NewImageController(db *gorm.DB) *ImageController {
+	blobs, err := storage.FromEnv()
+	if err != nil {
+		log.Fatal("Failed to configure blob store: ", err)
+	}
 	return &ImageController{
-		DB: db,
+		DB:    db,
+		Blobs: blobs,
 	}
 }
 
@@ -41,8 +58,15 @@ func (ic *ImageController) UploadImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse multipart form with 10MB max memory
+	// Parse multipart form with 10MB max memory, refusing bodies far over
+	// the largest image allowed
+	r.Body = http.MaxBytesReader(w, r.Body, imagecheck.MaxBytes()+1<<20)
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Image too large", http.StatusRequestEntityTooLarge)
+			return
+		}
 		http.Error(w, "Failed to parse form", http.StatusBadRequest)
 		return
 	}
@@ -54,31 +78,43 @@ func (ic *ImageController) UploadImage(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	// Validate file type
-	fileExt := filepath.Ext(header.Filename)
-	if !isValidImageType(fileExt) {
-		http.Error(w, "Invalid image format. Supported formats: jpg, jpeg, png, gif", http.StatusBadRequest)
+	// Read the file data
+	imageData, err := io.ReadAll(io.LimitReader(file, imagecheck.MaxBytes()+1))
+	if err != nil {
+		http.Error(w, "Failed to read image file", http.StatusInternalServerError)
 		return
 	}
 
-	// Read the file data
-	imageData, err := io.ReadAll(file)
+	// Validate the content itself; the file name and the declared type are
+	// up to the client
+	info, err := imagecheck.Check(imageData)
 	if err != nil {
-		http.Error(w, "Failed to read image file", http.StatusInternalServerError)
+		status := http.StatusBadRequest
+		if errors.Is(err, imagecheck.ErrTooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, strings.ToUpper(err.Error()[:1])+err.Error()[1:], status)
 		return
 	}
 
-	// Create a new UserImage record
+	// Create a new UserImage record; the bytes go to the blob store
 	userImage := models.UserImage{
+		ID:        uuid.New().String(),
 		UserID:    userID,
-		ImageData: imageData,
-		ImageType: header.Header.Get("Content-Type"),
-		ImageName: header.Filename,
-		Size:      header.Size,
+		ImageType: info.Type,
+		ImageName: filepath.Base(header.Filename),
+		Size:      int64(len(imageData)),
+	}
+	userImage.BlobKey = models.ImageBlobKey(userID, userImage.ID)
+	if err := ic.Blobs.Put(r.Context(), userImage.BlobKey, imageData, userImage.ImageType); err != nil {
+		log.Printf("images: storing %s in %s: %v", userImage.BlobKey, ic.Blobs.Name(), err)
+		http.Error(w, "Failed to save image", http.StatusInternalServerError)
+		return
 	}
 
 	// Save to database
 	if err := ic.DB.Create(&userImage).Error; err != nil {
+		ic.deleteBlob(userImage.BlobKey)
 		http.Error(w, "Failed to save image", http.StatusInternalServerError)
 		return
 	}
@@ -163,11 +199,33 @@ func (ic *ImageController) GetImageById(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Set appropriate content type and return image data
-	w.Header().Set("Content-Disposition", "inline; filename="+image.ImageName)
-	w.Header().Set("Content-Type", image.ImageType)
+	// Images not yet moved out of the database still carry their bytes
+	var data io.ReadCloser = ioutil.NopCloser(bytes.NewReader(image.ImageData))
+	if image.BlobKey != "" {
+		var err error
+		if data, err = ic.Blobs.Get(r.Context(), image.BlobKey); err != nil {
+			log.Printf("images: reading %s from %s: %v", image.BlobKey, ic.Blobs.Name(), err)
+			if errors.Is(err, storage.ErrNotFound) {
+				http.Error(w, "Image not found", http.StatusNotFound)
+			} else {
+				http.Error(w, "Failed to fetch image", http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+	defer data.Close()
+
+	// Set appropriate content type and return image data. Types recorded
+	// from the client before uploads were sniffed are not trusted.
+	contentType := image.ImageType
+	if !imagecheck.Supported(contentType) {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Disposition", "inline; filename="+strconv.Quote(image.ImageName))
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
 	w.WriteHeader(http.StatusOK)
-	w.Write(image.ImageData)
+	io.Copy(w, data)
 }
 
 // DeleteImage deletes an image
@@ -181,8 +239,10 @@ func (ic *ImageController) DeleteImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Find and delete the image
-	result := ic.DB.Where("id = ? AND user_id = ?", imageID, userID).Delete(&models.UserImage{})
+	// Find and delete the image, then its bytes
+	var image models.UserImage
+	result := ic.DB.Clauses(clause.Returning{Columns: []clause.Column{{Name: "blob_key"}}}).
+		Where("id = ? AND user_id = ?", imageID, userID).Delete(&image)
 	if result.Error != nil {
 		http.Error(w, "Failed to delete image", http.StatusInternalServerError)
 		return
@@ -192,20 +252,21 @@ func (ic *ImageController) DeleteImage(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Image not found or already deleted", http.StatusNotFound)
 		return
 	}
+	if image.BlobKey != "" {
+		ic.deleteBlob(image.BlobKey)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"message":"Image deleted successfully"}`))
 }
 
-// Helper function to validate image types
-// Helper function to validate image types
-func isValidImageType(ext string) bool {
-	validExtensions := map[string]bool{
-		".jpg":  true,
-		".jpeg": true,
-		".png":  true,
-		".gif":  true,
+// deleteBlob removes bytes no row refers to any more. A failure leaves an
+// orphaned object behind, which is logged rather than failing the request.
+func (ic *ImageController) deleteBlob(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := ic.Blobs.Delete(ctx, key); err != nil {
+		log.Printf("images: deleting %s from %s: %v", key, ic.Blobs.Name(), err)
 	}
-	return validExtensions[strings.ToLower(ext)]
 }
@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"backend/labs"
+	"backend/models"
+	"backend/units"
+	"backend/utils"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type ObservationController struct {
+	DB *gorm.DB
+}
+
+func NewObservationController(db *gorm.DB) *ObservationController {
+	return &ObservationController{DB: db}
+}
+
+// List the user's structured observations, optionally filtered by analyte and date
+func (oc *ObservationController) GetObservations(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.Context().Value("user_id").(string))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid user ID format")
+		return
+	}
+
+	query := oc.DB.Where("user_id = ?", userID)
+
+	if analyte := r.URL.Query().Get("analyte"); analyte != "" {
+		a, ok := labs.Resolve(analyte)
+		if !ok {
+			utils.RespondWithError(w, http.StatusBadRequest, "Unknown analyte")
+			return
+		}
+		query = query.Where("code = ?", a.Code)
+	}
+	if from := r.URL.Query().Get("from"); from != "" {
+		t, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid from date, expected YYYY-MM-DD")
+			return
+		}
+		query = query.Where("effective_at >= ?", t)
+	}
+	if to := r.URL.Query().Get("to"); to != "" {
+		t, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid to date, expected YYYY-MM-DD")
+			return
+		}
+		query = query.Where("effective_at < ?", t.AddDate(0, 0, 1))
+	}
+	if r.URL.Query().Get("abnormal") == "true" {
+		query = query.Where("flag <> ''")
+	}
+
+	var observations []models.Observation
+	if err := query.Order("effective_at DESC, name").Find(&observations).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving observations")
+		return
+	}
+
+	labs.Localize(observations, preferencesFor(oc.DB, userID.String()))
+	utils.RespondWithJSON(w, http.StatusOK, observations)
+}
+
+// List the observations extracted from one health record
+func (oc *ObservationController) GetRecordObservations(w http.ResponseWriter, r *http.Request) {
+	record, ok := oc.findRecord(w, r)
+	if !ok {
+		return
+	}
+
+	var observations []models.Observation
+	if err := oc.DB.Where("health_data_id = ?", record.ID).Order("name").Find(&observations).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving observations")
+		return
+	}
+
+	labs.Localize(observations, preferencesFor(oc.DB, record.UserID.String()))
+	utils.RespondWithJSON(w, http.StatusOK, observations)
+}
+
+// Re-run extraction on a stored record, replacing its previous observations.
+// Used for records uploaded before extraction existed or after parser updates.
+func (oc *ObservationController) ReparseRecord(w http.ResponseWriter, r *http.Request) {
+	record, ok := oc.findRecord(w, r)
+	if !ok {
+		return
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(record.Data), &data); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error parsing health data")
+		return
+	}
+	observations := labs.ExtractFields(record.UserID, record.ID, data, time.Now())
+
+	err := oc.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("health_data_id = ?", record.ID).Delete(&models.Observation{}).Error; err != nil {
+			return err
+		}
+		if len(observations) > 0 {
+			return tx.Create(&observations).Error
+		}
+		return nil
+	})
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to store observations")
+		return
+	}
+
+	labs.Localize(observations, preferencesFor(oc.DB, record.UserID.String()))
+	utils.RespondWithJSON(w, http.StatusOK, observations)
+}
+
+// List the analytes the report parser recognizes
+func (oc *ObservationController) GetDictionary(w http.ResponseWriter, r *http.Request) {
+	utils.RespondWithJSON(w, http.StatusOK, labs.Dictionary())
+}
+
+// findRecord loads the health record named in the URL if it belongs to the user
+func (oc *ObservationController) findRecord(w http.ResponseWriter, r *http.Request) (*models.HealthData, bool) {
+	userID, err := uuid.Parse(r.Context().Value("user_id").(string))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid user ID format")
+		return nil, false
+	}
+	dataID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid data ID format")
+		return nil, false
+	}
+
+	var record models.HealthData
+	if err := oc.DB.Where("id = ? AND user_id = ?", dataID, userID).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.RespondWithError(w, http.StatusNotFound, "Health data not found")
+		} else {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving health data")
+		}
+		return nil, false
+	}
+	return &record, true
+}
+
+// preferencesFor loads a user's display preferences, falling back to defaults
+func preferencesFor(db *gorm.DB, userID string) units.Preferences {
+	var user models.User
+	db.Select("id, unit_system, lab_units").First(&user, "id = ?", userID)
+	return units.PreferencesOf(user)
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"backend/models"
+	"backend/prompts"
+	"backend/utils"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type PromptController struct {
+	DB      *gorm.DB
+	Prompts *prompts.Store
+}
+
+func NewPromptController(db *gorm.DB) *PromptController {
+	return &PromptController{DB: db, Prompts: prompts.NewStore(db)}
+}
+
+// GetPrompt returns the built-in template of a prompt and its saved
+// versions, newest first, with their rollout weights
+func (pc *PromptController) GetPrompt(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	system, user, err := prompts.BuiltinText(name)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Unknown prompt")
+		return
+	}
+	versions, err := pc.Prompts.Versions(name)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving prompt versions")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"name":     name,
+		"builtin":  map[string]string{"system": system, "user": user},
+		"versions": versions,
+	})
+}
+
+// CreatePromptVersion saves a new version of a prompt. Templates are Go
+// text/templates over prompts.Data and are test-rendered before saving. The
+// version is not served until a rollout gives it a weight.
+func (pc *PromptController) CreatePromptVersion(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if _, _, err := prompts.BuiltinText(name); err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Unknown prompt")
+		return
+	}
+
+	var input struct {
+		System      string `json:"system"`
+		User        string `json:"user"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if _, err := prompts.Parse(name, 0, input.System, input.User); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid template: "+err.Error())
+		return
+	}
+
+	var createdBy *uuid.UUID
+	if id, err := uuid.Parse(r.Context().Value("user_id").(string)); err == nil {
+		createdBy = &id
+	}
+	version, err := pc.Prompts.Create(name, input.System, input.User, strings.TrimSpace(input.Description), createdBy)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error saving prompt version")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusCreated, version)
+}
+
+// SetPromptRollout splits users between prompt versions, e.g.
+// {"weights": {"3": 90, "4": 10}}. Unlisted versions stop being served; no
+// weights at all go back to the built-in template.
+func (pc *PromptController) SetPromptRollout(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if _, _, err := prompts.BuiltinText(name); err != nil {
+		utils.RespondWithError(w, http.StatusNotFound, "Unknown prompt")
+		return
+	}
+
+	var input struct {
+		Weights map[string]int `json:"weights"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	weights := map[int]int{}
+	for key, weight := range input.Weights {
+		version, err := strconv.Atoi(key)
+		if err != nil || version < 1 {
+			utils.RespondWithError(w, http.StatusBadRequest, "Weights must be keyed by version number")
+			return
+		}
+		if weight < 0 {
+			utils.RespondWithError(w, http.StatusBadRequest, "Weights must not be negative")
+			return
+		}
+		if weight > 0 {
+			weights[version] = weight
+		}
+	}
+
+	if err := pc.Prompts.SetWeights(name, weights); err != nil {
+		if errors.Is(err, prompts.ErrUnknownVersion) {
+			utils.RespondWithError(w, http.StatusBadRequest, "Unknown prompt version")
+		} else {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Error updating rollout")
+		}
+		return
+	}
+
+	versions, err := pc.Prompts.Versions(name)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving prompt versions")
+		return
+	}
+	live := []models.PromptTemplate{}
+	for _, v := range versions {
+		if v.Weight > 0 {
+			live = append(live, v)
+		}
+	}
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{"name": name, "serving": live})
+}
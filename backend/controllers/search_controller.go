@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"backend/search"
+	"backend/utils"
+
+	"gorm.io/gorm"
+)
+
+type SearchController struct {
+	DB       *gorm.DB
+	Searcher *search.Searcher
+}
+
+func NewSearchController(db *gorm.DB) *SearchController {
+	return &SearchController{DB: db, Searcher: search.NewSearcher(db)}
+}
+
+// Search runs a full-text query over the user's records and images
+func (sc *SearchController) Search(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(string)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		utils.RespondWithError(w, http.StatusBadRequest, "Query parameter q is required")
+		return
+	}
+	if len(query) > 256 {
+		utils.RespondWithError(w, http.StatusBadRequest, "Query is too long")
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	hits, err := sc.Searcher.Search(userID, query, limit)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error searching records")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"query":   query,
+		"total":   len(hits),
+		"results": hits,
+	})
+}
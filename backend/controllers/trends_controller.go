@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend/labs"
+	"backend/models"
+	"backend/trends"
+	"backend/utils"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+type TrendsController struct {
+	DB *gorm.DB
+}
+
+func NewTrendsController(db *gorm.DB) *TrendsController {
+	return &TrendsController{DB: db}
+}
+
+// ListTrends returns the analytes the user has values for
+func (tc *TrendsController) ListTrends(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(string)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var rows []struct {
+		Code   string    `json:"code"`
+		Name   string    `json:"name"`
+		Count  int       `json:"count"`
+		Latest time.Time `json:"latest"`
+	}
+	if err := tc.DB.Model(&models.Observation{}).
+		Select("code, MIN(name) AS name, COUNT(*) AS count, MAX(effective_at) AS latest").
+		Where("user_id = ? AND code <> ''", userID).
+		Group("code").
+		Order("latest DESC").
+		Scan(&rows).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving trends")
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, rows)
+}
+
+// GetTrend returns the time series and statistics for one analyte
+func (tc *TrendsController) GetTrend(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(string)
+	if !ok {
+		utils.RespondWithError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	analyte, ok := labs.Resolve(mux.Vars(r)["analyte"])
+	if !ok {
+		utils.RespondWithError(w, http.StatusNotFound, "Unknown analyte")
+		return
+	}
+
+	query := tc.DB.Where("user_id = ? AND code = ?", userID, analyte.Code)
+	if from := r.URL.Query().Get("from"); from != "" {
+		t, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid from date, expected YYYY-MM-DD")
+			return
+		}
+		query = query.Where("effective_at >= ?", t)
+	}
+	if to := r.URL.Query().Get("to"); to != "" {
+		t, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid to date, expected YYYY-MM-DD")
+			return
+		}
+		query = query.Where("effective_at < ?", t.AddDate(0, 0, 1))
+	}
+
+	window := queryInt(r, "window", 3, 1, 50)
+	maxPoints := queryInt(r, "max_points", 200, 3, 1000)
+
+	var observations []models.Observation
+	if err := query.Order("effective_at").Find(&observations).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving observations")
+		return
+	}
+
+	unit := analyte.DisplayUnit(preferencesFor(tc.DB, userID))
+	refLow := labs.ConvertBound(analyte, analyte.RefLow, analyte.Unit, unit)
+	refHigh := labs.ConvertBound(analyte, analyte.RefHigh, analyte.Unit, unit)
+
+	points := trends.Series(analyte, observations, unit)
+
+	stats := trends.Analyze(points)
+	series := trends.Downsample(points, maxPoints)
+
+	utils.RespondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"analyte": map[string]string{"code": analyte.Code, "name": analyte.Name},
+		"unit":    unit,
+		"reference_range": map[string]*float64{
+			"low":  refLow,
+			"high": refHigh,
+		},
+		"stats":          stats,
+		"points":         series,
+		"moving_average": trends.Downsample(trends.MovingAverage(points, window), maxPoints),
+		"total_points":   len(points),
+		"downsampled":    len(series) < len(points),
+	})
+}
+
+// queryInt reads an integer query parameter, clamped to [min, max]
+func queryInt(r *http.Request, name string, def, min, max int) int {
+	v, err := strconv.Atoi(r.URL.Query().Get(name))
+	if err != nil {
+		return def
+	}
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
@@ -0,0 +1,297 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend/models"
+	"backend/rag"
+	"backend/safety"
+	"backend/triage"
+	"backend/utils"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+type TriageController struct {
+	DB      *gorm.DB
+	Flow    *triage.Flow
+	Safety  *safety.Guard
+	Records *rag.RecordIndex
+}
+
+func NewTriageController(db *gorm.DB) *TriageController {
+	flow, err := triage.FlowFromEnv()
+	if err != nil {
+		log.Fatal("Failed to load triage flow: ", err)
+	}
+	guard, err := safety.GuardFromEnv()
+	if err != nil {
+		log.Fatal("Failed to load safety rules: ", err)
+	}
+	records, err := rag.RecordIndexFromEnv(db)
+	if err != nil {
+		log.Fatal("Failed to configure record index: ", err)
+	}
+	return &TriageController{DB: db, Flow: flow, Safety: guard, Records: records}
+}
+
+// triageView is a session with the question to answer next, or the advice
+// once it is completed
+type triageView struct {
+	models.TriageSession
+	Question *triage.Step `json:"question,omitempty"`
+	Reasons  []string     `json:"reasons,omitempty"`
+	Advice   string       `json:"advice,omitempty"`
+}
+
+// StartTriage begins a triage from a stored health concerns record
+// (concern_id) or a description of the symptoms. Questions the concern
+// already answers are filled in, and symptoms with emergency warning signs
+// end the triage straight away.
+func (tc *TriageController) StartTriage(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.Context().Value("user_id").(string))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid user ID format")
+		return
+	}
+
+	var input struct {
+		ConcernID string `json:"concern_id"`
+		Symptoms  string `json:"symptoms"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	session := models.TriageSession{ID: uuid.New(), UserID: userID, Status: models.TriageInProgress}
+	concern := triage.Concern{Symptoms: strings.TrimSpace(input.Symptoms)}
+	if input.ConcernID != "" {
+		concernID, err := uuid.Parse(input.ConcernID)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid concern ID format")
+			return
+		}
+		var record models.HealthData
+		if err := tc.DB.Where("id = ? AND user_id = ?", concernID, userID).First(&record).Error; err != nil {
+			utils.RespondWithError(w, http.StatusNotFound, "Health concerns not found")
+			return
+		}
+		var data map[string]interface{}
+		if err := json.Unmarshal(record.Data, &data); err != nil || data["type"] != "health_concerns" {
+			utils.RespondWithError(w, http.StatusBadRequest, "Record is not a health concerns record")
+			return
+		}
+		concern = concernOf(data, concern.Symptoms)
+		session.ConcernID = &concernID
+	}
+	session.Symptoms, session.StartDate = concern.Symptoms, concern.StartDate
+
+	now := time.Now()
+	var state triage.State
+	if verdict := tc.Safety.CheckQuestion(concern.Symptoms); verdict.Action == safety.ActionEmergency {
+		state = triage.State{Urgency: triage.Emergency}
+		for _, m := range verdict.Matches {
+			state.Reasons = append(state.Reasons, "Emergency warning sign in the described symptoms: "+m.Excerpt)
+		}
+	} else {
+		state = tc.Flow.Begin(concern)
+	}
+
+	if err := tc.save(&session, state, now); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to save triage")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusCreated, tc.view(session, state))
+}
+
+// concernOf reads the symptoms and start date of a health concerns record.
+// A description given with the request is added to the stored one.
+func concernOf(data map[string]interface{}, extra string) triage.Concern {
+	var parts []string
+	for _, key := range []string{"symptoms", "worsening_factors"} {
+		if v, ok := data[key].(string); ok && strings.TrimSpace(v) != "" {
+			parts = append(parts, strings.TrimSpace(v))
+		}
+	}
+	if extra != "" {
+		parts = append(parts, extra)
+	}
+	concern := triage.Concern{Symptoms: strings.Join(parts, ". ")}
+	if s, ok := data["start_date"].(string); ok {
+		if t, err := time.Parse("2006-01-02", s); err == nil {
+			concern.StartDate = &t
+		}
+	}
+	return concern
+}
+
+// AnswerTriage records the answer to the current question, or changes the
+// answer to an earlier one, and returns the next question or the outcome
+func (tc *TriageController) AnswerTriage(w http.ResponseWriter, r *http.Request) {
+	session, ok := tc.findSession(w, r)
+	if !ok {
+		return
+	}
+	if session.Status == models.TriageCompleted {
+		utils.RespondWithError(w, http.StatusConflict, "Triage is already completed")
+		return
+	}
+
+	var input struct {
+		QuestionID string `json:"question_id"`
+		Value      string `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	state, err := tc.replay(session)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusConflict, "The triage questions have changed; please start a new triage")
+		return
+	}
+	if state, err = tc.Flow.Answer(state, input.QuestionID, input.Value); err != nil {
+		if errors.Is(err, triage.ErrInvalidAnswer) {
+			utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		} else {
+			utils.RespondWithError(w, http.StatusConflict, "The triage questions have changed; please start a new triage")
+		}
+		return
+	}
+
+	if err := tc.save(session, state, time.Now()); err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Failed to save triage")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, tc.view(*session, state))
+}
+
+// GetTriage returns a session with its next question or outcome
+func (tc *TriageController) GetTriage(w http.ResponseWriter, r *http.Request) {
+	session, ok := tc.findSession(w, r)
+	if !ok {
+		return
+	}
+	state, _ := tc.replay(session)
+	utils.RespondWithJSON(w, http.StatusOK, tc.view(*session, state))
+}
+
+// ListTriage lists the user's triage sessions, newest first
+func (tc *TriageController) ListTriage(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+
+	var sessions []models.TriageSession
+	if err := tc.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&sessions).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving triage sessions")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, sessions)
+}
+
+// save stores the answers of a session. A finished triage is completed: its
+// urgency and summary are set and the summary is saved as a health record,
+// so the chatbot and the user's doctor can see it.
+func (tc *TriageController) save(session *models.TriageSession, state triage.State, now time.Time) error {
+	answers := state.Answers
+	if answers == nil {
+		answers = []triage.Answer{}
+	}
+	answersJSON, err := json.Marshal(answers)
+	if err != nil {
+		return err
+	}
+	session.Answers = datatypes.JSON(answersJSON)
+
+	var record *models.HealthData
+	if state.Done() {
+		session.Status = models.TriageCompleted
+		session.Urgency = state.Urgency
+		session.Summary = tc.Flow.Summary(state, now)
+		data := map[string]interface{}{
+			"type":       "triage",
+			"urgency":    state.Urgency,
+			"summary":    session.Summary,
+			"answers":    answers,
+			"reasons":    state.Reasons,
+			"session_id": session.ID,
+			"date":       now.Format("2006-01-02"),
+		}
+		if session.ConcernID != nil {
+			data["concern_id"] = session.ConcernID
+		}
+		dataJSON, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		record = &models.HealthData{ID: uuid.New(), UserID: session.UserID, Data: datatypes.JSON(dataJSON)}
+		session.RecordID = &record.ID
+	}
+
+	err = tc.DB.Transaction(func(tx *gorm.DB) error {
+		if record != nil {
+			if err := tx.Create(record).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(session).Error
+	})
+	if err != nil {
+		return err
+	}
+	if record != nil {
+		tc.Records.IndexAsync(*record)
+	}
+	return nil
+}
+
+// replay rebuilds the state of a session from its answers
+func (tc *TriageController) replay(session *models.TriageSession) (triage.State, error) {
+	var answers []triage.Answer
+	if err := json.Unmarshal(session.Answers, &answers); err != nil {
+		return triage.State{}, err
+	}
+	return tc.Flow.Replay(triage.Concern{Symptoms: session.Symptoms, StartDate: session.StartDate}, answers)
+}
+
+func (tc *TriageController) view(session models.TriageSession, state triage.State) triageView {
+	v := triageView{TriageSession: session}
+	if session.Status == models.TriageCompleted {
+		v.Advice = tc.Flow.Outcome(session.Urgency).Advice
+		if state.Urgency == session.Urgency {
+			v.Reasons = state.Reasons
+		}
+	} else if state.Current != nil {
+		v.Question = state.Current.Step()
+	}
+	return v
+}
+
+// findSession loads the triage session named in the URL if it belongs to the user
+func (tc *TriageController) findSession(w http.ResponseWriter, r *http.Request) (*models.TriageSession, bool) {
+	userID := r.Context().Value("user_id").(string)
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid triage ID format")
+		return nil, false
+	}
+	var session models.TriageSession
+	if err := tc.DB.Where("id = ? AND user_id = ?", id, userID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.RespondWithError(w, http.StatusNotFound, "Triage not found")
+		} else {
+			utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving triage")
+		}
+		return nil, false
+	}
+	return &session, true
+}
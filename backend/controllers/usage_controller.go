@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend/models"
+	"backend/usage"
+	"backend/utils"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type UsageController struct {
+	DB    *gorm.DB
+	Meter *usage.Meter
+}
+
+func NewUsageController(db *gorm.DB) *UsageController {
+	return &UsageController{DB: db, Meter: usage.FromEnv(db)}
+}
+
+// GetUsage returns the user's assistant usage today and this month against
+// their budget
+func (uc *UsageController) GetUsage(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.Context().Value("user_id").(string))
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid user ID format")
+		return
+	}
+	status, err := uc.Meter.Status(r.Context(), userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving usage")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, status)
+}
+
+// usageRow is one group of a usage report. Only the grouped by columns are
+// set.
+type usageRow struct {
+	UserID           *uuid.UUID `json:"user_id,omitempty"`
+	Email            string     `json:"email,omitempty"`
+	Day              *time.Time `json:"day,omitempty"`
+	Feature          string     `json:"feature,omitempty"`
+	Model            string     `json:"model,omitempty"`
+	Calls            int64      `json:"calls"`
+	PromptTokens     int64      `json:"prompt_tokens"`
+	CompletionTokens int64      `json:"completion_tokens"`
+	AvgLatencyMs     float64    `json:"avg_latency_ms"`
+	Cost             float64    `json:"cost"`
+}
+
+// usageGroups are the columns a report can be grouped by
+var usageGroups = map[string][]string{
+	"user":    {"ud.user_id", "u.email"},
+	"day":     {"ud.day"},
+	"feature": {"ud.feature"},
+	"model":   {"ud.model"},
+}
+
+// UsageReport totals generator, embedding and retrieval usage from the
+// daily totals. group_by is a comma separated list of user, day, feature
+// and model (default day); filters are user_id, feature, model, and from
+// and to (YYYY-MM-DD, inclusive, default the last 30 days). Rows are
+// ordered by day, then by cost.
+func (uc *UsageController) UsageReport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	query := uc.DB.Table("usage_days ud")
+
+	groupBy := q.Get("group_by")
+	if groupBy == "" {
+		groupBy = "day"
+	}
+	var columns []string
+	byDay, byUser := false, false
+	for _, g := range strings.Split(groupBy, ",") {
+		g = strings.TrimSpace(g)
+		cols, ok := usageGroups[g]
+		if !ok {
+			utils.RespondWithError(w, http.StatusBadRequest, "group_by must list user, day, feature or model")
+			return
+		}
+		columns = append(columns, cols...)
+		byDay, byUser = byDay || g == "day", byUser || g == "user"
+	}
+	if byUser {
+		query = query.Joins("LEFT JOIN users u ON u.id = ud.user_id")
+	}
+
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, -29)
+	for _, bound := range []struct {
+		param string
+		day   *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		v := q.Get(bound.param)
+		if v == "" {
+			continue
+		}
+		day, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid "+bound.param+" date, use YYYY-MM-DD")
+			return
+		}
+		*bound.day = day
+	}
+	query = query.Where("ud.day >= ? AND ud.day <= ?", from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if v := q.Get("user_id"); v != "" {
+		userID, err := uuid.Parse(v)
+		if err != nil {
+			utils.RespondWithError(w, http.StatusBadRequest, "Invalid user ID format")
+			return
+		}
+		query = query.Where("ud.user_id = ?", userID)
+	}
+	if feature := q.Get("feature"); feature != "" {
+		query = query.Where("ud.feature = ?", feature)
+	}
+	if model := q.Get("model"); model != "" {
+		query = query.Where("ud.model = ?", model)
+	}
+
+	order := "cost DESC"
+	if byDay {
+		order = "ud.day ASC, cost DESC"
+	}
+	var rows []usageRow
+	if err := query.Select(strings.Join(columns, ", ") + `,
+		SUM(ud.calls) AS calls, SUM(ud.prompt_tokens) AS prompt_tokens, SUM(ud.completion_tokens) AS completion_tokens,
+		COALESCE(SUM(ud.latency_ms)::float / NULLIF(SUM(ud.calls), 0), 0) AS avg_latency_ms, SUM(ud.cost) AS cost`).
+		Group(strings.Join(columns, ", ")).Order(order).
+		Limit(queryInt(r, "limit", 1000, 1, 10000)).Scan(&rows).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving usage")
+		return
+	}
+	if rows == nil {
+		rows = []usageRow{}
+	}
+	utils.RespondWithJSON(w, http.StatusOK, rows)
+}
+
+// GetUserBudget returns a user's budget and usage
+func (uc *UsageController) GetUserBudget(w http.ResponseWriter, r *http.Request) {
+	userID, ok := uc.findUser(w, r)
+	if !ok {
+		return
+	}
+	uc.respondStatus(w, r, userID)
+}
+
+// SetUserBudget sets a user's daily_tokens and monthly_cost (USD) limits.
+// 0 makes a limit unlimited and null returns it to the default.
+func (uc *UsageController) SetUserBudget(w http.ResponseWriter, r *http.Request) {
+	userID, ok := uc.findUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		DailyTokens *int64   `json:"daily_tokens"`
+		MonthlyCost *float64 `json:"monthly_cost"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if (input.DailyTokens != nil && *input.DailyTokens < 0) || (input.MonthlyCost != nil && *input.MonthlyCost < 0) {
+		utils.RespondWithError(w, http.StatusBadRequest, "Budgets cannot be negative")
+		return
+	}
+
+	budget := models.UsageBudget{UserID: userID, DailyTokens: input.DailyTokens, MonthlyCost: input.MonthlyCost}
+	if err := uc.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"daily_tokens", "monthly_cost", "updated_at"}),
+	}).Create(&budget).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error saving budget")
+		return
+	}
+	uc.respondStatus(w, r, userID)
+}
+
+func (uc *UsageController) respondStatus(w http.ResponseWriter, r *http.Request, userID uuid.UUID) {
+	status, err := uc.Meter.Status(r.Context(), userID)
+	if err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving usage")
+		return
+	}
+	utils.RespondWithJSON(w, http.StatusOK, status)
+}
+
+// findUser checks the user named in the URL exists
+func (uc *UsageController) findUser(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		utils.RespondWithError(w, http.StatusBadRequest, "Invalid user ID format")
+		return uuid.Nil, false
+	}
+	var count int64
+	if err := uc.DB.Model(&models.User{}).Where("id = ?", userID).Count(&count).Error; err != nil {
+		utils.RespondWithError(w, http.StatusInternalServerError, "Error retrieving user")
+		return uuid.Nil, false
+	}
+	if count == 0 {
+		utils.RespondWithError(w, http.StatusNotFound, "User not found")
+		return uuid.Nil, false
+	}
+	return userID, true
+}
@@ -0,0 +1,229 @@
+// eval/report.go
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Report is the outcome of one run of a suite
+type Report struct {
+	Suite     string    `json:"suite"`
+	Label     string    `json:"label"` // Names the run, e.g. the prompt or retriever change under test
+	StartedAt time.Time `json:"started_at"`
+	Generator string    `json:"generator"`
+	Graders   []string  `json:"graders"`
+	Results   []Result  `json:"results"`
+	Summary   Summary   `json:"summary"`
+}
+
+// Summary aggregates the results of a run
+type Summary struct {
+	Cases         int                     `json:"cases"`
+	Passed        int                     `json:"passed"`
+	Errors        int                     `json:"errors"`
+	PassRate      float64                 `json:"pass_rate"`
+	MeanScore     float64                 `json:"mean_score"`
+	MeanLatencyMS int64                   `json:"mean_latency_ms"`
+	Graders       map[string]GraderTotals `json:"graders"`
+}
+
+// GraderTotals counts one grader's verdicts across a run
+type GraderTotals struct {
+	Graded    int     `json:"graded"`
+	Passed    int     `json:"passed"`
+	MeanScore float64 `json:"mean_score"`
+}
+
+func summarize(results []Result) Summary {
+	s := Summary{Cases: len(results), Graders: map[string]GraderTotals{}}
+	var latency int64
+	for _, r := range results {
+		if r.Pass {
+			s.Passed++
+		}
+		if r.Error != "" {
+			s.Errors++
+		}
+		s.MeanScore += r.Score
+		latency += r.LatencyMS
+		for _, g := range r.Grades {
+			t := s.Graders[g.Grader]
+			t.Graded++
+			if g.Pass {
+				t.Passed++
+			}
+			t.MeanScore += g.Score
+			s.Graders[g.Grader] = t
+		}
+	}
+	if s.Cases > 0 {
+		s.PassRate = float64(s.Passed) / float64(s.Cases)
+		s.MeanScore /= float64(s.Cases)
+		s.MeanLatencyMS = latency / int64(s.Cases)
+	}
+	for name, t := range s.Graders {
+		t.MeanScore /= float64(t.Graded)
+		s.Graders[name] = t
+	}
+	return s
+}
+
+// LoadReport reads a report written by WriteJSON
+func LoadReport(path string) (*Report, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &report, nil
+}
+
+// WriteJSON writes the report in the form LoadReport reads
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// Change is a case whose outcome differs between two runs
+type Change struct {
+	Case       string  `json:"case"`
+	BaseScore  float64 `json:"base_score"`
+	HeadScore  float64 `json:"head_score"`
+	BasePass   bool    `json:"base_pass"`
+	HeadPass   bool    `json:"head_pass"`
+	HeadDetail string  `json:"head_detail,omitempty"` // Why the case fails now
+}
+
+// Comparison sets a run against an earlier baseline of the same suite
+type Comparison struct {
+	Base         *Report  `json:"-"`
+	Head         *Report  `json:"-"`
+	Regressions  []Change `json:"regressions"`  // Passed before and fail now, or scored lower
+	Improvements []Change `json:"improvements"` // Failed before and pass now, or scored higher
+	Added        []string `json:"added"`        // Cases only in the new run
+	Removed      []string `json:"removed"`      // Cases only in the baseline
+}
+
+// Compare matches the cases of two runs by id
+func Compare(base, head *Report) *Comparison {
+	c := &Comparison{Base: base, Head: head}
+	before := map[string]Result{}
+	for _, r := range base.Results {
+		before[r.Case] = r
+	}
+	seen := map[string]bool{}
+	for _, h := range head.Results {
+		seen[h.Case] = true
+		b, ok := before[h.Case]
+		if !ok {
+			c.Added = append(c.Added, h.Case)
+			continue
+		}
+		change := Change{Case: h.Case, BaseScore: b.Score, HeadScore: h.Score, BasePass: b.Pass, HeadPass: h.Pass,
+			HeadDetail: failures(h)}
+		switch {
+		case b.Pass && !h.Pass, b.Pass == h.Pass && h.Score < b.Score-0.001:
+			c.Regressions = append(c.Regressions, change)
+		case !b.Pass && h.Pass, b.Pass == h.Pass && h.Score > b.Score+0.001:
+			c.Improvements = append(c.Improvements, change)
+		}
+	}
+	for _, b := range base.Results {
+		if !seen[b.Case] {
+			c.Removed = append(c.Removed, b.Case)
+		}
+	}
+	sort.Strings(c.Added)
+	sort.Strings(c.Removed)
+	return c
+}
+
+// failures describes why a result did not pass
+func failures(r Result) string {
+	if r.Error != "" {
+		return "error: " + r.Error
+	}
+	var parts []string
+	for _, g := range r.Grades {
+		if !g.Pass {
+			parts = append(parts, g.Grader+": "+g.Detail)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// WriteMarkdown writes a report of the run, compared with the baseline
+// when there is one
+func WriteMarkdown(w io.Writer, head *Report, c *Comparison) {
+	fmt.Fprintf(w, "# Evaluation: %s\n\n", head.Suite)
+	fmt.Fprintf(w, "Run %s on %s with %s.\n\n", or(head.Label, "(unlabelled)"), head.StartedAt.Format(time.RFC3339), head.Generator)
+
+	fmt.Fprintln(w, "| Metric | Baseline | This run | Change |")
+	fmt.Fprintln(w, "|---|---|---|---|")
+	metric := func(name string, head float64, base func(Summary) float64, format string) {
+		if c == nil {
+			fmt.Fprintf(w, "| %s | | "+format+" | |\n", name, head)
+			return
+		}
+		b := base(c.Base.Summary)
+		fmt.Fprintf(w, "| %s | "+format+" | "+format+" | %+.3g |\n", name, b, head, head-b)
+	}
+	s := head.Summary
+	metric("Pass rate (%)", 100*s.PassRate, func(s Summary) float64 { return 100 * s.PassRate }, "%.1f")
+	metric("Mean score", s.MeanScore, func(s Summary) float64 { return s.MeanScore }, "%.3f")
+	metric("Mean latency (ms)", float64(s.MeanLatencyMS), func(s Summary) float64 { return float64(s.MeanLatencyMS) }, "%.0f")
+	metric("Errors", float64(s.Errors), func(s Summary) float64 { return float64(s.Errors) }, "%.0f")
+	for _, name := range head.Graders {
+		t := s.Graders[name]
+		metric("Grader "+name, t.MeanScore, func(s Summary) float64 { return s.Graders[name].MeanScore }, "%.3f")
+	}
+	fmt.Fprintln(w)
+
+	if c != nil {
+		changes := func(title string, list []Change) {
+			if len(list) == 0 {
+				return
+			}
+			fmt.Fprintf(w, "## %s (%d)\n\n", title, len(list))
+			for _, ch := range list {
+				fmt.Fprintf(w, "- `%s` %.2f → %.2f", ch.Case, ch.BaseScore, ch.HeadScore)
+				if ch.HeadDetail != "" {
+					fmt.Fprintf(w, ": %s", ch.HeadDetail)
+				}
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintln(w)
+		}
+		changes("Regressions", c.Regressions)
+		changes("Improvements", c.Improvements)
+		if len(c.Added) > 0 {
+			fmt.Fprintf(w, "New cases: %s\n\n", strings.Join(c.Added, ", "))
+		}
+		if len(c.Removed) > 0 {
+			fmt.Fprintf(w, "Removed cases: %s\n\n", strings.Join(c.Removed, ", "))
+		}
+	}
+
+	fmt.Fprintln(w, "## Failing cases")
+	fmt.Fprintln(w)
+	failing := 0
+	for _, r := range head.Results {
+		if !r.Pass {
+			failing++
+			fmt.Fprintf(w, "- `%s`: %s\n", r.Case, failures(r))
+		}
+	}
+	if failing == 0 {
+		fmt.Fprintln(w, "None.")
+	}
+}
@@ -0,0 +1,214 @@
+// eval/runner.go
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"backend/chatbot"
+	"backend/labs"
+	"backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Result is the answer to one case and its grades
+type Result struct {
+	Case      string             `json:"case"`
+	Question  string             `json:"question"`
+	Answer    string             `json:"answer"`
+	Citations []chatbot.Citation `json:"citations"`
+	Safety    string             `json:"safety,omitempty"`
+	Prompt    string             `json:"prompt,omitempty"` // Prompt version the answer was generated with
+	LatencyMS int64              `json:"latency_ms"`
+	Error     string             `json:"error,omitempty"`
+	Grades    []Grade            `json:"grades"`
+	Pass      bool               `json:"pass"`  // Answered and every grade passed
+	Score     float64            `json:"score"` // Mean grade score
+}
+
+// Runner asks a suite's questions through the chatbot service, the same
+// pipeline AskChatbot uses, on behalf of synthetic patients it creates and
+// removes again
+type Runner struct {
+	DB      *gorm.DB
+	Service *chatbot.Service
+	Graders []Grader
+	Timeout time.Duration // Per question
+	Keep    bool          // Leave the synthetic patients in the database
+}
+
+// Run answers and grades every case of suite
+func (r *Runner) Run(ctx context.Context, suite *Suite, label string) (*Report, error) {
+	report := &Report{
+		Suite:     suite.Name,
+		Label:     label,
+		StartedAt: time.Now(),
+		Generator: r.Service.Generator.Name(),
+	}
+	for _, g := range r.Graders {
+		report.Graders = append(report.Graders, g.Name())
+	}
+
+	users, err := r.seed(ctx, suite)
+	if !r.Keep {
+		defer r.cleanup(users)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range suite.Cases {
+		result := r.runCase(ctx, c, users[c.Patient])
+		status := "FAIL"
+		if result.Pass {
+			status = "pass"
+		}
+		log.Printf("%s %s (%d ms) %s", status, c.ID, result.LatencyMS, result.Error)
+		report.Results = append(report.Results, result)
+	}
+	report.Summary = summarize(report.Results)
+	return report, nil
+}
+
+func (r *Runner) runCase(ctx context.Context, c Case, userID uuid.UUID) Result {
+	result := Result{Case: c.ID, Question: c.Question, Citations: []chatbot.Citation{}, Grades: []Grade{}}
+
+	cctx, cancel := context.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+	start := time.Now()
+	answer, err := r.Service.Ask(cctx, chatbot.Request{UserID: userID, Question: c.Question})
+	result.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Answer, result.Citations, result.Safety = answer.GeneratedText, answer.Citations, answer.Safety
+	result.Prompt = answer.PromptVersion
+
+	result.Pass = true
+	for _, g := range r.Graders {
+		grade, ok := g.Grade(ctx, c, &result)
+		if !ok {
+			continue
+		}
+		result.Grades = append(result.Grades, grade)
+		result.Score += grade.Score
+		result.Pass = result.Pass && grade.Pass
+	}
+	if len(result.Grades) > 0 {
+		result.Score /= float64(len(result.Grades))
+	} else {
+		result.Score = 1
+	}
+	return result
+}
+
+// seed creates a user for each patient, and one without records for cases
+// that name no patient. Records are stored the way uploads store them.
+func (r *Runner) seed(ctx context.Context, suite *Suite) (map[string]uuid.UUID, error) {
+	users := map[string]uuid.UUID{}
+	run := uuid.New().String()[:8]
+	patients := append([]Patient{{ID: ""}}, suite.Patients...)
+
+	for _, p := range patients {
+		user := models.User{
+			ID:    uuid.New().String(),
+			Name:  p.Name,
+			Email: fmt.Sprintf("eval-%s-%s@eval.invalid", run, or(p.ID, "anonymous")),
+			// Not a bcrypt hash, so nobody can log in as a synthetic patient
+			Password: "!",
+			Gender:   p.Gender,
+			Height:   p.Height,
+			Weight:   p.Weight,
+		}
+		if user.Name == "" {
+			user.Name = "Eval Patient"
+		}
+		if p.BirthDate != "" {
+			birth, err := time.Parse("2006-01-02", p.BirthDate)
+			if err != nil {
+				return users, fmt.Errorf("patient %s: invalid birth_date: %w", p.ID, err)
+			}
+			user.BirthDate = &birth
+		}
+		if err := r.DB.Create(&user).Error; err != nil {
+			return users, fmt.Errorf("creating patient %s: %w", p.ID, err)
+		}
+		userID := uuid.MustParse(user.ID)
+		users[p.ID] = userID
+
+		for i, record := range p.Records {
+			if err := r.storeRecord(ctx, userID, record); err != nil {
+				return users, fmt.Errorf("patient %s record %d: %w", p.ID, i+1, err)
+			}
+		}
+	}
+	return users, nil
+}
+
+func (r *Runner) storeRecord(ctx context.Context, userID uuid.UUID, record map[string]interface{}) error {
+	// Round trip through JSON so numbers are float64, as in a request body
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	healthData := models.HealthData{ID: uuid.New(), UserID: userID, Data: datatypes.JSON(data)}
+	var observations []models.Observation
+	if fields["type"] != "health_concerns" {
+		observations = labs.ExtractFields(userID, healthData.ID, fields, time.Now())
+	}
+	if err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&healthData).Error; err != nil {
+			return err
+		}
+		if len(observations) > 0 {
+			return tx.Create(&observations).Error
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	// Index now rather than in the background, so the first question sees it
+	if r.Service.Records != nil {
+		return r.Service.Records.Index(ctx, healthData)
+	}
+	return nil
+}
+
+// cleanup removes the synthetic patients and everything stored for them
+func (r *Runner) cleanup(users map[string]uuid.UUID) {
+	ids := make([]uuid.UUID, 0, len(users))
+	for _, id := range users {
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return
+	}
+	for _, table := range []string{"feedbacks", "safety_events", "messages", "conversations",
+		"record_chunks", "observations", "health_data", "usage_events", "usage_days"} {
+		if err := r.DB.Exec("DELETE FROM "+table+" WHERE user_id IN ?", ids).Error; err != nil {
+			log.Printf("eval: cleaning up %s: %v", table, err)
+		}
+	}
+	if err := r.DB.Where("id IN ?", ids).Delete(&models.User{}).Error; err != nil {
+		log.Printf("eval: cleaning up users: %v", err)
+	}
+}
+
+func or(v, fallback string) string {
+	if v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,110 @@
+// eval/suite.go
+package eval
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Suite is a set of questions asked on behalf of synthetic patients
+type Suite struct {
+	Name     string    `yaml:"name"`
+	Patients []Patient `yaml:"patients"`
+	Cases    []Case    `yaml:"cases"`
+}
+
+// Patient is a synthetic user. Records are stored like uploads: a record
+// with extracted_text like a scanned report, type health_concerns like the
+// concerns form, anything else like AddHealthData.
+type Patient struct {
+	ID        string                   `yaml:"id"`
+	Name      string                   `yaml:"name"`
+	Gender    string                   `yaml:"gender"`
+	BirthDate string                   `yaml:"birth_date"` // YYYY-MM-DD
+	Height    float64                  `yaml:"height"`     // cm
+	Weight    float64                  `yaml:"weight"`     // kg
+	Records   []map[string]interface{} `yaml:"records"`
+}
+
+// Case is one question and what a good answer looks like
+type Case struct {
+	ID       string `yaml:"id" json:"id"`
+	Patient  string `yaml:"patient" json:"patient"`
+	Question string `yaml:"question" json:"question"`
+	Expect   Expect `yaml:"expect" json:"expect"`
+}
+
+// Expect holds the checks of a case. Each grader looks at its own fields
+// and skips cases that do not set them.
+type Expect struct {
+	Contains    []string               `yaml:"contains" json:"contains,omitempty"` // Case-insensitive substrings
+	NotContains []string               `yaml:"not_contains" json:"not_contains,omitempty"`
+	Matches     []string               `yaml:"matches" json:"matches,omitempty"` // Regular expressions
+	Citations   *CitationsExpect       `yaml:"citations" json:"citations,omitempty"`
+	Safety      string                 `yaml:"safety" json:"safety,omitempty"` // emergency, refuse, disclaimer or none
+	Judge       string                 `yaml:"judge" json:"judge,omitempty"`   // Rubric for the LLM judge
+	Extra       map[string]interface{} `yaml:",inline" json:"extra,omitempty"` // Fields of custom graders
+}
+
+// CitationsExpect checks the sources an answer cites inline
+type CitationsExpect struct {
+	Min   int      `yaml:"min" json:"min"`               // Cited sources, at least
+	Kinds []string `yaml:"kinds" json:"kinds,omitempty"` // Each kind must be cited at least once
+}
+
+// LoadSuite reads and validates a YAML suite
+func LoadSuite(path string) (*Suite, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var suite Suite
+	if err := yaml.Unmarshal(data, &suite); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := suite.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &suite, nil
+}
+
+func (s *Suite) validate() error {
+	patients := map[string]bool{}
+	for _, p := range s.Patients {
+		if p.ID == "" {
+			return fmt.Errorf("patient without id")
+		}
+		patients[p.ID] = true
+	}
+	cases := map[string]bool{}
+	for _, c := range s.Cases {
+		switch {
+		case c.ID == "":
+			return fmt.Errorf("case without id")
+		case cases[c.ID]:
+			return fmt.Errorf("duplicate case %q", c.ID)
+		case c.Question == "":
+			return fmt.Errorf("case %q has no question", c.ID)
+		case c.Patient != "" && !patients[c.Patient]:
+			return fmt.Errorf("case %q: unknown patient %q", c.ID, c.Patient)
+		}
+		cases[c.ID] = true
+		for _, m := range c.Expect.Matches {
+			if _, err := regexp.Compile(m); err != nil {
+				return fmt.Errorf("case %q: %w", c.ID, err)
+			}
+		}
+		switch c.Expect.Safety {
+		case "", "none", "emergency", "refuse", "disclaimer":
+		default:
+			return fmt.Errorf("case %q: unknown safety expectation %q", c.ID, c.Expect.Safety)
+		}
+	}
+	if len(s.Cases) == 0 {
+		return fmt.Errorf("no cases")
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+// imagecheck/imagecheck.go
+package imagecheck
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// Supported image types
+const (
+	JPEG = "image/jpeg"
+	PNG  = "image/png"
+	GIF  = "image/gif"
+)
+
+var (
+	// ErrUnsupported is returned for content that is not a supported image,
+	// whatever its name or declared type
+	ErrUnsupported = errors.New("unsupported image format, use JPEG, PNG or GIF")
+	// ErrInvalid is returned for images that are malformed or carry other
+	// content along with the image
+	ErrInvalid = errors.New("invalid image")
+	// ErrTooLarge is returned for images over their type's limits
+	ErrTooLarge = errors.New("image too large")
+)
+
+// Limit caps the size of one type of image
+type Limit struct {
+	Bytes  int64
+	Pixels int64 // Width times height, summed over the frames of a GIF
+}
+
+// Limits are checked by Check. Pixel counts bound the memory a decode can
+// take, however well the file compresses.
+var Limits = map[string]Limit{
+	JPEG: {Bytes: 10 << 20, Pixels: 40_000_000},
+	PNG:  {Bytes: 10 << 20, Pixels: 40_000_000},
+	GIF:  {Bytes: 5 << 20, Pixels: 20_000_000},
+}
+
+// Info describes a checked image
+type Info struct {
+	Type   string `json:"type"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Frames int    `json:"frames"`
+}
+
+// signatures are the leading bytes of each supported type
+var signatures = []struct {
+	magic string
+	typ   string
+}{
+	{"\xff\xd8\xff", JPEG},
+	{"\x89PNG\r\n\x1a\n", PNG},
+	{"GIF87a", GIF},
+	{"GIF89a", GIF},
+}
+
+// Detect names the type of data from its leading bytes, or returns ""
+func Detect(data []byte) string {
+	for _, s := range signatures {
+		if bytes.HasPrefix(data, []byte(s.magic)) {
+			return s.typ
+		}
+	}
+	return ""
+}
+
+// Supported reports whether typ is an image type uploads may have
+func Supported(typ string) bool {
+	_, ok := Limits[typ]
+	return ok
+}
+
+// MaxBytes is the largest size any supported type may have
+func MaxBytes() int64 {
+	var max int64
+	for _, l := range Limits {
+		if l.Bytes > max {
+			max = l.Bytes
+		}
+	}
+	return max
+}
+
+// Check verifies that data is exactly one well formed image, ignoring any
+// file name or declared type. The type comes from the magic bytes; the file
+// structure is walked to its end, so that nothing (an archive, a script) can
+// ride along after the image; the dimensions are checked against Limits
+// before anything is decoded; and finally the whole image is decoded.
+func Check(data []byte) (Info, error) {
+	info := Info{Type: Detect(data)}
+	limit, ok := Limits[info.Type]
+	if !ok {
+		return Info{}, ErrUnsupported
+	}
+	if int64(len(data)) > limit.Bytes {
+		return Info{}, fmt.Errorf("%w: %s images are limited to %d MB", ErrTooLarge, info.Type, limit.Bytes>>20)
+	}
+
+	var (
+		end    int
+		pixels int64
+		err    error
+	)
+	switch info.Type {
+	case JPEG:
+		end, err = jpegEnd(data)
+	case PNG:
+		end, err = pngEnd(data)
+	case GIF:
+		end, info.Frames, pixels, err = gifEnd(data)
+	}
+	if err != nil {
+		return Info{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if end != len(data) {
+		return Info{}, fmt.Errorf("%w: %d bytes of other data after the image", ErrInvalid, len(data)-end)
+	}
+	if found := embeddedMarkup(data); found != "" {
+		return Info{}, fmt.Errorf("%w: contains %q", ErrInvalid, found)
+	}
+
+	r := bytes.NewReader(data)
+	switch info.Type {
+	case JPEG:
+		cfg, err := jpeg.DecodeConfig(r)
+		if err != nil {
+			return Info{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		info.Width, info.Height, info.Frames = cfg.Width, cfg.Height, 1
+	case PNG:
+		cfg, err := png.DecodeConfig(r)
+		if err != nil {
+			return Info{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		info.Width, info.Height, info.Frames = cfg.Width, cfg.Height, 1
+	case GIF:
+		cfg, err := gif.DecodeConfig(r)
+		if err != nil {
+			return Info{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		info.Width, info.Height = cfg.Width, cfg.Height
+	}
+	if info.Type != GIF {
+		pixels = int64(info.Width) * int64(info.Height)
+	}
+	if info.Width == 0 || info.Height == 0 {
+		return Info{}, fmt.Errorf("%w: empty image", ErrInvalid)
+	}
+	if pixels > limit.Pixels {
+		return Info{}, fmt.Errorf("%w: %d megapixels, %s images are limited to %d", ErrTooLarge,
+			pixels/1_000_000, info.Type, limit.Pixels/1_000_000)
+	}
+
+	r.Reset(data)
+	switch info.Type {
+	case JPEG:
+		_, err = jpeg.Decode(r)
+	case PNG:
+		_, err = png.Decode(r)
+	case GIF:
+		_, err = gif.DecodeAll(r)
+	}
+	if err != nil {
+		return Info{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return info, nil
+}
+
+// markup is content a browser or server might run if the image were ever
+// served or saved under the wrong type. The strings are long enough not to
+// turn up by chance in compressed image data.
+var markup = []string{"<script", "<html", "<!doctype", "<iframe", "<?php"}
+
+// embeddedMarkup returns the first markup found in data, such as a script
+// hidden in a JPEG comment or PNG text chunk
+func embeddedMarkup(data []byte) string {
+	lower := make([]byte, len(data))
+	for i, c := range data {
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		lower[i] = c
+	}
+	for _, m := range markup {
+		if bytes.Contains(lower, []byte(m)) {
+			return m
+		}
+	}
+	return ""
+}
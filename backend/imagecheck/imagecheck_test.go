@@ -0,0 +1,91 @@
+package imagecheck
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encoded(t *testing.T, typ string, width, height int) []byte {
+	t.Helper()
+	img := image.NewPaletted(image.Rect(0, 0, width, height), color.Palette{color.Black, color.White})
+	var buf bytes.Buffer
+	var err error
+	switch typ {
+	case JPEG:
+		err = jpeg.Encode(&buf, img, nil)
+	case PNG:
+		err = png.Encode(&buf, img)
+	case GIF:
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withTextChunk inserts a PNG tEXt chunk holding text before IEND
+func withTextChunk(data []byte, text string) []byte {
+	body := append([]byte("tEXt"), "Comment\x00"+text...)
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(body)-4))
+	chunk = append(chunk, body...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(body))
+	iend := len(data) - 12
+	return append(append(append([]byte{}, data[:iend]...), chunk...), data[iend:]...)
+}
+
+func TestCheck(t *testing.T) {
+	valid := encoded(t, PNG, 4, 3)
+	tests := []struct {
+		name string
+		data []byte
+		typ  string
+		err  error
+	}{
+		{"jpeg", encoded(t, JPEG, 4, 3), JPEG, nil},
+		{"png", valid, PNG, nil},
+		{"gif", encoded(t, GIF, 4, 3), GIF, nil},
+		{"text", []byte("just some text"), "", ErrUnsupported},
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), "", ErrUnsupported},
+		{"trailing archive", append(append([]byte{}, valid...), "PK\x03\x04"...), "", ErrInvalid},
+		{"script in text chunk", withTextChunk(valid, "<script>alert(1)</script>"), "", ErrInvalid},
+		{"harmless text chunk", withTextChunk(valid, "scanned at the clinic"), PNG, nil},
+		{"truncated", valid[:len(valid)-20], "", ErrInvalid},
+	}
+	for _, tt := range tests {
+		info, err := Check(tt.data)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if info.Type != tt.typ {
+			t.Errorf("%s: type %q, want %q", tt.name, info.Type, tt.typ)
+		}
+		if err == nil && (info.Width != 4 || info.Height != 3 || info.Frames != 1) {
+			t.Errorf("%s: got %+v, want 4x3 with one frame", tt.name, info)
+		}
+	}
+}
+
+func TestCheckLimits(t *testing.T) {
+	saved := Limits[PNG]
+	t.Cleanup(func() { Limits[PNG] = saved })
+	data := encoded(t, PNG, 40, 30)
+
+	Limits[PNG] = Limit{Bytes: saved.Bytes, Pixels: 1000}
+	if _, err := Check(data); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("1200 pixels over a limit of 1000: error %v, want %v", err, ErrTooLarge)
+	}
+	Limits[PNG] = Limit{Bytes: int64(len(data)) - 1, Pixels: saved.Pixels}
+	if _, err := Check(data); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("%d bytes over a limit of %d: error %v, want %v", len(data), len(data)-1, err, ErrTooLarge)
+	}
+}
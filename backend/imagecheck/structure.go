@@ -0,0 +1,149 @@
+// imagecheck/structure.go
+package imagecheck
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var errTruncated = errors.New("truncated image")
+
+// jpegEnd walks the marker segments and entropy coded scans of a JPEG and
+// returns the offset just past its EOI marker
+func jpegEnd(data []byte) (int, error) {
+	pos := 2 // After SOI
+	for {
+		if pos >= len(data) {
+			return 0, errTruncated
+		}
+		if data[pos] != 0xff {
+			return 0, fmt.Errorf("expected a JPEG marker at offset %d", pos)
+		}
+		for pos < len(data) && data[pos] == 0xff { // Fill bytes
+			pos++
+		}
+		if pos >= len(data) {
+			return 0, errTruncated
+		}
+		marker := data[pos]
+		pos++
+		switch {
+		case marker == 0xd9: // EOI
+			return pos, nil
+		case marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7): // No payload
+			continue
+		case marker == 0xd8:
+			return 0, errors.New("nested JPEG start of image")
+		}
+		if pos+2 > len(data) {
+			return 0, errTruncated
+		}
+		length := int(binary.BigEndian.Uint16(data[pos:]))
+		if length < 2 || pos+length > len(data) {
+			return 0, errTruncated
+		}
+		pos += length
+		if marker != 0xda { // Only SOS is followed by entropy coded data
+			continue
+		}
+		// Scan data runs to the next marker; 0xff00 is an escaped 0xff and
+		// restart markers stay within the scan
+		for {
+			if pos+1 >= len(data) {
+				return 0, errTruncated
+			}
+			if data[pos] == 0xff {
+				next := data[pos+1]
+				if next == 0x00 || (next >= 0xd0 && next <= 0xd7) {
+					pos += 2
+					continue
+				}
+				if next != 0xff {
+					break
+				}
+			}
+			pos++
+		}
+	}
+}
+
+// pngEnd walks the chunks of a PNG and returns the offset just past its
+// IEND chunk
+func pngEnd(data []byte) (int, error) {
+	pos := 8 // After the signature
+	for {
+		if pos+12 > len(data) {
+			return 0, errTruncated
+		}
+		length := int64(binary.BigEndian.Uint32(data[pos:]))
+		typ := string(data[pos+4 : pos+8])
+		end := int64(pos) + 12 + length
+		if end > int64(len(data)) {
+			return 0, errTruncated
+		}
+		pos = int(end)
+		if typ == "IEND" {
+			return pos, nil
+		}
+	}
+}
+
+// gifEnd walks the blocks of a GIF and returns the offset just past its
+// trailer, with the number of frames and the pixels they cover
+func gifEnd(data []byte) (end, frames int, pixels int64, err error) {
+	if len(data) < 13 {
+		return 0, 0, 0, errTruncated
+	}
+	pos := 13 // After the header and logical screen descriptor
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << ((flags & 7) + 1) // Global color table
+	}
+	for {
+		if pos >= len(data) {
+			return 0, 0, 0, errTruncated
+		}
+		switch data[pos] {
+		case 0x3b: // Trailer
+			return pos + 1, frames, pixels, nil
+		case 0x21: // Extension: introducer, label, sub-blocks
+			if pos, err = gifSubBlocks(data, pos+2); err != nil {
+				return 0, 0, 0, err
+			}
+		case 0x2c: // Image descriptor
+			if pos+10 > len(data) {
+				return 0, 0, 0, errTruncated
+			}
+			width := int64(binary.LittleEndian.Uint16(data[pos+5:]))
+			height := int64(binary.LittleEndian.Uint16(data[pos+7:]))
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << ((flags & 7) + 1) // Local color table
+			}
+			pos++ // LZW minimum code size
+			if pos, err = gifSubBlocks(data, pos); err != nil {
+				return 0, 0, 0, err
+			}
+			frames++
+			pixels += width * height
+		default:
+			return 0, 0, 0, fmt.Errorf("unknown GIF block 0x%02x at offset %d", data[pos], pos)
+		}
+	}
+}
+
+// gifSubBlocks skips a run of data sub-blocks and its terminator
+func gifSubBlocks(data []byte, pos int) (int, error) {
+	for {
+		if pos >= len(data) {
+			return 0, errTruncated
+		}
+		n := int(data[pos])
+		pos++
+		if n == 0 {
+			return pos, nil
+		}
+		pos += n
+	}
+}
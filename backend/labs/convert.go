@@ -0,0 +1,101 @@
+// labs/convert.go
+package labs
+
+import (
+	"backend/models"
+	"backend/units"
+)
+
+// Substance returns the conversion data for an analyte
+func (a *Analyte) Substance() units.Substance {
+	sub := units.Substance{MolarMass: a.MolarMass, Valence: a.Valence}
+	if a.Code == "4548-4" {
+		sub.Custom = convertHbA1c
+	}
+	return sub
+}
+
+// convertHbA1c maps NGSP percent to IFCC mmol/mol using the master equation
+func convertHbA1c(value float64, from, to string) (float64, bool) {
+	switch {
+	case from == "%" && to == "mmol/mol":
+		return (value - 2.152) * 10.929, true
+	case from == "mmol/mol" && to == "%":
+		return value/10.929 + 2.152, true
+	}
+	return 0, false
+}
+
+// Convert converts a value of this analyte between two units
+func (a *Analyte) Convert(value float64, from, to string) (float64, error) {
+	return units.ConvertFor(value, from, to, a.Substance())
+}
+
+// Normalize rewrites an observation into its analyte's conventional unit,
+// keeping the value as printed in ReportedValue / ReportedUnit. Observations
+// of unknown tests, or in units we cannot convert, keep the reported unit.
+func Normalize(obs *models.Observation) {
+	obs.ReportedValue = obs.Value
+	obs.ReportedUnit = obs.Unit
+	obs.Unit = units.Normalize(obs.Unit)
+
+	a, ok := ByCode(obs.Code)
+	if !ok || obs.Unit == a.Unit {
+		return
+	}
+	value, err := a.Convert(obs.Value, obs.Unit, a.Unit)
+	if err != nil {
+		return
+	}
+	obs.Value = units.Round(value, 3)
+	obs.RefLow = ConvertBound(a, obs.RefLow, obs.Unit, a.Unit)
+	obs.RefHigh = ConvertBound(a, obs.RefHigh, obs.Unit, a.Unit)
+	obs.Unit = a.Unit
+}
+
+// DisplayUnit is the unit an analyte is shown in for the given preferences
+func (a *Analyte) DisplayUnit(prefs units.Preferences) string {
+	if prefs.System == units.Imperial && a.Imperial != "" {
+		return a.Imperial
+	}
+	if prefs.LabUnits == units.SI && a.SIUnit != "" {
+		return a.SIUnit
+	}
+	return a.Unit
+}
+
+// Localize converts observations to the units a user prefers for display
+func Localize(observations []models.Observation, prefs units.Preferences) {
+	for i := range observations {
+		obs := &observations[i]
+		a, ok := ByCode(obs.Code)
+		if !ok || obs.Unit != a.Unit {
+			continue
+		}
+		to := a.DisplayUnit(prefs)
+		if to == a.Unit {
+			continue
+		}
+		value, err := a.Convert(obs.Value, a.Unit, to)
+		if err != nil {
+			continue
+		}
+		obs.Value = units.Round(value, 3)
+		obs.RefLow = ConvertBound(a, obs.RefLow, a.Unit, to)
+		obs.RefHigh = ConvertBound(a, obs.RefHigh, a.Unit, to)
+		obs.Unit = to
+	}
+}
+
+// ConvertBound converts an optional range bound, dropping it if impossible
+func ConvertBound(a *Analyte, bound *float64, from, to string) *float64 {
+	if bound == nil {
+		return nil
+	}
+	v, err := a.Convert(*bound, from, to)
+	if err != nil {
+		return nil
+	}
+	v = units.Round(v, 3)
+	return &v
+}
@@ -0,0 +1,210 @@
+// labs/dictionary.go
+package labs
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"backend/units"
+)
+
+// Analyte describes a test in the local LOINC-like dictionary
+type Analyte struct {
+	Code      string   `json:"code"`                    // LOINC code
+	Name      string   `json:"name"`                    // Canonical display name
+	Unit      string   `json:"unit"`                    // Conventional unit, values are stored in it
+	SIUnit    string   `json:"si_unit,omitempty"`       // Unit shown to users who prefer SI
+	Imperial  string   `json:"imperial_unit,omitempty"` // Unit shown to users of the imperial system (vitals)
+	MolarMass float64  `json:"-"`                       // g/mol, for mass <-> molar conversion
+	Valence   int      `json:"-"`                       // For mEq/L
+	Aliases   []string `json:"aliases"`                 // Names seen on lab reports, lower case
+	RefLow    *float64 `json:"ref_low,omitempty"`       // Typical adult reference range in Unit,
+	RefHigh   *float64 `json:"ref_high,omitempty"`      // used when a report does not print one
+}
+
+// dictionary lists the tests we recognize on uploaded reports
+var dictionary = []Analyte{
+	{Code: "2345-7", Name: "Glucose", Unit: "mg/dL", SIUnit: "mmol/L", MolarMass: 180.156, Aliases: []string{"glucose", "blood glucose", "blood sugar", "glucose serum", "glucose plasma", "random blood sugar", "rbs"}},
+	{Code: "1558-6", Name: "Fasting glucose", Unit: "mg/dL", SIUnit: "mmol/L", MolarMass: 180.156, Aliases: []string{"fasting glucose", "glucose fasting", "fasting blood sugar", "fbs", "fasting plasma glucose", "fpg"}},
+	{Code: "4548-4", Name: "Hemoglobin A1c", Unit: "%", SIUnit: "mmol/mol", Aliases: []string{"hba1c", "hb a1c", "a1c", "hemoglobin a1c", "haemoglobin a1c", "glycated hemoglobin", "glycosylated hemoglobin", "glycated haemoglobin"}},
+	{Code: "2093-3", Name: "Total cholesterol", Unit: "mg/dL", SIUnit: "mmol/L", MolarMass: 386.65, Aliases: []string{"cholesterol", "total cholesterol", "cholesterol total", "serum cholesterol"}},
+	{Code: "13457-7", Name: "LDL cholesterol", Unit: "mg/dL", SIUnit: "mmol/L", MolarMass: 386.65, Aliases: []string{"ldl", "ldl cholesterol", "ldl c", "ldl-c", "cholesterol ldl", "ldl calculated", "low density lipoprotein"}},
+	{Code: "2085-9", Name: "HDL cholesterol", Unit: "mg/dL", SIUnit: "mmol/L", MolarMass: 386.65, Aliases: []string{"hdl", "hdl cholesterol", "hdl c", "hdl-c", "cholesterol hdl", "high density lipoprotein"}},
+	{Code: "2571-8", Name: "Triglycerides", Unit: "mg/dL", SIUnit: "mmol/L", MolarMass: 885.7, Aliases: []string{"triglycerides", "triglyceride", "tg", "trigs"}},
+	{Code: "2160-0", Name: "Creatinine", Unit: "mg/dL", SIUnit: "umol/L", MolarMass: 113.12, Aliases: []string{"creatinine", "serum creatinine", "creatinine serum", "creat"}},
+	{Code: "33914-3", Name: "eGFR", Unit: "mL/min/1.73m2", Aliases: []string{"egfr", "estimated gfr", "gfr estimated", "glomerular filtration rate"}},
+	{Code: "3094-0", Name: "Urea nitrogen", Unit: "mg/dL", SIUnit: "mmol/L", MolarMass: 28.014, Aliases: []string{"bun", "blood urea nitrogen", "urea nitrogen", "urea"}},
+	{Code: "3084-1", Name: "Uric acid", Unit: "mg/dL", SIUnit: "umol/L", MolarMass: 168.11, Aliases: []string{"uric acid", "serum uric acid", "urate"}},
+	{Code: "2951-2", Name: "Sodium", Unit: "mmol/L", SIUnit: "mmol/L", MolarMass: 22.99, Valence: 1, Aliases: []string{"sodium", "na", "serum sodium"}},
+	{Code: "2823-3", Name: "Potassium", Unit: "mmol/L", SIUnit: "mmol/L", MolarMass: 39.098, Valence: 1, Aliases: []string{"potassium", "k", "serum potassium"}},
+	{Code: "2075-0", Name: "Chloride", Unit: "mmol/L", SIUnit: "mmol/L", MolarMass: 35.45, Valence: 1, Aliases: []string{"chloride", "cl", "serum chloride"}},
+	{Code: "17861-6", Name: "Calcium", Unit: "mg/dL", SIUnit: "mmol/L", MolarMass: 40.078, Valence: 2, Aliases: []string{"calcium", "ca", "serum calcium", "calcium total"}},
+	{Code: "1742-6", Name: "ALT", Unit: "U/L", Aliases: []string{"alt", "sgpt", "alanine aminotransferase", "alt sgpt", "sgpt alt"}},
+	{Code: "1920-8", Name: "AST", Unit: "U/L", Aliases: []string{"ast", "sgot", "aspartate aminotransferase", "ast sgot", "sgot ast"}},
+	{Code: "6768-6", Name: "Alkaline phosphatase", Unit: "U/L", Aliases: []string{"alkaline phosphatase", "alp", "alk phos"}},
+	{Code: "1975-2", Name: "Total bilirubin", Unit: "mg/dL", SIUnit: "umol/L", MolarMass: 584.66, Aliases: []string{"bilirubin", "total bilirubin", "bilirubin total", "t bilirubin"}},
+	{Code: "1751-7", Name: "Albumin", Unit: "g/dL", SIUnit: "g/L", Aliases: []string{"albumin", "serum albumin"}},
+	{Code: "2885-2", Name: "Total protein", Unit: "g/dL", SIUnit: "g/L", Aliases: []string{"total protein", "protein total", "serum protein"}},
+	{Code: "718-7", Name: "Hemoglobin", Unit: "g/dL", SIUnit: "g/L", Aliases: []string{"hemoglobin", "haemoglobin", "hb", "hgb"}},
+	{Code: "4544-3", Name: "Hematocrit", Unit: "%", SIUnit: "L/L", Aliases: []string{"hematocrit", "haematocrit", "hct", "pcv", "packed cell volume"}},
+	{Code: "789-8", Name: "Red blood cells", Unit: "10*6/uL", SIUnit: "10*12/L", Aliases: []string{"rbc", "rbc count", "red blood cells", "red blood cell count", "erythrocytes"}},
+	{Code: "6690-2", Name: "White blood cells", Unit: "10*3/uL", SIUnit: "10*9/L", Aliases: []string{"wbc", "wbc count", "white blood cells", "white blood cell count", "total leucocyte count", "total leukocyte count", "tlc", "leukocytes"}},
+	{Code: "777-3", Name: "Platelets", Unit: "10*3/uL", SIUnit: "10*9/L", Aliases: []string{"platelets", "platelet count", "plt", "thrombocytes"}},
+	{Code: "787-2", Name: "MCV", Unit: "fL", Aliases: []string{"mcv", "mean corpuscular volume"}},
+	{Code: "3016-3", Name: "TSH", Unit: "mIU/L", Aliases: []string{"tsh", "thyroid stimulating hormone", "thyrotropin"}},
+	{Code: "3024-7", Name: "Free T4", Unit: "ng/dL", SIUnit: "pmol/L", MolarMass: 776.87, Aliases: []string{"free t4", "ft4", "t4 free", "free thyroxine"}},
+	{Code: "1989-3", Name: "Vitamin D (25-OH)", Unit: "ng/mL", SIUnit: "nmol/L", MolarMass: 400.64, Aliases: []string{"vitamin d", "25 oh vitamin d", "25 hydroxy vitamin d", "vitamin d 25 hydroxy", "vit d", "25(oh)d"}},
+	{Code: "2132-9", Name: "Vitamin B12", Unit: "pg/mL", SIUnit: "pmol/L", MolarMass: 1355.37, Aliases: []string{"vitamin b12", "vit b12", "b12", "cobalamin", "cyanocobalamin"}},
+	{Code: "2276-4", Name: "Ferritin", Unit: "ng/mL", SIUnit: "ug/L", Aliases: []string{"ferritin", "serum ferritin"}},
+	{Code: "2498-4", Name: "Iron", Unit: "ug/dL", SIUnit: "umol/L", MolarMass: 55.845, Aliases: []string{"iron", "serum iron"}},
+	{Code: "1988-5", Name: "C-reactive protein", Unit: "mg/L", Aliases: []string{"crp", "c reactive protein", "c-reactive protein", "hs crp", "hscrp"}},
+
+	// Vital signs, mostly entered through /api/healthdata rather than reports
+	{Code: "29463-7", Name: "Body weight", Unit: "kg", Imperial: "[lb_av]", Aliases: []string{"weight", "body weight", "wt"}},
+	{Code: "8302-2", Name: "Body height", Unit: "cm", Imperial: "[in_i]", Aliases: []string{"height", "body height", "ht"}},
+	{Code: "39156-5", Name: "BMI", Unit: "kg/m2", Aliases: []string{"bmi", "body mass index"}},
+	{Code: "8480-6", Name: "Systolic blood pressure", Unit: "mm[Hg]", Aliases: []string{"systolic", "systolic bp", "systolic blood pressure", "sbp", "bp systolic"}},
+	{Code: "8462-4", Name: "Diastolic blood pressure", Unit: "mm[Hg]", Aliases: []string{"diastolic", "diastolic bp", "diastolic blood pressure", "dbp", "bp diastolic"}},
+	{Code: "8867-4", Name: "Heart rate", Unit: "/min", Aliases: []string{"heart rate", "pulse", "pulse rate", "hr"}},
+	{Code: "9279-1", Name: "Respiratory rate", Unit: "/min", Aliases: []string{"respiratory rate", "respiration rate", "rr"}},
+	{Code: "8310-5", Name: "Body temperature", Unit: "Cel", Imperial: "[degF]", Aliases: []string{"temperature", "body temperature", "temp"}},
+	{Code: "59408-5", Name: "Oxygen saturation", Unit: "%", Aliases: []string{"spo2", "oxygen saturation", "o2 saturation", "o2 sat", "sao2"}},
+}
+
+// defaultRanges are typical adult reference ranges in each analyte's Unit;
+// nil bounds are open. Reports usually print their own range, which wins.
+var defaultRanges = map[string][2]*float64{
+	"2345-7":  {num(70), num(140)},
+	"1558-6":  {num(70), num(99)},
+	"4548-4":  {num(4), num(5.6)},
+	"2093-3":  {nil, num(200)},
+	"13457-7": {nil, num(100)},
+	"2085-9":  {num(40), nil},
+	"2571-8":  {nil, num(150)},
+	"2160-0":  {num(0.6), num(1.3)},
+	"33914-3": {num(60), nil},
+	"3094-0":  {num(7), num(20)},
+	"3084-1":  {num(3.4), num(7)},
+	"2951-2":  {num(135), num(145)},
+	"2823-3":  {num(3.5), num(5.1)},
+	"2075-0":  {num(98), num(107)},
+	"17861-6": {num(8.5), num(10.5)},
+	"1742-6":  {num(7), num(56)},
+	"1920-8":  {num(10), num(40)},
+	"6768-6":  {num(44), num(147)},
+	"1975-2":  {num(0.1), num(1.2)},
+	"1751-7":  {num(3.5), num(5)},
+	"2885-2":  {num(6), num(8.3)},
+	"718-7":   {num(12), num(17.5)},
+	"4544-3":  {num(36), num(50)},
+	"789-8":   {num(4.2), num(5.9)},
+	"6690-2":  {num(4), num(11)},
+	"777-3":   {num(150), num(400)},
+	"787-2":   {num(80), num(100)},
+	"3016-3":  {num(0.4), num(4)},
+	"3024-7":  {num(0.8), num(1.8)},
+	"1989-3":  {num(30), num(100)},
+	"2132-9":  {num(200), num(900)},
+	"2276-4":  {num(20), num(300)},
+	"2498-4":  {num(60), num(170)},
+	"1988-5":  {nil, num(10)},
+	"39156-5": {num(18.5), num(24.9)},
+	"8480-6":  {num(90), num(130)},
+	"8462-4":  {num(60), num(85)},
+	"8867-4":  {num(60), num(100)},
+	"9279-1":  {num(12), num(20)},
+	"8310-5":  {num(36.1), num(37.5)},
+	"59408-5": {num(95), nil},
+}
+
+func num(v float64) *float64 {
+	return &v
+}
+
+var (
+	aliasIndex map[string]*Analyte
+	codeIndex  map[string]*Analyte
+	aliasOrder []string // longest aliases first, for substring matching
+)
+
+func init() {
+	aliasIndex = make(map[string]*Analyte)
+	codeIndex = make(map[string]*Analyte)
+	for i := range dictionary {
+		a := &dictionary[i]
+		a.Unit = units.Normalize(a.Unit)
+		if a.SIUnit != "" {
+			a.SIUnit = units.Normalize(a.SIUnit)
+		}
+		if r, ok := defaultRanges[a.Code]; ok {
+			a.RefLow, a.RefHigh = r[0], r[1]
+		}
+		codeIndex[a.Code] = a
+		aliasIndex[normalizeName(a.Name)] = a
+		for _, alias := range a.Aliases {
+			aliasIndex[normalizeName(alias)] = a
+		}
+	}
+	for alias := range aliasIndex {
+		aliasOrder = append(aliasOrder, alias)
+	}
+	sort.Slice(aliasOrder, func(i, j int) bool {
+		if len(aliasOrder[i]) != len(aliasOrder[j]) {
+			return len(aliasOrder[i]) > len(aliasOrder[j])
+		}
+		return aliasOrder[i] < aliasOrder[j]
+	})
+}
+
+var nonAlnum = regexp.MustCompile(`[^a-z0-9]+`)
+
+// normalizeName lower-cases a test name and collapses punctuation to spaces
+func normalizeName(name string) string {
+	return strings.TrimSpace(nonAlnum.ReplaceAllString(strings.ToLower(name), " "))
+}
+
+// Lookup resolves a test name as printed on a report to a dictionary entry.
+// Exact alias matches win; otherwise the longest alias contained in the name
+// as whole words is used, so "Glucose, Fasting (Plasma)" still resolves.
+func Lookup(name string) (*Analyte, bool) {
+	norm := normalizeName(name)
+	if norm == "" {
+		return nil, false
+	}
+	if a, ok := aliasIndex[norm]; ok {
+		return a, true
+	}
+	padded := " " + norm + " "
+	for _, alias := range aliasOrder {
+		// Single letter aliases (K, Na) are only trusted as exact matches
+		if len(alias) < 3 {
+			continue
+		}
+		if strings.Contains(padded, " "+alias+" ") {
+			return aliasIndex[alias], true
+		}
+	}
+	return nil, false
+}
+
+// ByCode returns the dictionary entry for a LOINC code
+func ByCode(code string) (*Analyte, bool) {
+	a, ok := codeIndex[code]
+	return a, ok
+}
+
+// Resolve accepts either a LOINC code or any known name
+func Resolve(analyte string) (*Analyte, bool) {
+	if a, ok := ByCode(analyte); ok {
+		return a, true
+	}
+	return Lookup(analyte)
+}
+
+// Dictionary returns a copy of all known analytes
+func Dictionary() []Analyte {
+	out := make([]Analyte, len(dictionary))
+	copy(out, dictionary)
+	return out
+}
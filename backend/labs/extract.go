@@ -0,0 +1,174 @@
+// labs/extract.go
+package labs
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"backend/models"
+
+	"github.com/google/uuid"
+)
+
+// Extract parses report text into observations linked to the source record.
+// fallback is used as the effective date when the report does not print one.
+func Extract(userID, healthDataID uuid.UUID, text string, fallback time.Time) []models.Observation {
+	effectiveAt, ok := ParseDate(text)
+	if !ok {
+		effectiveAt = fallback
+	}
+	return toObservations(userID, healthDataID, Parse(text), effectiveAt)
+}
+
+// dateKeys name the fields of a structured record that hold its measurement date
+var dateKeys = []string{"date", "effective_date", "measured_at", "recorded_at", "collected_at", "start_date"}
+
+var valueWithUnit = regexp.MustCompile(`^\s*(-?\d+(?:\.\d+)?)\s*(\S.*)?$`)
+
+// ExtractFields pulls observations out of a structured /api/healthdata
+// payload, e.g. {"weight": 72.5, "weight_unit": "kg", "blood_pressure": "128/82",
+// "glucose": {"value": 6.1, "unit": "mmol/L"}, "date": "2024-05-01"}.
+// An "extracted_text" field is parsed like an uploaded report.
+func ExtractFields(userID, healthDataID uuid.UUID, data map[string]interface{}, fallback time.Time) []models.Observation {
+	effectiveAt := fallback
+	for _, key := range dateKeys {
+		if s, ok := data[key].(string); ok {
+			if t, ok := parseFieldDate(s); ok {
+				effectiveAt = t
+				break
+			}
+		}
+	}
+
+	// Walk keys in order so results are deterministic
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var results []Result
+	for _, key := range keys {
+		name := strings.ReplaceAll(key, "_", " ")
+		switch v := data[key].(type) {
+		case string:
+			if key == "extracted_text" {
+				if t, ok := ParseDate(v); ok {
+					effectiveAt = t
+				}
+				results = append(results, Parse(v)...)
+				continue
+			}
+			if n := normalizeName(name); n == "blood pressure" || n == "bp" {
+				results = append(results, BloodPressure(v)...)
+				continue
+			}
+			m := valueWithUnit.FindStringSubmatch(v)
+			if m == nil {
+				continue
+			}
+			value, _ := strconv.ParseFloat(m[1], 64)
+			if res, ok := fieldResult(name, value, firstNonEmpty(stringField(data, key+"_unit"), m[2])); ok {
+				results = append(results, res)
+			}
+		case float64:
+			if res, ok := fieldResult(name, v, stringField(data, key+"_unit")); ok {
+				results = append(results, res)
+			}
+		case map[string]interface{}:
+			value, ok := v["value"].(float64)
+			if !ok {
+				continue
+			}
+			unit, _ := v["unit"].(string)
+			if res, ok := fieldResult(name, value, unit); ok {
+				results = append(results, res)
+			}
+		}
+	}
+
+	return toObservations(userID, healthDataID, results, effectiveAt)
+}
+
+// fieldResult builds a result for a field whose name is a known analyte
+func fieldResult(name string, value float64, unit string) (Result, bool) {
+	if strings.HasSuffix(name, " unit") || strings.HasSuffix(name, " id") {
+		return Result{}, false
+	}
+	a, ok := Lookup(name)
+	if !ok {
+		return Result{}, false
+	}
+	if unit == "" {
+		unit = a.Unit
+	}
+	return Result{
+		RawName: name,
+		Analyte: a,
+		Value:   value,
+		Unit:    unit,
+	}, true
+}
+
+func stringField(data map[string]interface{}, key string) string {
+	s, _ := data[key].(string)
+	return s
+}
+
+func parseFieldDate(s string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// toObservations converts parsed results into normalized observation rows
+func toObservations(userID, healthDataID uuid.UUID, results []Result, effectiveAt time.Time) []models.Observation {
+	observations := make([]models.Observation, 0, len(results))
+	for _, res := range results {
+		obs := models.Observation{
+			ID:           uuid.New(),
+			UserID:       userID,
+			HealthDataID: healthDataID,
+			Name:         truncate(res.RawName, 100),
+			RawName:      truncate(res.RawName, 200),
+			Value:        res.Value,
+			Comparator:   res.Comparator,
+			Unit:         truncate(res.Unit, 30),
+			RefLow:       res.RefLow,
+			RefHigh:      res.RefHigh,
+			RefText:      truncate(res.RefText, 50),
+			Flag:         res.Flag,
+			EffectiveAt:  effectiveAt,
+		}
+		if res.Analyte != nil {
+			obs.Code = res.Analyte.Code
+			obs.Name = res.Analyte.Name
+		}
+		Normalize(&obs)
+		// Without a printed range, flag against the dictionary's default range
+		if obs.Flag == "" && obs.RefText == "" && res.Analyte != nil && obs.Unit == res.Analyte.Unit {
+			obs.Flag = flagFromRange(obs.Value, res.Analyte.RefLow, res.Analyte.RefHigh)
+		}
+		observations = append(observations, obs)
+	}
+	return observations
+}
+
+// truncate keeps values within their column sizes, cutting on a rune
+// boundary so the result stays valid UTF-8
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,336 @@
+// labs/parser.go
+package labs
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Result is one test result line recognized in report text
+type Result struct {
+	RawName    string
+	Analyte    *Analyte // nil when the name is not in the dictionary
+	Value      float64
+	Comparator string // "<" or ">" for values reported beyond assay limits
+	Unit       string
+	RefLow     *float64
+	RefHigh    *float64
+	RefText    string
+	Flag       string // H, L, HH, LL or A
+}
+
+const (
+	numberPattern = `\d+(?:\.\d+)?`
+	flagPattern   = `(?:HH|LL|H|L|A|High|Low|Critical|Abnormal|\*{1,2})`
+	unitPattern   = `(?:%|(?:x\s?)?10\^?\d+\s?/\s?[A-Za-zµμ]+|[A-Za-zµμ][A-Za-zµμ0-9^*.]*(?:/[A-Za-zµμ0-9^*.]+)*)`
+	rangePattern  = `(?:(?:[<>]=?|≤|≥|up\s?to)\s*` + numberPattern + `|` + numberPattern + `\s*(?:-|–|—|to)\s*` + numberPattern + `)`
+)
+
+// resultLine matches the common layouts of a result row:
+//
+//	Hemoglobin          13.5   g/dL     12.0 - 15.5
+//	Glucose, Fasting:   110 H  mg/dL    (Ref: 70-99)
+//	LDL Cholesterol     162    mg/dL    <100          High
+//	TSH                 2.1    70-99    mIU/L
+var resultLine = regexp.MustCompile(`(?i)^\s*` +
+	`(?P<name>[A-Za-z(][A-Za-z0-9 ,()/'+.\-]*?[A-Za-z0-9)])\s*[:=]?\s+` +
+	`(?P<cmp>[<>]=?|≤|≥)?\s*(?P<value>-?` + numberPattern + `)` +
+	`(?:\s*(?P<flag1>` + flagPattern + `)(?:\s|$))?` +
+	`(?:\s*(?P<unit>` + unitPattern + `))?` +
+	`(?:\s+(?P<flag2>` + flagPattern + `))?` +
+	`(?:\s*[\[(]?\s*(?:(?:ref(?:erence)?|normal|range|bio\.? ref\.?)[a-z. ]*[:=]?\s*)?(?P<range>` + rangePattern + `)\s*[\])]?)?` +
+	`(?:\s*(?P<unit2>` + unitPattern + `))?` +
+	`(?:\s+(?P<flag3>` + flagPattern + `))?\s*$`)
+
+// Parse extracts every result line it can recognize from report text.
+// Lines with names outside the dictionary are only kept when they also carry
+// a unit and a reference range, which filters out IDs, dates and addresses.
+func Parse(text string) []Result {
+	var results []Result
+	names := resultLine.SubexpNames()
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(strings.ReplaceAll(line, "\t", "  "))
+		if line == "" || len(line) > 200 {
+			continue
+		}
+		if bp := parseBloodPressure(line); bp != nil {
+			results = append(results, bp...)
+			continue
+		}
+		m := resultLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		groups := make(map[string]string, len(names))
+		for i, n := range names {
+			if n != "" {
+				groups[n] = strings.TrimSpace(m[i])
+			}
+		}
+
+		value, err := strconv.ParseFloat(groups["value"], 64)
+		if err != nil {
+			continue
+		}
+
+		res := Result{
+			RawName:    strings.TrimRight(groups["name"], " ,:-"),
+			Value:      value,
+			Comparator: normalizeComparator(groups["cmp"]),
+			Unit:       groups["unit"],
+			RefText:    groups["range"],
+		}
+		if res.Unit == "" {
+			res.Unit = groups["unit2"]
+		}
+
+		flag := firstNonEmpty(groups["flag1"], groups["flag2"], groups["flag3"])
+		// A bare "H" or "L" may have been swallowed as the unit
+		if isFlag(res.Unit) {
+			if flag == "" {
+				flag = res.Unit
+			}
+			res.Unit = groups["unit2"]
+		}
+		res.Flag = normalizeFlag(flag)
+
+		if res.RefText != "" {
+			res.RefLow, res.RefHigh = parseRange(res.RefText)
+		}
+		if res.Flag == "" {
+			res.Flag = flagFromRange(value, res.RefLow, res.RefHigh)
+		}
+
+		if a, ok := Lookup(res.RawName); ok {
+			res.Analyte = a
+			if res.Unit == "" {
+				res.Unit = a.Unit
+			}
+		} else if res.Unit == "" || res.RefText == "" {
+			continue
+		}
+
+		results = append(results, res)
+	}
+	return results
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+var flagOnly = regexp.MustCompile(`(?i)^` + flagPattern + `$`)
+
+func isFlag(s string) bool {
+	return s != "" && flagOnly.MatchString(s)
+}
+
+func normalizeComparator(cmp string) string {
+	switch cmp {
+	case "<", "<=", "≤":
+		return "<"
+	case ">", ">=", "≥":
+		return ">"
+	}
+	return ""
+}
+
+func normalizeFlag(flag string) string {
+	switch strings.ToLower(flag) {
+	case "h", "high":
+		return "H"
+	case "l", "low":
+		return "L"
+	case "hh":
+		return "HH"
+	case "ll":
+		return "LL"
+	case "a", "abnormal", "*", "**", "critical":
+		return "A"
+	}
+	return ""
+}
+
+var rangeBounds = regexp.MustCompile(`(?i)^(?:([<>]=?|≤|≥|up\s?to)\s*(` + numberPattern + `)|(` + numberPattern + `)\s*(?:-|–|—|to)\s*(` + numberPattern + `))$`)
+
+// parseRange turns "70-99", "<200" or ">40" into numeric bounds
+func parseRange(ref string) (low, high *float64) {
+	m := rangeBounds.FindStringSubmatch(strings.TrimSpace(ref))
+	if m == nil {
+		return nil, nil
+	}
+	if m[1] != "" {
+		v, _ := strconv.ParseFloat(m[2], 64)
+		if strings.HasPrefix(m[1], ">") || m[1] == "≥" {
+			return &v, nil
+		}
+		return nil, &v
+	}
+	lo, _ := strconv.ParseFloat(m[3], 64)
+	hi, _ := strconv.ParseFloat(m[4], 64)
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	return &lo, &hi
+}
+
+func flagFromRange(value float64, low, high *float64) string {
+	if high != nil && value > *high {
+		return "H"
+	}
+	if low != nil && value < *low {
+		return "L"
+	}
+	return ""
+}
+
+// datePattern matches the dates reports print: numeric, day or month first
+// or ISO, and with month names
+const datePattern = `([0-9]{1,4}[-/.][0-9A-Za-z]{1,3}[-/.][0-9]{2,4}|[A-Za-z]{3,9}\.?\s+[0-9]{1,2},?\s+[0-9]{4}|[0-9]{1,2}\s+[A-Za-z]{3,9}\.?,?\s+[0-9]{4})`
+
+// dateLabels are tried in order: the specimen collection date, then the
+// report date, then any other date that is not a birth date
+var dateLabels = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(?:collect(?:ed|ion)(?:\s+(?:date|on))?|sample\s+(?:date|drawn)|specimen\s+date|date\s+of\s+collection|drawn(?:\s+on)?)\s*[:\-]?\s*` + datePattern),
+	regexp.MustCompile(`(?i)(?:reported(?:\s+on)?|report\s+date|date\s+of\s+report)\s*[:\-]?\s*` + datePattern),
+	regexp.MustCompile(`(?i)\bdate\s*[:\-]?\s*` + datePattern),
+}
+
+// birthLabel ends the text before birth dates, e.g. "Birth Date:" or "DOB"
+var birthLabel = regexp.MustCompile(`(?i)(?:birth|dob|d\.o\.b\.?|date\s+of)\s*$`)
+
+var (
+	numericDate = regexp.MustCompile(`^([0-9]{1,4})[-/.]([0-9]{1,2})[-/.]([0-9]{2,4})$`)
+	dateLayouts = []string{
+		"02-Jan-2006", "02-Jan-06", "02/Jan/2006",
+		"Jan 2, 2006", "Jan 2 2006", "January 2, 2006", "January 2 2006",
+		"2 Jan 2006", "2 January 2006", "Jan. 2, 2006",
+	}
+)
+
+// DayFirst reads ambiguous numeric dates such as 03/04/2024 as 3 April, as
+// on most of our users' reports. LAB_DATE_ORDER=mdy reads them month first,
+// as on US reports. Dates with a day over 12 are read either way.
+var DayFirst = !strings.EqualFold(os.Getenv("LAB_DATE_ORDER"), "mdy")
+
+// ParseDate finds the specimen collection date printed on a report, or else
+// its report date, or else another date that is not a birth date
+func ParseDate(text string) (time.Time, bool) {
+	for i, label := range dateLabels {
+		for _, m := range label.FindAllStringSubmatchIndex(text, -1) {
+			if i == len(dateLabels)-1 && birthLabel.MatchString(text[:m[0]]) {
+				continue
+			}
+			if t, ok := parseDate(strings.TrimSpace(text[m[2]:m[3]])); ok {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseDate reads one printed date, refusing ones before 1900 or in the
+// future
+func parseDate(s string) (time.Time, bool) {
+	t, ok := parseNumericDate(s)
+	for _, layout := range dateLayouts {
+		if ok {
+			break
+		}
+		var err error
+		t, err = time.Parse(layout, s)
+		ok = err == nil
+	}
+	return t, ok && t.Year() > 1900 && t.Before(time.Now().Add(24*time.Hour))
+}
+
+// parseNumericDate reads year-first dates, and day and month first ones by
+// DayFirst when both readings are valid
+func parseNumericDate(s string) (time.Time, bool) {
+	m := numericDate.FindStringSubmatch(s)
+	if m == nil {
+		return time.Time{}, false
+	}
+	a, _ := strconv.Atoi(m[1])
+	b, _ := strconv.Atoi(m[2])
+	c, _ := strconv.Atoi(m[3])
+	if len(m[1]) == 4 {
+		return civilDate(a, b, c)
+	}
+	if len(m[1]) == 3 || len(m[3]) == 3 {
+		return time.Time{}, false
+	}
+	if len(m[3]) == 2 {
+		c += 2000
+		if c > time.Now().Year() {
+			c -= 100
+		}
+	}
+	day, month := a, b
+	if !DayFirst {
+		day, month = b, a
+	}
+	if t, ok := civilDate(c, month, day); ok {
+		return t, true
+	}
+	return civilDate(c, day, month) // Only one reading is a valid date
+}
+
+// civilDate builds a date, refusing out of range fields rather than
+// normalizing them
+func civilDate(year, month, day int) (time.Time, bool) {
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if t.Year() != year || int(t.Month()) != month || t.Day() != day {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+var bloodPressure = regexp.MustCompile(`(?i)^(?:blood\s+pressure|b\.?p\.?)\s*[:=]?\s*(\d{2,3})\s*/\s*(\d{2,3})\s*(?:mm\s?hg)?\s*$`)
+
+// parseBloodPressure splits "BP: 130/85 mmHg" into systolic and diastolic results
+func parseBloodPressure(line string) []Result {
+	m := bloodPressure.FindStringSubmatch(line)
+	if m == nil {
+		return nil
+	}
+	return BloodPressure(m[1] + "/" + m[2])
+}
+
+// BloodPressure reads a "systolic/diastolic" reading
+func BloodPressure(reading string) []Result {
+	parts := strings.Split(reading, "/")
+	if len(parts) != 2 {
+		return nil
+	}
+	systolic, err1 := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	diastolic, err2 := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err1 != nil || err2 != nil {
+		return nil
+	}
+
+	var results []Result
+	for _, r := range []struct {
+		code  string
+		value float64
+	}{{"8480-6", systolic}, {"8462-4", diastolic}} {
+		a, _ := ByCode(r.code)
+		results = append(results, Result{
+			RawName: a.Name,
+			Analyte: a,
+			Value:   r.value,
+			Unit:    a.Unit,
+			Flag:    flagFromRange(r.value, a.RefLow, a.RefHigh),
+		})
+	}
+	return results
+}
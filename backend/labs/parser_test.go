@@ -0,0 +1,87 @@
+package labs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		dayFirst bool
+		want     string // YYYY-MM-DD, "" when no date is found
+	}{
+		{"collection over birth date", "Name: A B\nBirth Date: 12/03/1975\nCollected: 15/01/2024", true, "2024-01-15"},
+		{"collection over report date", "Reported: 20/01/2024\nSample Date: 18/01/2024", true, "2024-01-18"},
+		{"report date", "Report Date: 2024-02-03", true, "2024-02-03"},
+		{"other date", "Date: 05.06.2023", true, "2023-06-05"},
+		{"birth date only", "DOB: 12/03/1975\nDate of Birth: 12/03/1975", true, ""},
+		{"day first", "Collected: 03/04/2024", true, "2024-04-03"},
+		{"month first", "Collected: 03/04/2024", false, "2024-03-04"},
+		{"unambiguous month first", "Collected: 01/15/2024", true, "2024-01-15"},
+		{"unambiguous day first", "Collected: 15/01/2024", false, "2024-01-15"},
+		{"month name", "Collected on: Jan 5, 2024", true, "2024-01-05"},
+		{"two digit year", "Collected: 05/06/23", true, "2023-06-05"},
+		{"invalid", "Collected: 31/31/2024", true, ""},
+		{"future", "Collected: 01/01/2999", true, ""},
+	}
+	defer func(v bool) { DayFirst = v }(DayFirst)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			DayFirst = tt.dayFirst
+			got, ok := ParseDate(tt.text)
+			if tt.want == "" {
+				if ok {
+					t.Errorf("ParseDate(%q) = %s, want no date", tt.text, got.Format("2006-01-02"))
+				}
+				return
+			}
+			want, _ := time.Parse("2006-01-02", tt.want)
+			if !ok || !got.Equal(want) {
+				t.Errorf("ParseDate(%q) = %s, %v; want %s", tt.text, got.Format("2006-01-02"), ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRows(t *testing.T) {
+	tests := []struct {
+		line      string
+		name      string
+		value     float64
+		unit      string
+		low, high float64
+		flag      string
+		hasRange  bool
+	}{
+		{"Hemoglobin          13.5   g/dL     12.0 - 15.5", "Hemoglobin", 13.5, "g/dL", 12, 15.5, "", true},
+		{"Glucose, Fasting:   110 H  mg/dL    (Ref: 70-99)", "Glucose, Fasting", 110, "mg/dL", 70, 99, "H", true},
+		{"Ferritin 120.0 ng/mL 20.0 - 300.0", "Ferritin", 120, "ng/mL", 20, 300, "", true},
+		{"Vitamin B12 1450.0 pg/mL 200.0 - 900.0", "Vitamin B12", 1450, "pg/mL", 200, 900, "H", true},
+	}
+	for _, tt := range tests {
+		results := Parse(tt.line)
+		if len(results) != 1 {
+			t.Errorf("Parse(%q) found %d results, want 1", tt.line, len(results))
+			continue
+		}
+		r := results[0]
+		if r.RawName != tt.name || r.Value != tt.value || r.Unit != tt.unit || r.Flag != tt.flag {
+			t.Errorf("Parse(%q) = %q %v %q flag %q; want %q %v %q flag %q",
+				tt.line, r.RawName, r.Value, r.Unit, r.Flag, tt.name, tt.value, tt.unit, tt.flag)
+		}
+		if tt.hasRange && (r.RefLow == nil || r.RefHigh == nil || *r.RefLow != tt.low || *r.RefHigh != tt.high) {
+			t.Errorf("Parse(%q) range = %v-%v, want %v-%v", tt.line, r.RefLow, r.RefHigh, tt.low, tt.high)
+		}
+	}
+}
+
+func TestTruncateKeepsRunes(t *testing.T) {
+	if got := truncate("10^3/µL", 5); got != "10^3/" {
+		t.Errorf("truncate = %q, want %q", got, "10^3/")
+	}
+	if got := truncate("µg", 1); got != "" {
+		t.Errorf("truncate = %q, want empty", got)
+	}
+}
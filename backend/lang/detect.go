@@ -0,0 +1,161 @@
+// lang/detect.go
+package lang
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/language"
+)
+
+// scripts maps writing systems to the language most users writing in them
+// speak. Detect prefers the user's own language when it uses the same
+// script, e.g. Marathi over Hindi for Devanagari.
+var scripts = []struct {
+	table *unicode.RangeTable
+	tag   string
+}{
+	{unicode.Devanagari, "hi"},
+	{unicode.Bengali, "bn"},
+	{unicode.Telugu, "te"},
+	{unicode.Tamil, "ta"},
+	{unicode.Kannada, "kn"},
+	{unicode.Malayalam, "ml"},
+	{unicode.Gujarati, "gu"},
+	{unicode.Gurmukhi, "pa"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Greek, "el"},
+	{unicode.Thai, "th"},
+	{unicode.Hangul, "ko"},
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Han, "zh"},
+}
+
+// stopwords are frequent function words of languages written in Latin
+// script. Words shared by several of them still count for each.
+var stopwords = map[string][]string{
+	"en": {"the", "is", "are", "what", "how", "my", "i", "and", "of", "to", "it", "do", "does", "can",
+		"should", "with", "for", "have", "this", "that", "why", "when", "which", "about", "be", "was", "me", "you"},
+	"es": {"el", "la", "los", "las", "es", "qué", "que", "cómo", "como", "mi", "mis", "y", "en", "por", "para",
+		"con", "tengo", "puedo", "debo", "está", "son", "del", "una", "un", "lo", "me", "cuál", "cuándo", "pero", "muy"},
+	"fr": {"le", "la", "les", "est", "que", "quoi", "comment", "mon", "ma", "mes", "et", "en", "pour", "avec",
+		"je", "ai", "dois", "puis", "sont", "des", "du", "une", "un", "pourquoi", "quand", "ce", "sur", "pas", "mais"},
+	"pt": {"o", "a", "os", "as", "é", "que", "como", "meu", "minha", "e", "em", "para", "com", "tenho", "posso",
+		"devo", "está", "são", "do", "da", "dos", "das", "uma", "um", "por", "quando", "mas", "não", "qual"},
+	"de": {"der", "die", "das", "ist", "was", "wie", "mein", "meine", "und", "in", "für", "mit", "ich", "habe",
+		"kann", "soll", "sind", "ein", "eine", "nicht", "warum", "wann", "zu", "bei", "auf", "es"},
+	"it": {"il", "lo", "la", "gli", "le", "è", "che", "cosa", "come", "mio", "mia", "e", "in", "per", "con",
+		"ho", "posso", "devo", "sono", "del", "della", "un", "una", "perché", "quando", "ma", "non"},
+	"nl": {"de", "het", "een", "is", "wat", "hoe", "mijn", "en", "in", "voor", "met", "ik", "heb", "kan",
+		"moet", "zijn", "van", "niet", "waarom", "wanneer", "op"},
+	"id": {"apa", "yang", "dan", "di", "saya", "untuk", "dengan", "ini", "itu", "bagaimana", "adalah", "tidak",
+		"bisa", "harus", "kenapa", "mengapa", "ke", "dari"},
+}
+
+// marks are letters that only one of the Latin script languages above uses
+var marks = map[rune]string{'ñ': "es", '¿': "es", '¡': "es", 'ß': "de", 'ã': "pt", 'õ': "pt"}
+
+var stopwordSets = func() map[string]map[string]bool {
+	sets := map[string]map[string]bool{}
+	for tag, words := range stopwords {
+		sets[tag] = map[string]bool{}
+		for _, w := range words {
+			sets[tag][w] = true
+		}
+	}
+	return sets
+}()
+
+// Detect guesses the language text is written in. Text in a non-Latin
+// script is attributed by its script; Latin text by its function words,
+// which needs a few words to be conclusive. preferred, the user's own
+// language, wins ties and anything Detect cannot tell. ok is false when the
+// result is only preferred.
+func Detect(text, preferred string) (tag string, ok bool) {
+	counts := map[string]int{}
+	letters, latin := 0, 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if unicode.Is(unicode.Latin, r) {
+			latin++
+			continue
+		}
+		for _, s := range scripts {
+			if unicode.Is(s.table, r) {
+				counts[s.tag]++
+				break
+			}
+		}
+	}
+	if letters == 0 {
+		return preferred, false
+	}
+
+	if latin*2 < letters {
+		best := ""
+		for tag, n := range counts {
+			if best == "" || n > counts[best] || (n == counts[best] && tag < best) {
+				best = tag
+			}
+		}
+		if best == "zh" && counts["ja"] > 0 {
+			best = "ja" // Japanese mixes kanji with kana
+		}
+		if preferred != "" && sameScript(best, preferred) {
+			return preferred, true
+		}
+		return best, true
+	}
+
+	scores := map[string]int{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		for tag, set := range stopwordSets {
+			if set[word] {
+				scores[tag]++
+			}
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		if tag, ok := marks[r]; ok {
+			scores[tag] += 2
+		}
+	}
+	best, second := "", 0
+	for tag, n := range scores {
+		switch {
+		case best == "" || n > scores[best] || (n == scores[best] && tag == Base(preferred)):
+			if best != "" {
+				second = scores[best]
+			}
+			best = tag
+		case n > second:
+			second = n
+		}
+	}
+	if best == "" || scores[best] < 2 || scores[best] == second {
+		return preferred, false
+	}
+	if preferred != "" && Base(preferred) == best {
+		return preferred, true // Keep the user's region, e.g. pt-BR
+	}
+	return best, true
+}
+
+// sameScript reports whether two languages are usually written in the same
+// script
+func sameScript(a, b string) bool {
+	ta, errA := language.Parse(a)
+	tb, errB := language.Parse(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	sa, _ := ta.Script()
+	sb, _ := tb.Script()
+	return sa == sb
+}
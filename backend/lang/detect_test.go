@@ -0,0 +1,30 @@
+package lang
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		text, preferred string
+		tag             string
+		ok              bool
+	}{
+		{"What is a normal level of ferritin for me?", "", "en", true},
+		{"¿Qué significa mi nivel de colesterol?", "en", "es", true},
+		{"Pourquoi mon taux de fer est si bas ?", "", "fr", true},
+		{"Was bedeutet mein Cholesterinwert und ist das schlimm?", "", "de", true},
+		{"O que é que a minha glicose está a dizer?", "pt-BR", "pt-BR", true}, // Keeps the user's region
+		{"मेरा शुगर लेवल क्या है?", "", "hi", true},
+		{"माझी साखर किती आहे?", "mr", "mr", true}, // Same script as the user's language
+		{"血糖値はどういう意味ですか", "", "ja", true},
+		{"我的血糖正常吗", "", "zh", true},
+		{"Что означает мой анализ?", "", "ru", true},
+		{"HbA1c", "de", "de", false},
+		{"5.4 mmol/L", "es", "es", false},
+	}
+	for _, tt := range tests {
+		tag, ok := Detect(tt.text, tt.preferred)
+		if tag != tt.tag || ok != tt.ok {
+			t.Errorf("Detect(%q, %q) = %q, %v, want %q, %v", tt.text, tt.preferred, tag, ok, tt.tag, tt.ok)
+		}
+	}
+}
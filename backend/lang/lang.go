@@ -0,0 +1,54 @@
+// lang/lang.go
+package lang
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+// English is the language of the knowledge base, the safety rules and the
+// prompts
+const English = "en"
+
+// Parse normalizes a BCP 47 tag such as "es", "pt-BR" or "ES_mx" to its
+// canonical form
+func Parse(tag string) (string, error) {
+	t, err := language.Parse(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	if err != nil || t == language.Und {
+		return "", fmt.Errorf("unknown language %q", tag)
+	}
+	return t.String(), nil
+}
+
+// Base returns the language of a tag without region or script, e.g. "pt"
+// for "pt-BR"
+func Base(tag string) string {
+	t, err := language.Parse(tag)
+	if err != nil {
+		return tag
+	}
+	base, _ := t.Base()
+	return base.String()
+}
+
+// IsEnglish reports whether tag is a variant of English. An empty tag
+// counts as English.
+func IsEnglish(tag string) bool {
+	return tag == "" || Base(tag) == English
+}
+
+// Name returns the English name of a language for prompts, e.g. "Spanish"
+// or "Brazilian Portuguese"
+func Name(tag string) string {
+	t, err := language.Parse(tag)
+	if err != nil {
+		return tag
+	}
+	if name := display.English.Tags().Name(t); name != "" {
+		return name
+	}
+	return tag
+}
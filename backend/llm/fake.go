@@ -0,0 +1,75 @@
+// llm/fake.go
+package llm
+
+import (
+	"context"
+	"strings"
+)
+
+// Fake answers deterministically without a model, for tests, the evaluation
+// harness and demos. Reply, when set, computes the answer; otherwise the
+// last user message is echoed back.
+type Fake struct {
+	Reply func(req Request) string
+}
+
+func (g *Fake) Name() string { return ProviderFake }
+
+func (g *Fake) Generate(ctx context.Context, req Request) (*Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	text := g.text(req)
+	return &Response{
+		Text:             text,
+		Model:            ProviderFake,
+		PromptTokens:     promptWords(req),
+		CompletionTokens: len(strings.Fields(text)),
+	}, nil
+}
+
+// Stream emits the answer one word at a time
+func (g *Fake) Stream(ctx context.Context, req Request, onToken func(string)) (*Response, error) {
+	text := g.text(req)
+	result := &Response{Model: ProviderFake, PromptTokens: promptWords(req)}
+	var sent strings.Builder
+	for i, word := range strings.SplitAfter(text, " ") {
+		if err := ctx.Err(); err != nil {
+			result.Text = sent.String()
+			return result, err
+		}
+		sent.WriteString(word)
+		onToken(word)
+		result.CompletionTokens = i + 1
+	}
+	result.Text = sent.String()
+	return result, nil
+}
+
+func (g *Fake) text(req Request) string {
+	if g.Reply != nil {
+		return g.Reply(req)
+	}
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == RoleUser {
+			return "Fake answer to: " + lastLine(req.Messages[i].Content)
+		}
+	}
+	return "Fake answer"
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndex(s, "\n"); i >= 0 {
+		return strings.TrimSpace(s[i+1:])
+	}
+	return s
+}
+
+func promptWords(req Request) int {
+	n := 0
+	for _, m := range req.Messages {
+		n += len(strings.Fields(m.Content))
+	}
+	return n
+}
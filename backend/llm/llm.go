@@ -0,0 +1,203 @@
+// llm/llm.go
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/upstream"
+)
+
+// Chat roles
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Message is one chat message of a prompt. Tool fields are only sent to
+// generators that support tools.
+type Message struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"-"` // Calls the assistant made in this turn
+	ToolCallID string     `json:"-"` // Call a RoleTool message answers
+	Name       string     `json:"-"` // Tool a RoleTool message answers
+}
+
+// Request is a chat completion request
+type Request struct {
+	Messages    []Message
+	MaxTokens   int     // 0 uses the generator default
+	Temperature float64 // 0 uses the generator default; pass e.g. 0.01 for near-deterministic output
+	Tools       []Tool  // Offered to generators that support tools
+}
+
+// Response is a completed generation. Token counts are zero when the
+// backend does not report them.
+type Response struct {
+	Text             string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	ToolCalls        []ToolCall // The model wants these run before it answers
+}
+
+// Generator produces text from a chat prompt
+type Generator interface {
+	// Name identifies the backend and model, e.g. "ollama:llama3"
+	Name() string
+	Generate(ctx context.Context, req Request) (*Response, error)
+	// Stream generates like Generate, passing text to onToken as it arrives.
+	// On failure the response holds the text produced so far.
+	Stream(ctx context.Context, req Request, onToken func(string)) (*Response, error)
+}
+
+// Providers
+const (
+	ProviderPython = "python" // generate.py shim
+	ProviderOpenAI = "openai" // Any OpenAI compatible server: llama.cpp, vLLM, OpenAI
+	ProviderOllama = "ollama"
+	ProviderFake   = "fake" // Deterministic answers for tests and demos
+)
+
+// Config selects and configures a generator
+type Config struct {
+	Provider    string
+	BaseURL     string
+	Model       string
+	APIKey      string
+	MaxTokens   int
+	Temperature float64
+	Timeout     time.Duration
+	PHI         string // Redaction policy applied by phi.WrapGenerator; empty uses the provider's default
+	Tools       bool   // Offer tools to backends that support them
+}
+
+// ConfigFromEnv reads the generator configuration of a feature such as
+// "chat" or "summary". LLM_<FEATURE>_<KEY> overrides the deployment wide
+// LLM_<KEY>, so one feature can run on a different backend or model:
+//
+//	LLM_PROVIDER=ollama LLM_MODEL=llama3 LLM_SUMMARY_MODEL=qwen2.5:1.5b
+func ConfigFromEnv(feature string) Config {
+	get := func(key string) string {
+		if feature != "" {
+			if v := os.Getenv("LLM_" + strings.ToUpper(feature) + "_" + key); v != "" {
+				return v
+			}
+		}
+		return os.Getenv("LLM_" + key)
+	}
+
+	cfg := Config{
+		Provider:    strings.ToLower(get("PROVIDER")),
+		BaseURL:     strings.TrimRight(get("BASE_URL"), "/"),
+		Model:       get("MODEL"),
+		APIKey:      get("API_KEY"),
+		PHI:         get("PHI"),
+		MaxTokens:   500,
+		Temperature: 0.7,
+		Timeout:     2 * time.Minute,
+		Tools:       true,
+	}
+	if cfg.Provider == "" {
+		cfg.Provider = ProviderPython
+	}
+	if v, err := strconv.Atoi(get("MAX_TOKENS")); err == nil && v > 0 {
+		cfg.MaxTokens = v
+	}
+	if v, err := strconv.ParseFloat(get("TEMPERATURE"), 64); err == nil && v >= 0 {
+		cfg.Temperature = v
+	}
+	if v, err := time.ParseDuration(get("TIMEOUT")); err == nil && v > 0 {
+		cfg.Timeout = v
+	}
+	if v, err := strconv.ParseBool(get("TOOLS")); err == nil {
+		cfg.Tools = v // Servers without tool support reject requests offering them
+	}
+	return cfg
+}
+
+// New creates the generator described by cfg. Calls share connections and
+// a circuit breaker per server (see upstream.Client).
+func New(cfg Config) (Generator, error) {
+	client := func(baseURL string) *upstream.Client {
+		return upstream.New("llm "+cfg.Provider+" "+baseURL, upstream.Options{Timeout: cfg.Timeout})
+	}
+	switch cfg.Provider {
+	case ProviderPython:
+		baseURL := or(cfg.BaseURL, "http://localhost:5001")
+		return &Python{BaseURL: baseURL, Client: client(baseURL), defaults: cfg}, nil
+	case ProviderOpenAI:
+		if cfg.Model == "" {
+			return nil, fmt.Errorf("llm: openai provider needs a model")
+		}
+		baseURL := or(cfg.BaseURL, "http://localhost:8081")
+		return &OpenAI{BaseURL: baseURL, Model: cfg.Model, APIKey: cfg.APIKey, Client: client(baseURL), defaults: cfg}, nil
+	case ProviderOllama:
+		if cfg.Model == "" {
+			return nil, fmt.Errorf("llm: ollama provider needs a model")
+		}
+		baseURL := or(cfg.BaseURL, "http://localhost:11434")
+		return &Ollama{BaseURL: baseURL, Model: cfg.Model, Client: client(baseURL), defaults: cfg}, nil
+	case ProviderFake:
+		return &Fake{}, nil
+	}
+	return nil, fmt.Errorf("llm: unknown provider %q", cfg.Provider)
+}
+
+// FromEnv creates the generator configured for a feature
+func FromEnv(feature string) (Generator, error) {
+	return New(ConfigFromEnv(feature))
+}
+
+// withDefaults fills unset request options from the configuration
+func withDefaults(req Request, cfg Config) Request {
+	if req.MaxTokens == 0 {
+		req.MaxTokens = cfg.MaxTokens
+	}
+	if req.Temperature == 0 {
+		req.Temperature = cfg.Temperature
+	}
+	return req
+}
+
+func or(v, fallback string) string {
+	if v != "" {
+		return v
+	}
+	return fallback
+}
+
+// post sends a JSON request. The caller closes the response body, which is
+// only returned for 2xx responses. Generation has no side effects on the
+// server, so failed attempts are retried.
+func post(ctx context.Context, client *upstream.Client, url string, headers map[string]string, payload interface{}) (*http.Response, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(ctx, upstream.Request{
+		Method:     http.MethodPost,
+		URL:        url,
+		Header:     headers,
+		Body:       body,
+		Idempotent: true,
+	})
+}
+
+// postJSON sends a JSON request and decodes the JSON response into out
+func postJSON(ctx context.Context, client *upstream.Client, url string, headers map[string]string, payload, out interface{}) error {
+	resp, err := post(ctx, client, url, headers, payload)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,152 @@
+// llm/ollama.go
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"backend/upstream"
+)
+
+// Ollama talks to a local Ollama server's /api/chat endpoint
+type Ollama struct {
+	BaseURL  string
+	Model    string
+	Client   *upstream.Client
+	defaults Config
+}
+
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Options  ollamaOptions   `json:"options"`
+	Tools    []toolSpec      `json:"tools,omitempty"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"` // A JSON object, not a string as with OpenAI
+	} `json:"function"`
+}
+
+type ollamaOptions struct {
+	Temperature float64 `json:"temperature"`
+	NumPredict  int     `json:"num_predict,omitempty"`
+}
+
+type ollamaResponse struct {
+	Model           string        `json:"model"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	Error           string        `json:"error"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+}
+
+func (g *Ollama) Name() string { return ProviderOllama + ":" + g.Model }
+
+func (g *Ollama) SupportsTools() bool { return g.defaults.Tools }
+
+func (g *Ollama) request(req Request, stream bool) ollamaRequest {
+	req = withDefaults(req, g.defaults)
+	out := ollamaRequest{
+		Model:    g.Model,
+		Messages: make([]ollamaMessage, len(req.Messages)),
+		Stream:   stream,
+		Options:  ollamaOptions{Temperature: req.Temperature, NumPredict: req.MaxTokens},
+	}
+	for i, m := range req.Messages {
+		out.Messages[i] = ollamaMessage{Role: m.Role, Content: m.Content, ToolName: m.Name}
+		for _, call := range m.ToolCalls {
+			var c ollamaToolCall
+			c.Function.Name, c.Function.Arguments = call.Name, call.Arguments
+			out.Messages[i].ToolCalls = append(out.Messages[i].ToolCalls, c)
+		}
+	}
+	if g.SupportsTools() {
+		out.Tools = toolSpecs(req.Tools)
+	}
+	return out
+}
+
+// Ollama sends each tool call whole, in the final message when not streaming
+// and in a chunk of its own when streaming
+func fromOllamaCalls(calls []ollamaToolCall, ids int) []ToolCall {
+	var out []ToolCall
+	for _, c := range calls {
+		args := c.Function.Arguments
+		if !json.Valid(args) {
+			args = json.RawMessage("{}")
+		}
+		out = append(out, ToolCall{ID: callID(ids + len(out)), Name: c.Function.Name, Arguments: args})
+	}
+	return out
+}
+
+func (g *Ollama) Generate(ctx context.Context, req Request) (*Response, error) {
+	var out ollamaResponse
+	if err := postJSON(ctx, g.Client, g.BaseURL+"/api/chat", nil, g.request(req, false), &out); err != nil {
+		return nil, err
+	}
+	if out.Error != "" {
+		return nil, fmt.Errorf("llm: ollama: %s", out.Error)
+	}
+	return &Response{
+		Text:             out.Message.Content,
+		Model:            or(out.Model, g.Model),
+		PromptTokens:     out.PromptEvalCount,
+		CompletionTokens: out.EvalCount,
+		ToolCalls:        fromOllamaCalls(out.Message.ToolCalls, 0),
+	}, nil
+}
+
+// Stream reads Ollama's newline-delimited JSON chunks
+func (g *Ollama) Stream(ctx context.Context, req Request, onToken func(string)) (*Response, error) {
+	result := &Response{Model: g.Model}
+	httpResp, err := post(ctx, g.Client, g.BaseURL+"/api/chat", nil, g.request(req, true))
+	if err != nil {
+		return result, err
+	}
+	defer httpResp.Body.Close()
+
+	var text strings.Builder
+	scanner := bufio.NewScanner(httpResp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var chunk ollamaResponse
+		if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+			result.Text = text.String()
+			return result, fmt.Errorf("llm: bad stream chunk: %v", err)
+		}
+		if chunk.Error != "" {
+			result.Text = text.String()
+			return result, fmt.Errorf("llm: ollama: %s", chunk.Error)
+		}
+		if chunk.Message.Content != "" {
+			text.WriteString(chunk.Message.Content)
+			onToken(chunk.Message.Content)
+		}
+		result.ToolCalls = append(result.ToolCalls, fromOllamaCalls(chunk.Message.ToolCalls, len(result.ToolCalls))...)
+		if chunk.Done {
+			result.PromptTokens, result.CompletionTokens = chunk.PromptEvalCount, chunk.EvalCount
+			break
+		}
+	}
+	result.Text = text.String()
+	return result, scanner.Err()
+}
@@ -0,0 +1,210 @@
+// llm/openai.go
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"backend/upstream"
+)
+
+// OpenAI talks to an OpenAI compatible /v1/chat/completions endpoint, as
+// served by llama.cpp's server, vLLM and OpenAI itself
+type OpenAI struct {
+	BaseURL  string
+	Model    string
+	APIKey   string
+	Client   *upstream.Client
+	defaults Config
+}
+
+type openAIRequest struct {
+	Model         string          `json:"model"`
+	Messages      []openAIMessage `json:"messages"`
+	MaxTokens     int             `json:"max_tokens,omitempty"`
+	Temperature   float64         `json:"temperature"`
+	Stream        bool            `json:"stream,omitempty"`
+	StreamOptions *streamOptions  `json:"stream_options,omitempty"`
+	Tools         []toolSpec      `json:"tools,omitempty"`
+}
+
+type openAIMessage struct {
+	Role       string           `json:"role,omitempty"`
+	Content    string           `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+// openAIToolCall is a complete call, or in a stream a fragment of the call
+// at Index
+type openAIToolCall struct {
+	Index    *int   `json:"index,omitempty"` // Only in stream fragments
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments"` // JSON encoded as a string
+	} `json:"function"`
+}
+
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message openAIMessage `json:"message"`
+		Delta   openAIMessage `json:"delta"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+func (g *OpenAI) Name() string { return ProviderOpenAI + ":" + g.Model }
+
+func (g *OpenAI) SupportsTools() bool { return g.defaults.Tools }
+
+func (g *OpenAI) headers() map[string]string {
+	if g.APIKey == "" {
+		return nil
+	}
+	return map[string]string{"Authorization": "Bearer " + g.APIKey}
+}
+
+func (g *OpenAI) request(req Request, stream bool) openAIRequest {
+	req = withDefaults(req, g.defaults)
+	out := openAIRequest{
+		Model:       g.Model,
+		Messages:    openAIMessages(req.Messages),
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		Stream:      stream,
+	}
+	if g.SupportsTools() {
+		out.Tools = toolSpecs(req.Tools)
+	}
+	if stream {
+		out.StreamOptions = &streamOptions{IncludeUsage: true}
+	}
+	return out
+}
+
+func (g *OpenAI) Generate(ctx context.Context, req Request) (*Response, error) {
+	var out openAIResponse
+	if err := postJSON(ctx, g.Client, g.BaseURL+"/v1/chat/completions", g.headers(), g.request(req, false), &out); err != nil {
+		return nil, err
+	}
+	if len(out.Choices) == 0 {
+		return nil, fmt.Errorf("llm: no choices in response")
+	}
+	resp := &Response{
+		Text:      out.Choices[0].Message.Content,
+		Model:     or(out.Model, g.Model),
+		ToolCalls: fromOpenAICalls(out.Choices[0].Message.ToolCalls),
+	}
+	if out.Usage != nil {
+		resp.PromptTokens, resp.CompletionTokens = out.Usage.PromptTokens, out.Usage.CompletionTokens
+	}
+	return resp, nil
+}
+
+// Stream reads the server-sent event stream of chat completion chunks
+func (g *OpenAI) Stream(ctx context.Context, req Request, onToken func(string)) (*Response, error) {
+	result := &Response{Model: g.Model}
+	httpResp, err := post(ctx, g.Client, g.BaseURL+"/v1/chat/completions", g.headers(), g.request(req, true))
+	if err != nil {
+		return result, err
+	}
+	defer httpResp.Body.Close()
+
+	var text strings.Builder
+	var calls []openAIToolCall // Assembled from fragments
+	scanner := bufio.NewScanner(httpResp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if !bytes.HasPrefix(line, []byte("data:")) {
+			continue
+		}
+		data := bytes.TrimSpace(line[len("data:"):])
+		if string(data) == "[DONE]" {
+			break
+		}
+		var chunk openAIResponse
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			result.Text = text.String()
+			return result, fmt.Errorf("llm: bad stream chunk: %v", err)
+		}
+		if chunk.Model != "" {
+			result.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			result.PromptTokens, result.CompletionTokens = chunk.Usage.PromptTokens, chunk.Usage.CompletionTokens
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		delta := chunk.Choices[0].Delta
+		if delta.Content != "" {
+			text.WriteString(delta.Content)
+			onToken(delta.Content)
+		}
+		for _, fragment := range delta.ToolCalls {
+			index := 0
+			if fragment.Index != nil {
+				index = *fragment.Index
+			}
+			if index < 0 || index >= 64 {
+				continue
+			}
+			for len(calls) <= index {
+				calls = append(calls, openAIToolCall{})
+			}
+			call := &calls[index]
+			if fragment.ID != "" {
+				call.ID = fragment.ID
+			}
+			call.Function.Name += fragment.Function.Name
+			call.Function.Arguments += fragment.Function.Arguments
+		}
+	}
+	result.Text = text.String()
+	result.ToolCalls = fromOpenAICalls(calls)
+	return result, scanner.Err()
+}
+
+func openAIMessages(messages []Message) []openAIMessage {
+	out := make([]openAIMessage, len(messages))
+	for i, m := range messages {
+		out[i] = openAIMessage{Role: m.Role, Content: m.Content, ToolCallID: m.ToolCallID}
+		for _, call := range m.ToolCalls {
+			c := openAIToolCall{ID: call.ID, Type: "function"}
+			c.Function.Name = call.Name
+			c.Function.Arguments = string(call.Arguments)
+			out[i].ToolCalls = append(out[i].ToolCalls, c)
+		}
+	}
+	return out
+}
+
+func fromOpenAICalls(calls []openAIToolCall) []ToolCall {
+	var out []ToolCall
+	for i, c := range calls {
+		if c.Function.Name == "" {
+			continue
+		}
+		args := json.RawMessage(c.Function.Arguments)
+		if !json.Valid(args) {
+			args = json.RawMessage("{}") // Truncated or malformed; the tool reports missing arguments
+		}
+		out = append(out, ToolCall{ID: or(c.ID, callID(i)), Name: c.Function.Name, Arguments: args})
+	}
+	return out
+}
@@ -0,0 +1,91 @@
+// llm/python.go
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"backend/upstream"
+)
+
+// Python talks to the /chat endpoint of the generate.py shim, which forwards
+// to the Hugging Face inference API
+type Python struct {
+	BaseURL  string
+	Client   *upstream.Client
+	defaults Config
+}
+
+type pythonRequest struct {
+	Messages    []Message `json:"messages"`
+	MaxTokens   int       `json:"max_tokens"`
+	Temperature float64   `json:"temperature"`
+	Stream      bool      `json:"stream"`
+}
+
+type pythonResponse struct {
+	GeneratedText string `json:"generated_text"`
+	Model         string `json:"model"`
+	Token         string `json:"token"`
+	Error         string `json:"error"`
+}
+
+func (g *Python) Name() string { return ProviderPython }
+
+func (g *Python) request(req Request, stream bool) pythonRequest {
+	req = withDefaults(req, g.defaults)
+	return pythonRequest{Messages: req.Messages, MaxTokens: req.MaxTokens, Temperature: req.Temperature, Stream: stream}
+}
+
+func (g *Python) Generate(ctx context.Context, req Request) (*Response, error) {
+	var out pythonResponse
+	if err := postJSON(ctx, g.Client, g.BaseURL+"/chat", nil, g.request(req, false), &out); err != nil {
+		return nil, err
+	}
+	if out.Error != "" {
+		return nil, fmt.Errorf("llm: python: %s", out.Error)
+	}
+	return &Response{Text: out.GeneratedText, Model: out.Model}, nil
+}
+
+// Stream reads the shim's newline-delimited {"token": ...} chunks
+func (g *Python) Stream(ctx context.Context, req Request, onToken func(string)) (*Response, error) {
+	result := &Response{}
+	httpResp, err := post(ctx, g.Client, g.BaseURL+"/chat", nil, g.request(req, true))
+	if err != nil {
+		return result, err
+	}
+	defer httpResp.Body.Close()
+
+	var text strings.Builder
+	scanner := bufio.NewScanner(httpResp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var chunk pythonResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			result.Text = text.String()
+			return result, fmt.Errorf("llm: bad stream chunk: %v", err)
+		}
+		if chunk.Error != "" {
+			result.Text = text.String()
+			return result, fmt.Errorf("llm: python: %s", chunk.Error)
+		}
+		if chunk.Model != "" {
+			result.Model = chunk.Model
+		}
+		if chunk.Token != "" {
+			text.WriteString(chunk.Token)
+			onToken(chunk.Token)
+		}
+	}
+	result.Text = text.String()
+	return result, scanner.Err()
+}
@@ -0,0 +1,69 @@
+// llm/tools.go
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// RoleTool carries the result of a tool call back to the model
+const RoleTool = "tool"
+
+// Tool is a function the model may ask the caller to run. Parameters is a
+// JSON Schema object describing the arguments.
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage
+}
+
+// ToolCall is the model's request to run a tool. Arguments is a JSON object.
+type ToolCall struct {
+	ID        string
+	Name      string
+	Arguments json.RawMessage
+}
+
+// ToolUser is implemented by generators that can be offered tools. Others
+// ignore Request.Tools and never return tool calls.
+type ToolUser interface {
+	SupportsTools() bool
+}
+
+// SupportsTools reports whether g passes tools to its backend
+func SupportsTools(g Generator) bool {
+	t, ok := g.(ToolUser)
+	return ok && t.SupportsTools()
+}
+
+// toolSpec is the OpenAI tool format, which Ollama accepts as well
+type toolSpec struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description"`
+		Parameters  json.RawMessage `json:"parameters"`
+	} `json:"function"`
+}
+
+func toolSpecs(tools []Tool) []toolSpec {
+	if len(tools) == 0 {
+		return nil
+	}
+	specs := make([]toolSpec, len(tools))
+	for i, t := range tools {
+		specs[i].Type = "function"
+		specs[i].Function.Name = t.Name
+		specs[i].Function.Description = t.Description
+		specs[i].Function.Parameters = t.Parameters
+		if len(t.Parameters) == 0 {
+			specs[i].Function.Parameters = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+	}
+	return specs
+}
+
+// callID names tool calls of backends that do not return IDs
+func callID(i int) string {
+	return fmt.Sprintf("call_%d", i+1)
+}
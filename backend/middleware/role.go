@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+
+	"backend/models"
+
+	"gorm.io/gorm"
+)
+
+// RequireRole only lets through users with one of the given roles. It must
+// run after AuthMiddleware.
+func RequireRole(db *gorm.DB, roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := r.Context().Value("user_id").(string)
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			var user models.User
+			if err := db.Select("id, role").First(&user, "id = ?", userID).Error; err != nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			for _, role := range roles {
+				if user.Role == role {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		})
+	}
+}
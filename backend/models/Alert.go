@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AlertRule watches one analyte of a patient, e.g. "potassium above 6.0 mmol/L
+// twice within 48 hours". Rules are written by the patient or by a clinician
+// on their care team.
+type AlertRule struct {
+	ID             uuid.UUID `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	UserID         uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index"` // Patient whose data is watched
+	CreatedBy      uuid.UUID `json:"created_by" gorm:"type:uuid;not null;index"`
+	Source         string    `json:"source" gorm:"type:varchar(10);not null"`     // user or clinician
+	Code           string    `json:"code" gorm:"type:varchar(20);not null;index"` // Analyte LOINC code
+	Comparator     string    `json:"comparator" gorm:"type:varchar(15);not null"` // gt, gte, lt, lte, eq, outside_range, abnormal
+	Threshold      *float64  `json:"threshold,omitempty"`                         // In Unit; unused by outside_range and abnormal
+	Unit           string    `json:"unit" gorm:"type:varchar(30)"`
+	WindowHours    int       `json:"window_hours"`                              // Persistence window, 0 fires on a single value
+	MinOccurrences int       `json:"min_occurrences"`                           // Matching values required within the window
+	Channels       string    `json:"channels" gorm:"type:varchar(50);not null"` // Comma separated: in_app, email, webhook
+	Email          string    `json:"email,omitempty" gorm:"type:varchar(255)"`  // Defaults to the author's address
+	WebhookURL     string    `json:"webhook_url,omitempty" gorm:"type:varchar(500)"`
+	Active         bool      `json:"active" gorm:"not null;default:true"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Notification is one delivery of a triggered alert on one channel
+type Notification struct {
+	ID            uuid.UUID  `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	UserID        uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index;uniqueIndex:idx_notification_once"` // Recipient
+	RuleID        uuid.UUID  `json:"rule_id" gorm:"type:uuid;not null;uniqueIndex:idx_notification_once"`
+	ObservationID uuid.UUID  `json:"observation_id" gorm:"type:uuid;not null;uniqueIndex:idx_notification_once"`
+	Channel       string     `json:"channel" gorm:"type:varchar(10);not null;uniqueIndex:idx_notification_once"`
+	Title         string     `json:"title" gorm:"type:varchar(200)"`
+	Message       string     `json:"message" gorm:"type:text"`
+	Status        string     `json:"status" gorm:"type:varchar(10)"` // pending, delivered, failed
+	Error         string     `json:"error,omitempty" gorm:"type:text"`
+	ReadAt        *time.Time `json:"read_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// CareRelationship lets a clinician see and write alert rules for a patient.
+// Patients create and revoke them.
+type CareRelationship struct {
+	PatientID   uuid.UUID `json:"patient_id" gorm:"type:uuid;primary_key"`
+	ClinicianID uuid.UUID `json:"clinician_id" gorm:"type:uuid;primary_key;index"`
+	CreatedAt   time.Time `json:"created_at"`
+}
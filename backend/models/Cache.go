@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// CacheEntry is a cached value shared between backend instances. Keys are
+// namespaced hashes built by the cache package.
+type CacheEntry struct {
+	Key       string    `gorm:"type:varchar(120);primary_key"`
+	Value     []byte    `gorm:"type:bytea;not null"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+}
+
+// DataVersion counts changes to a scope of data, such as one user's health
+// records. Cache keys include the version, so entries built from older data
+// are never read again.
+type DataVersion struct {
+	Scope     string `gorm:"type:varchar(100);primary_key"`
+	Version   int64  `gorm:"not null;default:0"`
+	UpdatedAt time.Time
+}
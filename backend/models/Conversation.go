@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// Conversation is a chatbot thread. Turns older than the history budget are
+// folded into Summary so follow-up prompts stay a bounded size.
+type Conversation struct {
+	ID           uuid.UUID  `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	UserID       uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	Title        string     `json:"title" gorm:"type:varchar(200)"`
+	Summary      string     `json:"-" gorm:"type:text"`
+	SummaryUntil *time.Time `json:"-"` // Messages up to this time are covered by Summary
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	Messages     []Message  `json:"messages,omitempty" gorm:"foreignKey:ConversationID;constraint:OnDelete:CASCADE"`
+}
+
+// Message is one turn of a conversation
+type Message struct {
+	ID             uuid.UUID      `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	ConversationID uuid.UUID      `json:"conversation_id" gorm:"type:uuid;not null;index"`
+	UserID         uuid.UUID      `json:"user_id" gorm:"type:uuid;not null;index"`
+	Role           string         `json:"role" gorm:"type:varchar(10);not null"` // user or assistant
+	Content        string         `json:"content" gorm:"type:text;not null"`
+	Citations      datatypes.JSON `json:"citations,omitempty" gorm:"type:jsonb"`            // Sources of an assistant message
+	Truncated      bool           `json:"truncated,omitempty"`                              // Generation stopped early, e.g. the client disconnected
+	Model          string         `json:"model,omitempty" gorm:"type:varchar(100)"`         // Generator that wrote an assistant message
+	PromptVersion  string         `json:"prompt_version,omitempty" gorm:"type:varchar(60)"` // Prompt template it was given, e.g. chat@3
+	Language       string         `json:"language,omitempty" gorm:"type:varchar(20)"`       // BCP 47 tag of the language it is written in
+	CreatedAt      time.Time      `json:"created_at" gorm:"index"`
+}
+
+// Message roles
+const (
+	MessageRoleUser      = "user"
+	MessageRoleAssistant = "assistant"
+)
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// Feedback is a user's rating of a chatbot answer. The question, answer,
+// sources and model are copied in when it is given, so the review export
+// shows what the user rated. It is deleted along with the conversation.
+type Feedback struct {
+	ID             uuid.UUID      `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	UserID         uuid.UUID      `json:"user_id" gorm:"type:uuid;not null;index"`
+	ConversationID uuid.UUID      `json:"conversation_id" gorm:"type:uuid;not null"`
+	MessageID      uuid.UUID      `json:"message_id" gorm:"type:uuid;not null;uniqueIndex"` // The rated assistant message
+	Rating         string         `json:"rating" gorm:"type:varchar(10);not null;index"`    // up or down
+	Reasons        string         `json:"reasons" gorm:"type:varchar(200)"`                 // Comma separated, see FeedbackReasons
+	Comment        string         `json:"comment" gorm:"type:text"`
+	Question       string         `json:"question" gorm:"type:text"`
+	Answer         string         `json:"answer" gorm:"type:text"`
+	Context        datatypes.JSON `json:"context" gorm:"type:jsonb"` // Citations of the answer
+	Model          string         `json:"model" gorm:"type:varchar(100)"`
+	PromptVersion  string         `json:"prompt_version" gorm:"type:varchar(60);index"`
+	CreatedAt      time.Time      `json:"created_at" gorm:"index"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+// Ratings
+const (
+	RatingUp   = "up"
+	RatingDown = "down"
+)
+
+// FeedbackReasons are the categories a rating can be given for
+var FeedbackReasons = []string{
+	"helpful", "accurate", "clear", // Mostly with thumbs up
+	"inaccurate", "unhelpful", "unsafe", "incomplete", "wrong_sources", "missing_sources", "outdated", "too_long", "other",
+}
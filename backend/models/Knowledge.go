@@ -0,0 +1,99 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EmbeddingDimensions is the size of stored embeddings. It matches
+// all-MiniLM-L6-v2, the model the knowledge base was first built with.
+const EmbeddingDimensions = 384
+
+// KnowledgeChunk is a passage of a reference document with its embedding
+type KnowledgeChunk struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	Source    string    `json:"source" gorm:"type:varchar(255);not null;index"` // Document file name
+	Seq       int       `json:"seq"`                                            // Position within the document
+	Content   string    `json:"content" gorm:"type:text;not null"`
+	Hash      string    `json:"-" gorm:"type:char(64);not null;uniqueIndex"` // SHA-256 of Content, keeps ingestion idempotent
+	Embedding Vector    `json:"-" gorm:"type:vector(384)"`
+	Model     string    `json:"model" gorm:"type:varchar(100)"` // Embedding model
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Vector is a pgvector column value
+type Vector []float32
+
+// Value formats the vector as a pgvector literal, e.g. "[0.1,0.2]"
+func (v Vector) Value() (driver.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return v.String(), nil
+}
+
+func (v Vector) String() string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, f := range v {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(f), 'f', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// Scan reads a pgvector literal
+func (v *Vector) Scan(src interface{}) error {
+	var s string
+	switch t := src.(type) {
+	case nil:
+		*v = nil
+		return nil
+	case string:
+		s = t
+	case []byte:
+		s = string(t)
+	default:
+		return fmt.Errorf("cannot scan %T into Vector", src)
+	}
+	s = strings.Trim(strings.TrimSpace(s), "[]")
+	if s == "" {
+		*v = Vector{}
+		return nil
+	}
+	parts := strings.Split(s, ",")
+	out := make(Vector, len(parts))
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 32)
+		if err != nil {
+			return fmt.Errorf("invalid vector element %q", p)
+		}
+		out[i] = float32(f)
+	}
+	*v = out
+	return nil
+}
+
+// RecordChunk is a passage of one of a user's health records with its
+// embedding, so the chatbot can retrieve only the records a question needs
+type RecordChunk struct {
+	ID           uuid.UUID  `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	UserID       uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	HealthDataID uuid.UUID  `json:"health_data_id" gorm:"type:uuid;not null;index"`
+	HealthData   HealthData `json:"-" gorm:"foreignKey:HealthDataID;constraint:OnDelete:CASCADE"`
+	Kind         string     `json:"kind" gorm:"type:varchar(20)"` // health_record or health_concern
+	Seq          int        `json:"seq"`
+	Content      string     `json:"content" gorm:"type:text;not null"`
+	Embedding    Vector     `json:"-" gorm:"type:vector(384)"`
+	Model        string     `json:"model" gorm:"type:varchar(100)"`
+	RecordedAt   time.Time  `json:"recorded_at"` // Collection or report date, used for recency weighting
+	CreatedAt    time.Time  `json:"created_at"`
+}
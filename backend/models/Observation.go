@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Observation is a single structured result extracted from a health record,
+// e.g. "LDL cholesterol 162 mg/dL (<100) H" from an uploaded lab report.
+type Observation struct {
+	ID            uuid.UUID  `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	UserID        uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	HealthDataID  uuid.UUID  `json:"health_data_id" gorm:"type:uuid;not null;index"`
+	HealthData    HealthData `json:"-" gorm:"foreignKey:HealthDataID;constraint:OnDelete:CASCADE"`
+	Code          string     `json:"code" gorm:"type:varchar(20);index"` // LOINC-like code, empty if unrecognized
+	Name          string     `json:"name" gorm:"type:varchar(100)"`      // Canonical test name
+	RawName       string     `json:"raw_name" gorm:"type:varchar(200)"`  // Name as printed on the report
+	Value         float64    `json:"value"`
+	Comparator    string     `json:"comparator,omitempty" gorm:"type:varchar(2)"` // "<" or ">" for censored values
+	Unit          string     `json:"unit" gorm:"type:varchar(30)"`                // UCUM code, the analyte's conventional unit when known
+	ReportedValue float64    `json:"reported_value"`                              // Value as printed on the report
+	ReportedUnit  string     `json:"reported_unit" gorm:"type:varchar(30)"`
+	RefLow        *float64   `json:"ref_low,omitempty"`
+	RefHigh       *float64   `json:"ref_high,omitempty"`
+	RefText       string     `json:"ref_text,omitempty" gorm:"type:varchar(50)"`
+	Flag          string     `json:"flag,omitempty" gorm:"type:varchar(2)"` // H, L, HH, LL or A
+	EffectiveAt   time.Time  `json:"effective_at" gorm:"index"`             // Specimen collection date
+	CreatedAt     time.Time  `json:"created_at"`
+}
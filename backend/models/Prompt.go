@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PromptTemplate is one version of a named chatbot prompt. Versions are
+// never edited; a change is a new version. Weight is the version's share of
+// users in an A/B rollout, 0 when it is not served.
+type PromptTemplate struct {
+	ID          uuid.UUID  `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	Name        string     `json:"name" gorm:"type:varchar(50);not null;uniqueIndex:idx_prompt_templates_version"`
+	Version     int        `json:"version" gorm:"not null;uniqueIndex:idx_prompt_templates_version"`
+	System      string     `json:"system" gorm:"type:text;not null"` // Go template of the system message
+	User        string     `json:"user" gorm:"type:text;not null"`   // Go template of the message carrying the question
+	Description string     `json:"description" gorm:"type:text"`
+	Weight      int        `json:"weight" gorm:"not null;default:0"`
+	CreatedBy   *uuid.UUID `json:"created_by,omitempty" gorm:"type:uuid"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SafetyEvent records a chatbot safety rule that applied to a question or
+// an answer
+type SafetyEvent struct {
+	ID             uuid.UUID `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	UserID         uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index"`
+	ConversationID uuid.UUID `json:"conversation_id" gorm:"type:uuid;index"`
+	MessageID      uuid.UUID `json:"message_id" gorm:"type:uuid"`            // The assistant reply
+	Stage          string    `json:"stage" gorm:"type:varchar(10);not null"` // question or answer
+	RuleID         string    `json:"rule_id" gorm:"type:varchar(100);not null;index"`
+	Category       string    `json:"category" gorm:"type:varchar(50)"`
+	Action         string    `json:"action" gorm:"type:varchar(20);not null"`
+	Excerpt        string    `json:"excerpt" gorm:"type:text"` // The text the rule matched
+	CreatedAt      time.Time `json:"created_at" gorm:"index"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// TriageSession is one run of the symptom triage flow. The current question
+// and urgency follow from the answers; they are stored once it completes.
+type TriageSession struct {
+	ID        uuid.UUID      `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	UserID    uuid.UUID      `json:"user_id" gorm:"type:uuid;not null;index"`
+	ConcernID *uuid.UUID     `json:"concern_id,omitempty" gorm:"type:uuid"` // Health concerns record it started from
+	Symptoms  string         `json:"symptoms" gorm:"type:text"`             // Free-text description it started from
+	StartDate *time.Time     `json:"start_date,omitempty" gorm:"type:date"` // When the symptoms started, from the concern
+	Answers   datatypes.JSON `json:"answers" gorm:"type:jsonb"`             // []triage.Answer
+	Status    string         `json:"status" gorm:"type:varchar(20);not null"`
+	Urgency   string         `json:"urgency,omitempty" gorm:"type:varchar(20)"` // self_care, gp, urgent or emergency
+	Summary   string         `json:"summary,omitempty" gorm:"type:text"`
+	RecordID  *uuid.UUID     `json:"record_id,omitempty" gorm:"type:uuid"` // Health record the summary was saved as
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// Triage statuses
+const (
+	TriageInProgress = "in_progress"
+	TriageCompleted  = "completed"
+)
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UsageEvent is one metered call to a generator, embedder or retriever
+type UsageEvent struct {
+	ID               uuid.UUID  `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	UserID           *uuid.UUID `json:"user_id,omitempty" gorm:"type:uuid;index"` // nil for work done for no user, such as ingestion
+	Feature          string     `json:"feature" gorm:"type:varchar(40);not null"` // chat, summary, translate, embedding or retrieval
+	Model            string     `json:"model" gorm:"type:varchar(100);not null"`
+	PromptTokens     int        `json:"prompt_tokens"`
+	CompletionTokens int        `json:"completion_tokens"`
+	Estimated        bool       `json:"estimated,omitempty"` // Counted locally because the backend did not report usage
+	LatencyMs        int64      `json:"latency_ms"`
+	Cost             float64    `json:"cost" gorm:"type:numeric(14,6)"` // USD
+	Failed           bool       `json:"failed,omitempty"`
+	CreatedAt        time.Time  `json:"created_at" gorm:"index"`
+}
+
+// UsageDay totals the usage events of a user, day, feature and model.
+// Work done for no user is totalled under uuid.Nil.
+type UsageDay struct {
+	UserID           uuid.UUID `json:"user_id" gorm:"type:uuid;primary_key"`
+	Day              time.Time `json:"day" gorm:"type:date;primary_key"`
+	Feature          string    `json:"feature" gorm:"type:varchar(40);primary_key"`
+	Model            string    `json:"model" gorm:"type:varchar(100);primary_key"`
+	Calls            int64     `json:"calls"`
+	PromptTokens     int64     `json:"prompt_tokens"`
+	CompletionTokens int64     `json:"completion_tokens"`
+	LatencyMs        int64     `json:"latency_ms"` // Sum over the calls
+	Cost             float64   `json:"cost" gorm:"type:numeric(14,6)"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// UsageBudget overrides the default budgets of one user. A nil limit uses
+// the default; 0 means unlimited.
+type UsageBudget struct {
+	UserID      uuid.UUID `json:"user_id" gorm:"type:uuid;primary_key"`
+	DailyTokens *int64    `json:"daily_tokens"`
+	MonthlyCost *float64  `json:"monthly_cost" gorm:"type:numeric(14,6)"` // USD
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -15,6 +15,7 @@ type User struct {
 	Name       string       `gorm:"not null" json:"name"`
 	Email      string       `gorm:"unique;not null" json:"email"`
 	Password   string       `gorm:"not null" json:"-"`
+	Role       string       `gorm:"type:varchar(20);not null;default:'patient'" json:"role"` // patient, clinician or admin
 	CreatedAt  time.Time    `json:"createdAt"`
 	UpdatedAt  time.Time    `json:"updatedAt"`
 	HealthData []HealthData `gorm:"foreignKey:UserID" json:"healthData"`
@@ -22,18 +23,35 @@ type User struct {
 	// New Fields for Personal Information
 	Gender    string      `gorm:"type:varchar(10)" json:"gender"`
 	BirthDate *time.Time  `gorm:"type:date;default:null" json:"birthDate"`
-	Height    int         `gorm:"type:int" json:"height"`
-	Weight    int         `gorm:"type:int" json:"weight"`
+	Height    float64     `gorm:"type:double precision" json:"height"` // Stored in centimeters
+	Weight    float64     `gorm:"type:double precision" json:"weight"` // Stored in kilograms
 	Ethnicity string      `gorm:"type:varchar(50)" json:"ethnicity"`
 	Country   string      `gorm:"type:varchar(50)" json:"country"`
 	Images    []*UserImage `gorm:"foreignKey:UserID" json:"images,omitempty"`
+
+	// Display preferences
+	UnitSystem string `gorm:"type:varchar(10);default:'metric'" json:"unitSystem"`        // metric or imperial
+	LabUnits   string `gorm:"type:varchar(15);default:'conventional'" json:"labUnits"` // conventional or si
+	Language   string `gorm:"type:varchar(20)" json:"language"`                     // Chatbot language as a BCP 47 tag such as es or pt-BR, used when a question does not show its own
+	HeightUnit string `gorm:"-" json:"heightUnit,omitempty"`                           // Set when localized for a response
+	WeightUnit string `gorm:"-" json:"weightUnit,omitempty"`
 }
 
+// User roles
+const (
+	RolePatient   = "patient"
+	RoleClinician = "clinician"
+	RoleAdmin     = "admin"
+)
+
 // Health Data Model
 type HealthData struct {
 	ID     uuid.UUID      `json:"id" gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
 	UserID uuid.UUID      `json:"user_id" gorm:"type:uuid;not null"`
 	Data   datatypes.JSON `json:"data" gorm:"type:jsonb"`
+	// Embedding model the record was last indexed with, set even when it
+	// yields no chunks so it is not indexed again
+	IndexedModel string `json:"-" gorm:"type:varchar(100)"`
 }
 
 // Login Input Struct
@@ -12,7 +12,8 @@ type UserImage struct {
 	ID        string    `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
 	UserID    string    `gorm:"type:uuid;not null;index" json:"userId"`
 	User      User      `gorm:"foreignKey:UserID" json:"-"`
-	ImageData []byte    `gorm:"type:bytea;not null" json:"-"`               // Actual image binary data
+	ImageData []byte    `gorm:"type:bytea" json:"-"`                        // Bytes of images not yet moved to the blob store
+	BlobKey   string    `gorm:"type:varchar(300)" json:"-"`                 // Where the bytes are kept in the blob store
 	ImageType string    `gorm:"type:varchar(50);not null" json:"imageType"` // MIME type (e.g., image/jpeg)
 	ImageName string    `gorm:"type:varchar(255)" json:"imageName"`         // Original filename
 	Size      int64     `gorm:"type:bigint" json:"size"`                    // File size in bytes
@@ -20,6 +21,11 @@ type UserImage struct {
 	UpdatedAt time.Time `json:"updatedAt"`
 }
 
+// ImageBlobKey is the blob store key of an image's bytes
+func ImageBlobKey(userID, imageID string) string {
+	return "images/" + userID + "/" + imageID
+}
+
 // BeforeCreate will set ID if not provided
 func (ui *UserImage) BeforeCreate(tx *gorm.DB) (err error) {
 	if ui.ID == "" {
@@ -0,0 +1,228 @@
+// phi/detect.go
+package phi
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Categories of identifiers
+const (
+	Name    = "name"
+	Email   = "email"
+	Phone   = "phone"
+	MRN     = "mrn" // Medical record, patient, lab and accession numbers
+	Address = "address"
+	Date    = "date" // Exact dates; a month or year alone is kept
+)
+
+// Categories lists every category, in detection order
+var Categories = []string{Email, MRN, Date, Phone, Address, Name}
+
+// span is an identifier found in a text
+type span struct {
+	start, end int
+	category   string
+}
+
+// detector finds identifiers of one category. Group selects the submatch
+// that is the identifier, so labels such as "MRN:" are left in place. At,
+// when set, vets a match against the text around it.
+type detector struct {
+	category string
+	re       *regexp.Regexp
+	group    int
+	valid    func(string) bool
+	at       func(text string, start, end int) bool
+	trim     func(string) string
+}
+
+const month = `(?:Jan(?:uary)?|Feb(?:ruary)?|Mar(?:ch)?|Apr(?:il)?|May|June?|July?|Aug(?:ust)?|Sep(?:t(?:ember)?)?|Oct(?:ober)?|Nov(?:ember)?|Dec(?:ember)?)`
+
+const streetType = `(?:Street|St|Road|Rd|Avenue|Ave|Lane|Ln|Drive|Dr|Boulevard|Blvd|Court|Ct|Place|Pl|Way|Terrace|Close|Crescent|Highway|Hwy|Nagar|Marg|Colony|Layout|Cross|Main)`
+
+// A person's name: up to four capitalized words on one line
+const personName = `([A-Z][A-Za-z'-]+\.?(?:[ \t]+[A-Z][A-Za-z'-]*\.?){0,3})`
+
+var detectors = []detector{
+	{category: Email, re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	{
+		category: MRN,
+		re:       regexp.MustCompile(`(?i)\b(?:MRN|MR\s*No|MR\s*Number|Medical\s+Record\s+(?:Number|No)|Patient\s+(?:ID|No|Number)|UHID|Reg(?:istration)?\.?\s*(?:No|Number|ID)|Lab\s*(?:No|ID)|Sample\s*(?:No|ID)|Accession\s*(?:No|Number|#)?|Hospital\s*(?:No|Number)|IP\s*No|OP\s*No|Insurance\s*(?:No|ID)|Policy\s*(?:No|Number)|SSN|Aadhaar(?:\s*No)?)\.?[ \t]*[:#-]?[ \t]*([A-Z0-9][A-Z0-9/-]{3,})`),
+		group:    1,
+		valid:    hasDigit,
+	},
+	{category: Date, re: regexp.MustCompile(`\b\d{4}-\d{1,2}-\d{1,2}\b`)},
+	{category: Date, re: regexp.MustCompile(`\b\d{1,2}(?:/\d{1,2}/|-\d{1,2}-|\.\d{1,2}\.)(?:\d{4}|\d{2})\b`), at: numericDate},
+	{category: Date, re: regexp.MustCompile(`(?i)\b\d{1,2}(?:st|nd|rd|th)?[ -]` + month + `\.?,?[ -]\d{2,4}\b`)},
+	{category: Date, re: regexp.MustCompile(`(?i)\b` + month + `\.?[ ]\d{1,2}(?:st|nd|rd|th)?,?[ ]\d{4}\b`)},
+	{category: Phone, re: regexp.MustCompile(`\+?\(?\d[\d \t()-]{7,}\d`), valid: phoneShape, at: notInNumber},
+	{category: Address, re: regexp.MustCompile(`(?im)\bAddress[ \t]*[:-][ \t]*([^\n]+)`), group: 1},
+	{category: Address, re: regexp.MustCompile(`\b\d{1,5}[A-Za-z]?,?[ \t]+(?:[A-Z][A-Za-z]+[ \t]+){1,4}` + streetType + `\b\.?`)},
+	{
+		category: Name,
+		re:       regexp.MustCompile(`(?m)(?i:\bPatient(?:'s)?[ \t]*Name|\bName[ \t]+of[ \t]+(?:the[ \t]+)?Patient|\bPt\.?[ \t]*Name|^[ \t]*Name|\bPatient|\bRef(?:erred)?\.?[ \t]*By|\bReferring[ \t]+(?:Doctor|Physician)|\bConsultant|\bSigned[ \t]+by)[ \t]*[:-][ \t]*(?:(?i:Mr|Mrs|Ms|Miss|Dr|Master|Baby|Prof)\.?[ \t]+)?` + personName),
+		group:    1,
+		trim:     trimNameTail,
+	},
+	{
+		category: Name,
+		re:       regexp.MustCompile(`\b(?:Dr|Mr|Mrs|Ms|Miss|Prof)\.?[ \t]+` + personName),
+		group:    1,
+		trim:     trimNameTail,
+	},
+}
+
+// Words that end a name captured from a form line, e.g. the "Age" in
+// "Patient Name: JOHN DOE Age: 45"
+var nameStopWords = map[string]bool{
+	"age": true, "sex": true, "gender": true, "dob": true, "date": true, "mrn": true, "id": true,
+	"uhid": true, "ref": true, "years": true, "yrs": true, "y": true, "male": true, "female": true,
+	"m": true, "f": true, "collected": true, "received": true, "reported": true, "sample": true,
+	"lab": true, "no": true, "phone": true, "mobile": true, "address": true, "the": true,
+}
+
+func trimNameTail(name string) string {
+	for _, w := range wordRe.FindAllStringIndex(name, -1) {
+		if nameStopWords[strings.ToLower(strings.Trim(name[w[0]:w[1]], ".'-"))] {
+			return strings.TrimRight(name[:w[0]], " \t")
+		}
+	}
+	return name
+}
+
+var wordRe = regexp.MustCompile(`\S+`)
+
+func hasDigit(s string) bool {
+	return strings.ContainsAny(s, "0123456789")
+}
+
+var (
+	digitGroupRe = regexp.MustCompile(`\d+`)
+	// A hyphen between spaces separates the bounds of a reference range
+	rangeRe = regexp.MustCompile(`\d[ \t]+-|-[ \t]+\d`)
+	// Groupings of ten digit numbers written with spaces, e.g. 98765 43210
+	// or 555 123 4567. Lab values in a row rarely fall into them.
+	spacedPhones = map[string]bool{"5 5": true, "3 3 4": true, "2 4 4": true, "4 3 3": true}
+)
+
+// phoneShape accepts what looks like a phone number rather than a row of
+// lab values: 7 to 15 digits after a country code, or 10 to 15 digits that
+// are run together, grouped with hyphens, start with a bracketed area code
+// or are spaced in a usual grouping. The pattern never matches decimal
+// points, and reference ranges such as "150 - 400" are refused.
+func phoneShape(s string) bool {
+	groups := digitGroupRe.FindAllString(s, -1)
+	n := 0
+	lengths := make([]string, len(groups))
+	for i, g := range groups {
+		n += len(g)
+		lengths[i] = strconv.Itoa(len(g))
+	}
+	if rangeRe.MatchString(s) {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(s, "+"):
+		return n >= 7 && n <= 15
+	case n < 10 || n > 15:
+		return false
+	case len(groups) == 1, strings.HasPrefix(s, "("):
+		return true
+	case !strings.ContainsAny(s, " \t"):
+		return true // Hyphen grouped, e.g. 080-2345-6789
+	}
+	return spacedPhones[strings.Join(lengths, " ")]
+}
+
+// notInNumber refuses matches that are part of a larger number, such as
+// the digits after the decimal point of "120.0"
+func notInNumber(text string, start, end int) bool {
+	if start > 0 && (text[start-1] == '.' || text[start-1] == ',' || isDigit(text[start-1])) {
+		return false
+	}
+	if end < len(text) && (text[end] == '.' || text[end] == ',') && end+1 < len(text) && isDigit(text[end+1]) {
+		return false
+	}
+	return true
+}
+
+// dateLabelRe finds the labels that make a two digit year a date, e.g.
+// "DOB: 12/03/75"
+var dateLabelRe = regexp.MustCompile(`(?i)\b(?:date|dob|d\.o\.b|born|birth|collected|collection|reported|received|registered|sampled|visit)\b`)
+
+// numericDate accepts dates such as 12/03/1975 outside larger numbers.
+// Two digit years are only taken as dates after a date label, as values
+// like "12.0-15.5" split up oddly otherwise.
+func numericDate(text string, start, end int) bool {
+	if !notInNumber(text, start, end) {
+		return false
+	}
+	if year := digitGroupRe.FindAllString(text[start:end], -1); len(year[len(year)-1]) == 4 {
+		return true
+	}
+	from := start - 30
+	if from < 0 {
+		from = 0
+	}
+	return dateLabelRe.MatchString(text[from:start])
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// detect finds the identifiers of the given categories in text, and every
+// case-insensitive occurrence of known values. Overlapping finds keep the
+// earliest, then the longest.
+func detect(text string, policy Policy, known []Identifier) []span {
+	var spans []span
+	for _, id := range known {
+		if !policy[id.Category] {
+			continue
+		}
+		for _, value := range id.variants() {
+			re := regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(value) + `\b`)
+			for _, m := range re.FindAllStringIndex(text, -1) {
+				spans = append(spans, span{m[0], m[1], id.Category})
+			}
+		}
+	}
+	for _, d := range detectors {
+		if !policy[d.category] {
+			continue
+		}
+		for _, m := range d.re.FindAllStringSubmatchIndex(text, -1) {
+			start, end := m[2*d.group], m[2*d.group+1]
+			if start < 0 {
+				continue
+			}
+			value := strings.TrimRight(text[start:end], " \t.,;")
+			if d.trim != nil {
+				value = d.trim(value) // Keeps a prefix, so the span still lines up
+			}
+			if value == "" || (d.valid != nil && !d.valid(value)) ||
+				(d.at != nil && !d.at(text, start, start+len(value))) {
+				continue
+			}
+			spans = append(spans, span{start, start + len(value), d.category})
+		}
+	}
+
+	sort.SliceStable(spans, func(i, j int) bool {
+		if spans[i].start != spans[j].start {
+			return spans[i].start < spans[j].start
+		}
+		return spans[i].end > spans[j].end
+	})
+	var out []span
+	for _, s := range spans {
+		if len(out) > 0 && s.start < out[len(out)-1].end {
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
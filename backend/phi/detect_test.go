@@ -0,0 +1,53 @@
+package phi
+
+import "testing"
+
+func redactAll(t *testing.T, text string) string {
+	t.Helper()
+	policy, err := ParsePolicy("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSession(policy).Redact(text)
+}
+
+func TestLabRowsPassThrough(t *testing.T) {
+	rows := []string{
+		"Ferritin 120.0 20.0 - 300.0",
+		"Vitamin B12 1450.0 200.0 - 900.0 pg/mL",
+		"Hemoglobin 13.5 g/dL 12.0-15.5",
+		"Platelet Count 250000 150000 - 450000 /uL",
+		"WBC 7.2 4.0 - 11.0 10^3/uL",
+		"TSH 2.35 0.45-4.50 uIU/mL",
+		"Glucose, Fasting 92 70 - 99 mg/dL",
+		"HbA1c 5.6 % 4.0 - 5.6",
+		"RBC 4.85 4.20-5.40 M/uL",
+		"Cholesterol 1,234.5 mg/dL",
+	}
+	for _, row := range rows {
+		if got := redactAll(t, row); got != row {
+			t.Errorf("Redact(%q) = %q, want unchanged", row, got)
+		}
+	}
+}
+
+func TestRedactsIdentifiers(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"Phone: +91 98765 43210", "Phone: [PHONE_1]"},
+		{"Call 9876543210 today", "Call [PHONE_1] today"},
+		{"Mobile 98765 43210", "Mobile [PHONE_1]"},
+		{"Tel (555) 123-4567", "Tel [PHONE_1]"},
+		{"Office 080-2345-6789", "Office [PHONE_1]"},
+		{"Collected: 01/15/2024", "Collected: [DATE_1]"},
+		{"DOB: 12/03/75", "DOB: [DATE_1]"},
+		{"Reported on 2024-01-15", "Reported on [DATE_1]"},
+		{"Seen 15 March 2024", "Seen [DATE_1]"},
+	}
+	for _, tt := range tests {
+		if got := redactAll(t, tt.text); got != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// phi/generator.go
+package phi
+
+import (
+	"context"
+	"encoding/json"
+
+	"backend/llm"
+)
+
+// Generator redacts prompts before passing them to Next and restores the
+// placeholders in its answers. Identifiers carried by the context (see
+// WithKnown) are redacted along with the ones the detectors find.
+type Generator struct {
+	Next   llm.Generator
+	Policy Policy
+}
+
+// WrapGenerator redacts what g is sent according to policy. An empty policy
+// returns g unchanged.
+func WrapGenerator(g llm.Generator, policy Policy) llm.Generator {
+	if len(policy) == 0 {
+		return g
+	}
+	return &Generator{Next: g, Policy: policy}
+}
+
+func (g *Generator) Name() string {
+	return g.Next.Name()
+}
+
+func (g *Generator) SupportsTools() bool {
+	return llm.SupportsTools(g.Next)
+}
+
+func (g *Generator) Generate(ctx context.Context, req llm.Request) (*llm.Response, error) {
+	session := NewSession(g.Policy, Known(ctx)...)
+	resp, err := g.Next.Generate(ctx, redactRequest(session, req))
+	if resp != nil {
+		resp.Text = session.Restore(resp.Text)
+		resp.ToolCalls = restoreCalls(session, resp.ToolCalls)
+	}
+	return resp, err
+}
+
+func (g *Generator) Stream(ctx context.Context, req llm.Request, onToken func(string)) (*llm.Response, error) {
+	session := NewSession(g.Policy, Known(ctx)...)
+	restorer := session.NewRestorer(onToken)
+	resp, err := g.Next.Stream(ctx, redactRequest(session, req), restorer.Write)
+	restorer.Flush()
+	if resp != nil {
+		resp.Text = session.Restore(resp.Text)
+		resp.ToolCalls = restoreCalls(session, resp.ToolCalls)
+	}
+	return resp, err
+}
+
+// redactRequest returns a copy of req with every message, including tool
+// results and the arguments of earlier tool calls, redacted
+func redactRequest(session *Session, req llm.Request) llm.Request {
+	messages := make([]llm.Message, len(req.Messages))
+	for i, m := range req.Messages {
+		messages[i] = m
+		messages[i].Content = session.Redact(m.Content)
+		messages[i].ToolCalls = nil
+		for _, call := range m.ToolCalls {
+			call.Arguments = convertJSON(call.Arguments, session.Redact, json.RawMessage("{}"))
+			messages[i].ToolCalls = append(messages[i].ToolCalls, call)
+		}
+	}
+	req.Messages = messages
+	return req
+}
+
+// restoreCalls puts identifiers back into the arguments of tool calls
+func restoreCalls(session *Session, calls []llm.ToolCall) []llm.ToolCall {
+	for i := range calls {
+		calls[i].Arguments = convertJSON(calls[i].Arguments, session.Restore, calls[i].Arguments)
+	}
+	return calls
+}
+
+// convertJSON applies f to encoded JSON, returning fallback when the result
+// would no longer parse
+func convertJSON(data json.RawMessage, f func(string) string, fallback json.RawMessage) json.RawMessage {
+	out := json.RawMessage(f(string(data)))
+	if !json.Valid(out) {
+		return fallback
+	}
+	return out
+}
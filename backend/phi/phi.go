@@ -0,0 +1,225 @@
+// phi/phi.go
+package phi
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Policy is the set of identifier categories to replace before text leaves
+// the backend
+type Policy map[string]bool
+
+var categoryNames = map[string]string{
+	Name: Name, "names": Name,
+	Email: Email, "emails": Email,
+	Phone: Phone, "phones": Phone,
+	MRN: MRN, "mrns": MRN,
+	Address: Address, "addresses": Address,
+	Date: Date, "dates": Date,
+}
+
+// ParsePolicy reads "all", "none" or a comma separated list of categories
+func ParsePolicy(s string) (Policy, error) {
+	policy := Policy{}
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "none", "off":
+		return policy, nil
+	case "all", "on":
+		for _, c := range Categories {
+			policy[c] = true
+		}
+		return policy, nil
+	}
+	for _, c := range strings.Split(s, ",") {
+		c = strings.ToLower(strings.TrimSpace(c))
+		category, ok := categoryNames[c]
+		if !ok {
+			return nil, fmt.Errorf("phi: unknown category %q", c)
+		}
+		policy[category] = true
+	}
+	return policy, nil
+}
+
+// PolicyFor returns the configured policy, or the default for a provider
+// when setting is empty. Hosted providers get everything redacted; local
+// ones (ollama, fake, the hash embedder) get nothing.
+func PolicyFor(provider, setting string) (Policy, error) {
+	if setting == "" {
+		switch provider {
+		case "ollama", "fake", "hash":
+			setting = "none"
+		default:
+			setting = "all"
+		}
+	}
+	return ParsePolicy(setting)
+}
+
+// Identifier is a value known to identify the user, such as their name,
+// found wherever it appears rather than only where a pattern spots it
+type Identifier struct {
+	Category string
+	Value    string
+}
+
+// variants returns the value and, for names, each part of it
+func (id Identifier) variants() []string {
+	value := strings.TrimSpace(id.Value)
+	if value == "" {
+		return nil
+	}
+	out := []string{value}
+	if id.Category == Name {
+		for _, part := range strings.Fields(value) {
+			if len([]rune(part)) >= 3 && part != value {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
+
+type knownKey struct{}
+
+// WithKnown returns a context carrying identifiers of the user a request is
+// made for
+func WithKnown(ctx context.Context, ids ...Identifier) context.Context {
+	return context.WithValue(ctx, knownKey{}, append(Known(ctx), ids...))
+}
+
+// Known returns the identifiers carried by ctx
+func Known(ctx context.Context) []Identifier {
+	ids, _ := ctx.Value(knownKey{}).([]Identifier)
+	return append([]Identifier(nil), ids...)
+}
+
+// Session replaces identifiers with placeholders such as [NAME_1] and puts
+// them back. The same value gets the same placeholder throughout a session,
+// so one session should cover a whole prompt and its response.
+type Session struct {
+	policy Policy
+	known  []Identifier
+
+	mu        sync.Mutex
+	byValue   map[string]string // Category and normalized value -> placeholder
+	originals map[string]string // Placeholder -> first original text
+	counts    map[string]int
+}
+
+// NewSession starts a session replacing the categories in policy and the
+// known identifiers
+func NewSession(policy Policy, known ...Identifier) *Session {
+	return &Session{
+		policy:    policy,
+		known:     known,
+		byValue:   map[string]string{},
+		originals: map[string]string{},
+		counts:    map[string]int{},
+	}
+}
+
+// Redact replaces the identifiers in text
+func (s *Session) Redact(text string) string {
+	if len(s.policy) == 0 {
+		return text
+	}
+	spans := detect(text, s.policy, s.known)
+	if len(spans) == 0 {
+		return text
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var b strings.Builder
+	last := 0
+	for _, sp := range spans {
+		b.WriteString(text[last:sp.start])
+		b.WriteString(s.placeholder(sp.category, text[sp.start:sp.end]))
+		last = sp.end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+func (s *Session) placeholder(category, value string) string {
+	key := category + "\x00" + strings.ToLower(strings.Join(strings.Fields(value), " "))
+	if p, ok := s.byValue[key]; ok {
+		return p
+	}
+	s.counts[category]++
+	p := fmt.Sprintf("[%s_%d]", strings.ToUpper(category), s.counts[category])
+	s.byValue[key] = p
+	s.originals[p] = value
+	return p
+}
+
+// Count returns how many distinct identifiers were replaced
+func (s *Session) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.originals)
+}
+
+var placeholderRe = regexp.MustCompile(`\[(?:NAME|EMAIL|PHONE|MRN|ADDRESS|DATE)_\d+\]`)
+
+// Restore puts the original values back in place of placeholders
+func (s *Session) Restore(text string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.originals) == 0 {
+		return text
+	}
+	return placeholderRe.ReplaceAllStringFunc(text, func(p string) string {
+		if original, ok := s.originals[p]; ok {
+			return original
+		}
+		return p
+	})
+}
+
+// maxPlaceholder is longer than any placeholder a session hands out
+const maxPlaceholder = 24
+
+// partialPlaceholderRe matches text that could be the start of a placeholder
+var partialPlaceholderRe = regexp.MustCompile(`\[[A-Z]*(?:_\d*)?$`)
+
+// Restorer restores placeholders in streamed text, holding back a token
+// that ends partway through a placeholder until the rest arrives
+type Restorer struct {
+	session *Session
+	emit    func(string)
+	pending string
+}
+
+// NewRestorer passes restored text to emit
+func (s *Session) NewRestorer(emit func(string)) *Restorer {
+	return &Restorer{session: s, emit: emit}
+}
+
+// Write adds streamed text
+func (r *Restorer) Write(text string) {
+	r.pending += text
+	hold := 0
+	if i := strings.LastIndexByte(r.pending, '['); i >= 0 && len(r.pending)-i < maxPlaceholder &&
+		partialPlaceholderRe.MatchString(r.pending[i:]) {
+		hold = len(r.pending) - i
+	}
+	out := r.pending[:len(r.pending)-hold]
+	r.pending = r.pending[len(r.pending)-hold:]
+	if out != "" {
+		r.emit(r.session.Restore(out))
+	}
+}
+
+// Flush emits held back text
+func (r *Restorer) Flush() {
+	if r.pending != "" {
+		r.emit(r.session.Restore(r.pending))
+		r.pending = ""
+	}
+}
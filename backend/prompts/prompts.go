@@ -0,0 +1,154 @@
+// prompts/prompts.go
+package prompts
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Prompt names
+const (
+	Chat = "chat" // Answers to chatbot questions
+)
+
+//go:embed defaults/*.tmpl
+var defaults embed.FS
+
+// Template is a parsed prompt version: a system message and the user
+// message carrying the question, both Go text/templates over Data
+type Template struct {
+	Name    string
+	Version int // 0 for the built-in template
+
+	system *template.Template
+	user   *template.Template
+}
+
+// Label identifies the version in stored answers, e.g. "chat@3" or
+// "chat@builtin"
+func (t *Template) Label() string {
+	if t.Version == 0 {
+		return t.Name + "@builtin"
+	}
+	return fmt.Sprintf("%s@%d", t.Name, t.Version)
+}
+
+// Data is what a prompt is rendered from
+type Data struct {
+	Question string
+	Records  []Source // Passages of the user's own records
+	Context  []Source // Knowledge base passages
+	Profile  Profile
+	Language string // English name of the language to answer in, e.g. "Spanish"
+	Today    time.Time
+}
+
+// Source is a numbered passage the answer may cite
+type Source struct {
+	Number  int
+	Title   string
+	Date    *time.Time // Record date, nil for knowledge passages
+	Content string
+}
+
+// Profile is the user's health data from their profile. Fields are zero
+// when unknown.
+type Profile struct {
+	Age    int
+	Gender string
+	BMI    float64
+}
+
+var funcs = template.FuncMap{
+	// date formats a time or *time.Time as YYYY-MM-DD
+	"date": func(v interface{}) string {
+		switch t := v.(type) {
+		case time.Time:
+			return t.Format("2006-01-02")
+		case *time.Time:
+			if t != nil {
+				return t.Format("2006-01-02")
+			}
+		}
+		return ""
+	},
+	"join": strings.Join,
+}
+
+// Builtin returns the template of name shipped with the backend, used when
+// no stored version is rolled out
+func Builtin(name string) (*Template, error) {
+	system, user, err := BuiltinText(name)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(name, 0, system, user)
+}
+
+// BuiltinText returns the source of a built-in template, as a starting
+// point for new versions
+func BuiltinText(name string) (system, user string, err error) {
+	s, err := defaults.ReadFile("defaults/" + name + ".system.tmpl")
+	if err != nil {
+		return "", "", fmt.Errorf("unknown prompt %q", name)
+	}
+	u, err := defaults.ReadFile("defaults/" + name + ".user.tmpl")
+	if err != nil {
+		return "", "", fmt.Errorf("unknown prompt %q", name)
+	}
+	return string(s), string(u), nil
+}
+
+// Parse compiles a prompt version and checks that it renders sample data,
+// so a broken template is rejected when it is saved rather than when a user
+// asks a question
+func Parse(name string, version int, system, user string) (*Template, error) {
+	if strings.TrimSpace(system) == "" || strings.TrimSpace(user) == "" {
+		return nil, fmt.Errorf("system and user templates are required")
+	}
+	if !strings.Contains(user, ".Question") {
+		return nil, fmt.Errorf("user template must include {{.Question}}")
+	}
+	t := &Template{Name: name, Version: version}
+	var err error
+	if t.system, err = template.New("system").Funcs(funcs).Option("missingkey=error").Parse(system); err != nil {
+		return nil, err
+	}
+	if t.user, err = template.New("user").Funcs(funcs).Option("missingkey=error").Parse(user); err != nil {
+		return nil, err
+	}
+	if _, _, err := t.Render(sampleData()); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Render fills in the system and user messages
+func (t *Template) Render(data Data) (system, user string, err error) {
+	var b bytes.Buffer
+	if err := t.system.Execute(&b, data); err != nil {
+		return "", "", err
+	}
+	system = strings.TrimSpace(b.String())
+	b.Reset()
+	if err := t.user.Execute(&b, data); err != nil {
+		return "", "", err
+	}
+	return system, strings.TrimSpace(b.String()), nil
+}
+
+func sampleData() Data {
+	recorded := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	return Data{
+		Question: "How has my HbA1c changed?",
+		Records:  []Source{{Number: 1, Title: "labs.pdf", Date: &recorded, Content: "HbA1c 7.1 %"}},
+		Context:  []Source{{Number: 2, Title: "Diabetes guide", Content: "An HbA1c below 7% is a common target."}},
+		Profile:  Profile{Age: 56, Gender: "male", BMI: 29.4},
+		Language: "English",
+		Today:    time.Now(),
+	}
+}
@@ -0,0 +1,138 @@
+// prompts/store.go
+package prompts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrUnknownVersion is returned when a rollout names a version that was
+// never saved
+var ErrUnknownVersion = errors.New("unknown prompt version")
+
+// Store keeps prompt versions in the database and picks the one a user is
+// served
+type Store struct {
+	DB *gorm.DB
+
+	parsed sync.Map // name@version -> *Template; versions never change
+}
+
+func NewStore(db *gorm.DB) *Store {
+	return &Store{DB: db}
+}
+
+// Select returns the version of name served to userID. Users are split
+// between the versions with a weight by a hash of their ID, so each user
+// stays in one cohort while the weights are unchanged. Without weighted
+// versions the built-in template is served.
+func (s *Store) Select(ctx context.Context, userID uuid.UUID, name string) (*Template, error) {
+	var live []models.PromptTemplate
+	if err := s.DB.WithContext(ctx).Where("name = ? AND weight > 0", name).
+		Order("version").Find(&live).Error; err != nil {
+		return nil, err
+	}
+	if len(live) == 0 {
+		return Builtin(name)
+	}
+	return s.parse(pick(live, userID, name))
+}
+
+// pick chooses a version by the user's cohort
+func pick(live []models.PromptTemplate, userID uuid.UUID, name string) models.PromptTemplate {
+	total := 0
+	for _, v := range live {
+		total += v.Weight
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name + ":" + userID.String()))
+	n := int(h.Sum32() % uint32(total))
+	for _, v := range live {
+		if n < v.Weight {
+			return v
+		}
+		n -= v.Weight
+	}
+	return live[len(live)-1]
+}
+
+func (s *Store) parse(v models.PromptTemplate) (*Template, error) {
+	key := fmt.Sprintf("%s@%d", v.Name, v.Version)
+	if t, ok := s.parsed.Load(key); ok {
+		return t.(*Template), nil
+	}
+	t, err := Parse(v.Name, v.Version, v.System, v.User)
+	if err != nil {
+		return nil, fmt.Errorf("prompt %s: %w", key, err)
+	}
+	s.parsed.Store(key, t)
+	return t, nil
+}
+
+// Versions lists the saved versions of name, newest first
+func (s *Store) Versions(name string) ([]models.PromptTemplate, error) {
+	var versions []models.PromptTemplate
+	err := s.DB.Where("name = ?", name).Order("version DESC").Find(&versions).Error
+	return versions, err
+}
+
+// Create validates and saves a new version of name. It is not served until
+// a rollout gives it a weight.
+func (s *Store) Create(name, system, user, description string, createdBy *uuid.UUID) (*models.PromptTemplate, error) {
+	if _, err := Builtin(name); err != nil {
+		return nil, err
+	}
+	if _, err := Parse(name, 0, system, user); err != nil {
+		return nil, err
+	}
+	v := &models.PromptTemplate{Name: name, System: system, User: user, Description: description, CreatedBy: createdBy}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var latest struct{ Version int }
+		if err := tx.Model(&models.PromptTemplate{}).Select("COALESCE(MAX(version), 0) AS version").
+			Where("name = ?", name).Scan(&latest).Error; err != nil {
+			return err
+		}
+		v.Version = latest.Version + 1
+		return tx.Create(v).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// SetWeights replaces the rollout of name: each listed version is served to
+// its share of users and every other version to none. Empty weights go back
+// to the built-in template.
+func (s *Store) SetWeights(name string, weights map[int]int) error {
+	for version, weight := range weights {
+		if weight < 0 {
+			return fmt.Errorf("weight of version %d must not be negative", version)
+		}
+	}
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.PromptTemplate{}).Where("name = ?", name).
+			Update("weight", 0).Error; err != nil {
+			return err
+		}
+		for version, weight := range weights {
+			result := tx.Model(&models.PromptTemplate{}).Where("name = ? AND version = ?", name, version).
+				Update("weight", weight)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,102 @@
+// rag/chunk.go
+package rag
+
+import (
+	"strings"
+)
+
+// separators are tried in order, so chunks break at paragraphs before
+// lines, sentences and words
+var separators = []string{"\n\n", "\n", ". ", " "}
+
+// Split cuts text into chunks of at most size bytes, where possible at
+// natural boundaries, with overlap bytes repeated between neighbours so a
+// sentence cut in two still appears whole in one chunk
+func Split(text string, size, overlap int) []string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	if overlap >= size {
+		overlap = size / 4
+	}
+
+	var chunks []string
+	for _, piece := range pieces(text, size-overlap, 0) {
+		if len(chunks) > 0 && overlap > 0 {
+			piece = tail(chunks[len(chunks)-1], overlap) + piece
+		}
+		if s := strings.TrimSpace(piece); s != "" {
+			chunks = append(chunks, s)
+		}
+	}
+	return chunks
+}
+
+// pieces splits text on the first separator that yields pieces under size,
+// recursing into pieces that are still too long, and merges small neighbours
+func pieces(text string, size, level int) []string {
+	if len(text) <= size {
+		return []string{text}
+	}
+	if level == len(separators) {
+		return hardSplit(text, size)
+	}
+
+	sep := separators[level]
+	var out []string
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			out = append(out, current.String())
+			current.Reset()
+		}
+	}
+	for _, part := range strings.SplitAfter(text, sep) {
+		if len(part) > size {
+			flush()
+			out = append(out, pieces(part, size, level+1)...)
+			continue
+		}
+		if current.Len()+len(part) > size {
+			flush()
+		}
+		current.WriteString(part)
+	}
+	flush()
+	return out
+}
+
+// hardSplit cuts text without a separator at rune boundaries
+func hardSplit(text string, size int) []string {
+	var out []string
+	for len(text) > size {
+		cut := size
+		for cut > 0 && !isRuneStart(text[cut]) {
+			cut--
+		}
+		out = append(out, text[:cut])
+		text = text[cut:]
+	}
+	return append(out, text)
+}
+
+// tail returns about the last n bytes of s, starting at a word
+func tail(s string, n int) string {
+	if len(s) <= n {
+		return s + " "
+	}
+	t := s[len(s)-n:]
+	if i := strings.IndexByte(t, ' '); i >= 0 {
+		t = t[i+1:]
+	} else {
+		for len(t) > 0 && !isRuneStart(t[0]) {
+			t = t[1:]
+		}
+	}
+	return t + " "
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
@@ -0,0 +1,224 @@
+// rag/embed.go
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"backend/models"
+	"backend/phi"
+	"backend/upstream"
+	"backend/usage"
+)
+
+// Embedder turns texts into vectors of models.EmbeddingDimensions
+type Embedder interface {
+	// Name identifies the embedding model; vectors from different models
+	// must not be compared
+	Name() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// HTTPEmbedder calls an OpenAI compatible /v1/embeddings endpoint, as served
+// locally by llama.cpp (--embedding), Hugging Face text-embeddings-inference
+// or Ollama
+type HTTPEmbedder struct {
+	BaseURL string
+	Model   string
+	APIKey  string
+	Client  *upstream.Client
+}
+
+type embeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+func (e *HTTPEmbedder) Name() string { return e.Model }
+
+func (e *HTTPEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	body, err := json.Marshal(embeddingRequest{Model: e.Model, Input: texts})
+	if err != nil {
+		return nil, err
+	}
+	headers := map[string]string{}
+	if e.APIKey != "" {
+		headers["Authorization"] = "Bearer " + e.APIKey
+	}
+	resp, err := e.Client.Do(ctx, upstream.Request{
+		Method:     http.MethodPost,
+		URL:        e.BaseURL + "/v1/embeddings",
+		Header:     headers,
+		Body:       body,
+		Idempotent: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out embeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	if len(out.Data) != len(texts) {
+		return nil, fmt.Errorf("embedding server returned %d vectors for %d texts", len(out.Data), len(texts))
+	}
+	sort.Slice(out.Data, func(i, j int) bool { return out.Data[i].Index < out.Data[j].Index })
+	vectors := make([][]float32, len(texts))
+	for i, d := range out.Data {
+		if len(d.Embedding) != models.EmbeddingDimensions {
+			return nil, fmt.Errorf("embedding has %d dimensions, want %d", len(d.Embedding), models.EmbeddingDimensions)
+		}
+		vectors[i] = d.Embedding
+	}
+	return vectors, nil
+}
+
+// HashEmbedder is a deterministic bag-of-words embedder using feature
+// hashing. It needs no model server, which suits tests, evaluation runs and
+// development machines, but only captures word overlap.
+type HashEmbedder struct{}
+
+func (HashEmbedder) Name() string { return "hash" }
+
+func (HashEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		v := make([]float32, models.EmbeddingDimensions)
+		for _, word := range Words(text) {
+			h := fnv.New32a()
+			h.Write([]byte(word))
+			sum := h.Sum32()
+			sign := float32(1)
+			if sum&1 == 1 {
+				sign = -1
+			}
+			v[(sum>>1)%uint32(len(v))] += sign
+		}
+		normalize(v)
+		vectors[i] = v
+	}
+	return vectors, nil
+}
+
+// Words lowercases text and splits it into letter and digit runs
+func Words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func normalize(v []float32) {
+	var sum float64
+	for _, f := range v {
+		sum += float64(f) * float64(f)
+	}
+	if sum == 0 {
+		return
+	}
+	n := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= n
+	}
+}
+
+// EmbedderFromEnv returns the embedder selected by EMBEDDING_PROVIDER:
+// "http" (default) calls EMBEDDING_URL with EMBEDDING_MODEL, "hash" uses
+// HashEmbedder. Text sent over http is redacted per EMBEDDING_PHI (see
+// phi.ParsePolicy), everything by default.
+func EmbedderFromEnv() (Embedder, error) {
+	switch strings.ToLower(os.Getenv("EMBEDDING_PROVIDER")) {
+	case "", "http":
+		policy, err := phi.PolicyFor("http", os.Getenv("EMBEDDING_PHI"))
+		if err != nil {
+			return nil, err
+		}
+		baseURL := strings.TrimRight(envOr("EMBEDDING_URL", "http://localhost:8082"), "/")
+		return redact(&HTTPEmbedder{
+			BaseURL: baseURL,
+			Model:   envOr("EMBEDDING_MODEL", "sentence-transformers/all-MiniLM-L6-v2"),
+			APIKey:  os.Getenv("EMBEDDING_API_KEY"),
+			Client:  upstream.New("embeddings "+baseURL, upstream.Options{Timeout: 30 * time.Second}),
+		}, policy), nil
+	case "hash":
+		return HashEmbedder{}, nil
+	}
+	return nil, fmt.Errorf("unknown embedding provider %q", os.Getenv("EMBEDDING_PROVIDER"))
+}
+
+// redactedEmbedder embeds texts with identifiers replaced by placeholders,
+// so record text is not sent to the embedding service as is
+type redactedEmbedder struct {
+	Embedder
+	policy phi.Policy
+}
+
+// redact wraps e unless policy is empty
+func redact(e Embedder, policy phi.Policy) Embedder {
+	if len(policy) == 0 {
+		return e
+	}
+	return redactedEmbedder{Embedder: e, policy: policy}
+}
+
+func (e redactedEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	session := phi.NewSession(e.policy, phi.Known(ctx)...)
+	redacted := make([]string, len(texts))
+	for i, t := range texts {
+		redacted[i] = session.Redact(t)
+	}
+	return e.Embedder.Embed(ctx, redacted)
+}
+
+// meteredEmbedder records the texts it embeds as usage
+type meteredEmbedder struct {
+	Embedder
+	meter *usage.Meter
+}
+
+// MeterEmbedder records the calls to e in m, with token counts estimated
+// from the texts. A nil meter returns e unchanged.
+func MeterEmbedder(e Embedder, m *usage.Meter) Embedder {
+	if m == nil {
+		return e
+	}
+	return meteredEmbedder{Embedder: e, meter: m}
+}
+
+func (e meteredEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	started := time.Now()
+	vectors, err := e.Embedder.Embed(ctx, texts)
+	call := usage.Call{Feature: usage.Embedding, Model: e.Name(), Estimated: true, Latency: time.Since(started), Failed: err != nil}
+	for _, t := range texts {
+		call.PromptTokens += usage.EstimateTokens(t)
+	}
+	e.meter.Record(ctx, call)
+	return vectors, err
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
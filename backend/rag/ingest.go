@@ -0,0 +1,142 @@
+// rag/ingest.go
+package rag
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"backend/cache"
+	"backend/models"
+
+	"github.com/ledongthuc/pdf"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Ingester chunks reference documents, embeds the chunks and stores them in
+// knowledge_chunks. Chunks are keyed by content hash, so re-running an
+// ingestion only embeds text that is new.
+type Ingester struct {
+	DB       *gorm.DB
+	Embedder Embedder
+	Size     int // Chunk size in bytes
+	Overlap  int // Bytes repeated between neighbouring chunks
+	Batch    int // Chunks per embedding call
+}
+
+// NewIngester uses the chunking of the original notebook: 500 characters
+// with an overlap of 20
+func NewIngester(db *gorm.DB, embedder Embedder) *Ingester {
+	return &Ingester{DB: db, Embedder: embedder, Size: 500, Overlap: 20, Batch: 32}
+}
+
+// Ingest stores the chunks of one document and returns how many were new.
+// With replace set, earlier chunks of the same source are removed first.
+// Any change moves the knowledge base to a new cache version, so cached
+// retrievals are not served from before it.
+func (in *Ingester) Ingest(ctx context.Context, source, text string, replace bool) (added int, err error) {
+	chunks := Split(text, in.Size, in.Overlap)
+	if len(chunks) == 0 {
+		return 0, nil
+	}
+	defer func() {
+		if added > 0 || replace {
+			if err := cache.NewVersions(in.DB).Bump(context.WithoutCancel(ctx), cache.Knowledge); err != nil {
+				log.Printf("rag: invalidating cached retrievals: %v", err)
+			}
+		}
+	}()
+
+	if replace {
+		if err := in.DB.Where("source = ?", source).Delete(&models.KnowledgeChunk{}).Error; err != nil {
+			return 0, err
+		}
+	}
+
+	// Skip chunks that are already stored with this embedding model
+	hashes := make([]string, len(chunks))
+	for i, c := range chunks {
+		hashes[i] = ContentHash(c)
+	}
+	var existing []string
+	if err := in.DB.Model(&models.KnowledgeChunk{}).
+		Where("hash IN ? AND model = ?", hashes, in.Embedder.Name()).
+		Pluck("hash", &existing).Error; err != nil {
+		return 0, err
+	}
+	stored := make(map[string]bool, len(existing))
+	for _, h := range existing {
+		stored[h] = true
+	}
+
+	var pending []models.KnowledgeChunk
+	for i, c := range chunks {
+		if stored[hashes[i]] {
+			continue
+		}
+		stored[hashes[i]] = true // Documents can repeat boilerplate
+		pending = append(pending, models.KnowledgeChunk{
+			Source:  source,
+			Seq:     i,
+			Content: c,
+			Hash:    hashes[i],
+			Model:   in.Embedder.Name(),
+		})
+	}
+
+	for start := 0; start < len(pending); start += in.Batch {
+		end := start + in.Batch
+		if end > len(pending) {
+			end = len(pending)
+		}
+		batch := pending[start:end]
+
+		texts := make([]string, len(batch))
+		for i, c := range batch {
+			texts[i] = c.Content
+		}
+		vectors, err := in.Embedder.Embed(ctx, texts)
+		if err != nil {
+			return added, fmt.Errorf("embedding %s: %w", source, err)
+		}
+		for i := range batch {
+			batch[i].Embedding = vectors[i]
+		}
+
+		// A chunk embedded with an older model is replaced
+		if err := in.DB.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "hash"}},
+			DoUpdates: clause.AssignmentColumns([]string{"source", "seq", "embedding", "model"}),
+		}).Create(&batch).Error; err != nil {
+			return added, err
+		}
+		added += len(batch)
+	}
+	return added, nil
+}
+
+// ReadDocument extracts the text of a .txt, .md or .pdf file
+func ReadDocument(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".txt", ".md":
+		data, err := ioutil.ReadFile(path)
+		return string(data), err
+	case ".pdf":
+		f, r, err := pdf.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		reader, err := r.GetPlainText()
+		if err != nil {
+			return "", err
+		}
+		data, err := ioutil.ReadAll(reader)
+		return string(data), err
+	}
+	return "", fmt.Errorf("unsupported document type %q", filepath.Ext(path))
+}
@@ -0,0 +1,56 @@
+// rag/python.go
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"backend/upstream"
+)
+
+// PythonRetriever calls the legacy /query service backed by Pinecone. It
+// returns passages in the service's order with decreasing scores.
+type PythonRetriever struct {
+	URL    string
+	Client *upstream.Client
+}
+
+// NewPythonRetriever creates a retriever for the service at baseURL
+func NewPythonRetriever(baseURL string) *PythonRetriever {
+	return &PythonRetriever{
+		URL:    baseURL + "/query",
+		Client: upstream.New("retriever "+baseURL, upstream.Options{Timeout: 30 * time.Second}),
+	}
+}
+
+type pythonResponse struct {
+	Texts []string `json:"texts"`
+}
+
+func (r *PythonRetriever) Retrieve(ctx context.Context, query string, k int) ([]Passage, error) {
+	body, err := json.Marshal(map[string]interface{}{"query": query})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.Client.Do(ctx, upstream.Request{Method: http.MethodPost, URL: r.URL, Body: body, Idempotent: true})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out pythonResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+
+	passages := make([]Passage, 0, len(out.Texts))
+	for i, text := range out.Texts {
+		if i == k {
+			break
+		}
+		passages = append(passages, Passage{ID: ContentHash(text), Kind: KindKnowledge, Content: text, Score: 1 / float64(rrfK+i+1)})
+	}
+	return passages, nil
+}
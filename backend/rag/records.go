@@ -0,0 +1,367 @@
+// rag/records.go
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"backend/cache"
+	"backend/labs"
+	"backend/models"
+	"backend/usage"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RecordIndex keeps chunks of each user's health records embedded, so a
+// question only pulls in the records it is about instead of all of them
+type RecordIndex struct {
+	DB         *gorm.DB
+	Embedder   Embedder
+	Size       int           // Chunk size in bytes
+	Overlap    int           // Bytes repeated between neighbouring chunks
+	Candidates int           // Rows fetched from each ranking before fusion
+	HalfLife   time.Duration // Age at which a record's score is weighted halfway down to MinWeight
+	MinWeight  float64       // Weight of very old records, so they are demoted but still found
+	Cache      *cache.Cache  // Retrieval results, keyed on the user's data version; nil disables
+	CacheTTL   time.Duration
+	Meter      *usage.Meter // Searches that miss the cache; nil disables
+}
+
+// NewRecordIndex creates a record index with defaults suited to lab reports
+func NewRecordIndex(db *gorm.DB, embedder Embedder) *RecordIndex {
+	return &RecordIndex{
+		DB:         db,
+		Embedder:   embedder,
+		Size:       800,
+		Overlap:    80,
+		Candidates: 30,
+		HalfLife:   180 * 24 * time.Hour,
+		MinWeight:  0.5,
+	}
+}
+
+// RecordIndexFromEnv creates a record index using the embedder selected by
+// EmbedderFromEnv, caching results in cache.FromEnv for CACHE_RECORDS_TTL
+// (default 10m) and metering embeddings and searches in usage.FromEnv
+func RecordIndexFromEnv(db *gorm.DB) (*RecordIndex, error) {
+	embedder, err := EmbedderFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	meter := usage.FromEnv(db)
+	ix := NewRecordIndex(db, MeterEmbedder(embedder, meter))
+	ix.Cache, ix.CacheTTL = cache.FromEnv(db), cache.TTL("records", 10*time.Minute)
+	ix.Meter = meter
+	return ix, nil
+}
+
+// Index replaces the chunks of one health record and marks it indexed with
+// the embedding model, even when it has no text to chunk. Embedding it
+// counts towards the usage of the record's owner.
+func (ix *RecordIndex) Index(ctx context.Context, record models.HealthData) error {
+	ctx = usage.WithUser(ctx, record.UserID)
+	var data map[string]interface{}
+	if err := json.Unmarshal(record.Data, &data); err != nil {
+		return fmt.Errorf("decoding record %s: %w", record.ID, err)
+	}
+	kind, title, text := RecordText(data)
+
+	var chunks []models.RecordChunk
+	if pieces := Split(text, ix.Size, ix.Overlap); len(pieces) > 0 {
+		recordedAt := ix.recordedAt(record.ID, data, text)
+		texts := make([]string, len(pieces))
+		for i, p := range pieces {
+			// Each chunk carries its record's title so it reads on its own
+			texts[i] = title + "\n" + p
+		}
+		vectors, err := ix.Embedder.Embed(ctx, texts)
+		if err != nil {
+			return fmt.Errorf("embedding record %s: %w", record.ID, err)
+		}
+		for i := range texts {
+			chunks = append(chunks, models.RecordChunk{
+				UserID:       record.UserID,
+				HealthDataID: record.ID,
+				Kind:         kind,
+				Seq:          i,
+				Content:      texts[i],
+				Embedding:    vectors[i],
+				Model:        ix.Embedder.Name(),
+				RecordedAt:   recordedAt,
+			})
+		}
+	}
+
+	changed := false
+	err := ix.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the record so an upload and a question indexing it at the
+		// same time do not both insert chunks
+		var locked models.HealthData
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			Where("id = ?", record.ID).First(&locked).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil // Deleted meanwhile
+			}
+			return err
+		}
+		deleted := tx.Where("health_data_id = ?", record.ID).Delete(&models.RecordChunk{})
+		if deleted.Error != nil {
+			return deleted.Error
+		}
+		if len(chunks) > 0 {
+			if err := tx.Create(&chunks).Error; err != nil {
+				return err
+			}
+		}
+		changed = deleted.RowsAffected > 0 || len(chunks) > 0
+		return tx.Model(&models.HealthData{}).Where("id = ?", record.ID).
+			Update("indexed_model", ix.Embedder.Name()).Error
+	})
+	if err != nil {
+		return err
+	}
+	// Cached results only go stale when the chunks changed
+	if changed {
+		ix.Invalidate(ctx, record.UserID)
+	}
+	return nil
+}
+
+// Invalidate drops the user's cached retrieval results. Index calls it;
+// callers deleting records call it themselves.
+func (ix *RecordIndex) Invalidate(ctx context.Context, userID uuid.UUID) {
+	ix.Cache.Invalidate(context.WithoutCancel(ctx), cache.UserScope(userID))
+}
+
+// IndexAsync indexes a new record in the background. Records that fail here
+// are picked up again by EnsureIndexed before the next question.
+func (ix *RecordIndex) IndexAsync(record models.HealthData) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := ix.Index(ctx, record); err != nil {
+			log.Printf("rag: indexing record %s: %v", record.ID, err)
+		}
+	}()
+}
+
+// EnsureIndexed indexes the user's records not yet indexed with the
+// current embedding model
+func (ix *RecordIndex) EnsureIndexed(ctx context.Context, userID uuid.UUID) error {
+	return ix.indexMissing(ctx, ix.DB.Where("hd.user_id = ?", userID))
+}
+
+// IndexAll indexes every user's unindexed records, for backfills
+func (ix *RecordIndex) IndexAll(ctx context.Context) error {
+	return ix.indexMissing(ctx, ix.DB)
+}
+
+// indexMissing indexes records not marked with the current model. Records
+// indexed before the mark existed count as indexed when they have chunks.
+// A record that fails is logged and left for the next call, so it does not
+// hold up the others.
+func (ix *RecordIndex) indexMissing(ctx context.Context, scope *gorm.DB) error {
+	var records []models.HealthData
+	model := ix.Embedder.Name()
+	err := scope.WithContext(ctx).Table("health_data hd").Select("hd.*").
+		Where("hd.indexed_model IS DISTINCT FROM ?", model).
+		Where("NOT EXISTS (SELECT 1 FROM record_chunks rc WHERE rc.health_data_id = hd.id AND rc.model = ?)", model).
+		Find(&records).Error
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, record := range records {
+		if err := ix.Index(ctx, record); err != nil {
+			log.Printf("rag: indexing record %s: %v", record.ID, err)
+			failed++
+			if ctx.Err() != nil {
+				break
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d records could not be indexed", failed, len(records))
+	}
+	return nil
+}
+
+// Retrieve returns the user's record passages most relevant to query, with
+// recent records weighted above old ones
+func (ix *RecordIndex) Retrieve(ctx context.Context, userID uuid.UUID, query string, k int) ([]Passage, error) {
+	if strings.TrimSpace(query) == "" || k <= 0 {
+		return []Passage{}, nil
+	}
+	if ix.Cache == nil || ix.CacheTTL <= 0 {
+		return ix.retrieve(ctx, userID, query, k)
+	}
+	version, err := ix.Cache.Version(ctx, cache.UserScope(userID))
+	if err != nil {
+		return ix.retrieve(ctx, userID, query, k)
+	}
+	var passages []Passage
+	key := cache.Key("records", userID, version, ix.Embedder.Name(), k, cache.Normalize(query))
+	_, err = ix.Cache.LoadJSON(ctx, key, &passages, func(ctx context.Context) (interface{}, time.Duration, error) {
+		passages, err := ix.retrieve(ctx, userID, query, k)
+		return passages, ix.CacheTTL, err
+	})
+	return passages, err
+}
+
+func (ix *RecordIndex) retrieve(ctx context.Context, userID uuid.UUID, query string, k int) (passages []Passage, err error) {
+	started := time.Now()
+	defer func() {
+		ix.Meter.Record(ctx, usage.Call{
+			Feature:      usage.Retrieval,
+			Model:        "records/" + ix.Embedder.Name(),
+			PromptTokens: usage.EstimateTokens(query),
+			Estimated:    true,
+			Latency:      time.Since(started),
+			Failed:       err != nil,
+		})
+	}()
+	db := ix.DB.WithContext(ctx)
+	const columns = `rc.id, rc.kind, rc.health_data_id AS record_id, rc.content, rc.recorded_at,
+		COALESCE(hd.data->>'file_name', '') AS source`
+
+	var keyword []passageRow
+	var keywordErr error
+	if terms := anyTerm(query); terms != "" {
+		// The tsvector expression matches idx_record_chunks_fts
+		keywordErr = db.Raw(`
+			SELECT `+columns+`, ts_rank(to_tsvector('english', rc.content), q) AS score
+			FROM record_chunks rc JOIN health_data hd ON hd.id = rc.health_data_id,
+				to_tsquery('english', ?) q
+			WHERE rc.user_id = ? AND to_tsvector('english', rc.content) @@ q
+			ORDER BY score DESC
+			LIMIT ?`, terms, userID, ix.Candidates).Scan(&keyword).Error
+	}
+
+	var semantic []passageRow
+	semanticErr := func() error {
+		vectors, err := ix.Embedder.Embed(ctx, []string{query})
+		if err != nil {
+			return err
+		}
+		vec := models.Vector(vectors[0])
+		return db.Raw(`
+			SELECT `+columns+`, 1 - (rc.embedding <=> ?::vector) AS score
+			FROM record_chunks rc JOIN health_data hd ON hd.id = rc.health_data_id
+			WHERE rc.user_id = ? AND rc.model = ?
+			ORDER BY rc.embedding <=> ?::vector
+			LIMIT ?`, vec, userID, ix.Embedder.Name(), vec, ix.Candidates).Scan(&semantic).Error
+	}()
+
+	switch {
+	case keywordErr != nil && semanticErr != nil:
+		return nil, fmt.Errorf("record retrieval failed: %v; %v", semanticErr, keywordErr)
+	case semanticErr != nil:
+		log.Printf("rag: record vector search unavailable, using keyword ranking: %v", semanticErr)
+	case keywordErr != nil:
+		log.Printf("rag: record keyword search failed, using vector ranking: %v", keywordErr)
+	}
+
+	passages = fuse(len(keyword)+len(semantic), semantic, keyword)
+	now := time.Now()
+	for i := range passages {
+		if passages[i].RecordedAt != nil {
+			passages[i].Score *= ix.recencyWeight(now.Sub(*passages[i].RecordedAt))
+		}
+	}
+	sort.SliceStable(passages, func(i, j int) bool { return passages[i].Score > passages[j].Score })
+	if len(passages) > k {
+		passages = passages[:k]
+	}
+	return passages, nil
+}
+
+// recencyWeight decays exponentially from 1 for new records towards MinWeight
+func (ix *RecordIndex) recencyWeight(age time.Duration) float64 {
+	if age <= 0 || ix.HalfLife <= 0 {
+		return 1
+	}
+	decay := math.Pow(0.5, float64(age)/float64(ix.HalfLife))
+	return ix.MinWeight + (1-ix.MinWeight)*decay
+}
+
+// recordedAt dates a record by its earliest extracted observation, then a
+// date printed in the text, then the date a concern started, falling back to
+// the indexing time
+func (ix *RecordIndex) recordedAt(recordID uuid.UUID, data map[string]interface{}, text string) time.Time {
+	var earliest struct{ EffectiveAt *time.Time }
+	if err := ix.DB.Model(&models.Observation{}).Select("MIN(effective_at) AS effective_at").
+		Where("health_data_id = ?", recordID).Scan(&earliest).Error; err == nil && earliest.EffectiveAt != nil {
+		return *earliest.EffectiveAt
+	}
+	if t, ok := labs.ParseDate(text); ok {
+		return t
+	}
+	if s, ok := data["start_date"].(string); ok {
+		if t, err := time.Parse("2006-01-02", s); err == nil {
+			return t
+		}
+	}
+	return time.Now()
+}
+
+// RecordText renders a stored health record as text for chunking and
+// prompts, returning its passage kind and a title line
+func RecordText(data map[string]interface{}) (kind, title, text string) {
+	if data["type"] == "health_concerns" {
+		var b strings.Builder
+		for _, f := range []struct{ key, label string }{
+			{"symptoms", "Symptoms"},
+			{"start_date", "Started"},
+			{"worsening_factors", "Worsening factors"},
+			{"previous_symptoms", "Previous symptoms"},
+		} {
+			if v, ok := data[f.key].(string); ok && strings.TrimSpace(v) != "" {
+				fmt.Fprintf(&b, "%s: %s\n", f.label, strings.TrimSpace(v))
+			}
+		}
+		return KindHealthConcern, "Health concerns", b.String()
+	}
+
+	if data["type"] == "triage" {
+		summary, _ := data["summary"].(string)
+		return KindHealthRecord, "Symptom triage", summary
+	}
+
+	title = "Health record"
+	if name, ok := data["file_name"].(string); ok && name != "" && name != "Unknown" {
+		title = "Report " + name
+	}
+	if extracted, ok := data["extracted_text"].(string); ok {
+		return KindHealthRecord, title, extracted
+	}
+
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, key := range keys {
+		if key == "file_name" {
+			continue
+		}
+		switch v := data[key].(type) {
+		case string, float64, bool:
+			fmt.Fprintf(&b, "%s: %v\n", strings.ReplaceAll(key, "_", " "), v)
+		case map[string]interface{}, []interface{}:
+			nested, _ := json.Marshal(v)
+			fmt.Fprintf(&b, "%s: %s\n", strings.ReplaceAll(key, "_", " "), nested)
+		}
+	}
+	return KindHealthRecord, title, b.String()
+}
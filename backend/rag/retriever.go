@@ -0,0 +1,257 @@
+// rag/retriever.go
+package rag
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"backend/cache"
+	"backend/models"
+	"backend/usage"
+
+	"gorm.io/gorm"
+)
+
+// Passage kinds
+const (
+	KindKnowledge     = "knowledge"
+	KindHealthRecord  = "health_record"
+	KindHealthConcern = "health_concern"
+)
+
+// Passage is a retrieved piece of reference text or of a user's record
+type Passage struct {
+	ID         string     `json:"id"` // Knowledge: content hash, stable across re-ingestion. Records: chunk ID
+	Kind       string     `json:"kind"`
+	Source     string     `json:"source,omitempty"`    // Document or record title
+	RecordID   string     `json:"record_id,omitempty"` // Health record the passage came from
+	Content    string     `json:"content"`
+	Score      float64    `json:"score"`
+	RecordedAt *time.Time `json:"recorded_at,omitempty"`
+}
+
+// Retriever finds the passages most relevant to a query
+type Retriever interface {
+	Retrieve(ctx context.Context, query string, k int) ([]Passage, error)
+}
+
+// rrfK damps the influence of top ranks in reciprocal rank fusion; 60 is the
+// value from the original paper and works well without tuning
+const rrfK = 60
+
+// PGVector ranks knowledge_chunks by combining pgvector cosine similarity
+// with Postgres full-text rank using reciprocal rank fusion. Exact terms
+// such as drug names are found by the keyword side even when the embedding
+// model does not know them.
+type PGVector struct {
+	DB         *gorm.DB
+	Embedder   Embedder
+	Candidates int // Rows fetched from each ranking before fusion
+}
+
+// NewPGVector creates a hybrid retriever over the knowledge base
+func NewPGVector(db *gorm.DB, embedder Embedder) *PGVector {
+	return &PGVector{DB: db, Embedder: embedder, Candidates: 30}
+}
+
+type passageRow struct {
+	ID         string
+	Kind       string
+	Source     string
+	RecordID   string
+	Content    string
+	Score      float64
+	RecordedAt *time.Time
+}
+
+func (r *PGVector) Retrieve(ctx context.Context, query string, k int) ([]Passage, error) {
+	if strings.TrimSpace(query) == "" || k <= 0 {
+		return []Passage{}, nil
+	}
+	db := r.DB.WithContext(ctx)
+
+	var keyword []passageRow
+	var keywordErr error
+	if terms := anyTerm(query); terms != "" {
+		// The tsvector expression matches idx_knowledge_chunks_fts
+		keywordErr = db.Raw(`
+			SELECT kc.hash AS id, 'knowledge' AS kind, kc.source, kc.content,
+				ts_rank(to_tsvector('english', kc.content), q) AS score
+			FROM knowledge_chunks kc, to_tsquery('english', ?) q
+			WHERE to_tsvector('english', kc.content) @@ q
+			ORDER BY score DESC
+			LIMIT ?`, terms, r.Candidates).Scan(&keyword).Error
+	}
+
+	var semantic []passageRow
+	semanticErr := r.vectorSearch(ctx, query, &semantic)
+
+	switch {
+	case keywordErr != nil && semanticErr != nil:
+		return nil, fmt.Errorf("retrieval failed: %v; %v", semanticErr, keywordErr)
+	case semanticErr != nil:
+		// Keyword results alone still answer most questions
+		log.Printf("rag: vector search unavailable, using keyword ranking: %v", semanticErr)
+	case keywordErr != nil:
+		log.Printf("rag: keyword search failed, using vector ranking: %v", keywordErr)
+	}
+
+	return fuse(k, semantic, keyword), nil
+}
+
+func (r *PGVector) vectorSearch(ctx context.Context, query string, out *[]passageRow) error {
+	vectors, err := r.Embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return err
+	}
+	vec := models.Vector(vectors[0])
+	return r.DB.WithContext(ctx).Raw(`
+		SELECT hash AS id, 'knowledge' AS kind, source, content, 1 - (embedding <=> ?::vector) AS score
+		FROM knowledge_chunks
+		WHERE model = ?
+		ORDER BY embedding <=> ?::vector
+		LIMIT ?`, vec, r.Embedder.Name(), vec, r.Candidates).Scan(out).Error
+}
+
+// fuse merges ranked lists by reciprocal rank fusion and returns the top k
+func fuse(k int, lists ...[]passageRow) []Passage {
+	byID := map[string]*Passage{}
+	var order []string
+	for _, list := range lists {
+		for rank, row := range list {
+			p, ok := byID[row.ID]
+			if !ok {
+				p = &Passage{
+					ID:         row.ID,
+					Kind:       row.Kind,
+					Source:     row.Source,
+					RecordID:   row.RecordID,
+					Content:    row.Content,
+					RecordedAt: row.RecordedAt,
+				}
+				byID[row.ID] = p
+				order = append(order, row.ID)
+			}
+			p.Score += 1 / float64(rrfK+rank+1)
+		}
+	}
+
+	out := make([]Passage, 0, len(order))
+	for _, id := range order {
+		out = append(out, *byID[id])
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+	if len(out) > k {
+		out = out[:k]
+	}
+	return out
+}
+
+// anyTerm builds a tsquery matching any word of a natural language
+// question. Questions rarely contain every word of the passage that answers
+// them, so ts_rank orders by how many words match instead of requiring all.
+func anyTerm(query string) string {
+	words := Words(query)
+	for i, w := range words {
+		words[i] = "'" + w + "'"
+	}
+	return strings.Join(words, " | ")
+}
+
+// ContentHash identifies a passage by its text, so passages keep their ID
+// across re-ingestion and between retrievers
+func ContentHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// RetrieverFromEnv returns the knowledge retriever selected by RETRIEVER:
+// "pgvector" (default) or "python" for the legacy service at RAG_URL.
+// Searches that miss the cache are metered in usage.FromEnv.
+func RetrieverFromEnv(db *gorm.DB) (Retriever, error) {
+	ttl := cache.TTL("retrieval", time.Hour)
+	meter := usage.FromEnv(db)
+	switch strings.ToLower(os.Getenv("RETRIEVER")) {
+	case "", "pgvector":
+		embedder, err := EmbedderFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		name := "pgvector/" + embedder.Name()
+		r := metered(NewPGVector(db, MeterEmbedder(embedder, meter)), name, meter)
+		return Cached(r, name, cache.FromEnv(db), ttl), nil
+	case "python":
+		url := envOr("RAG_URL", "http://localhost:5000")
+		name := "python/" + url
+		return Cached(metered(NewPythonRetriever(url), name, meter), name, cache.FromEnv(db), ttl), nil
+	}
+	return nil, fmt.Errorf("unknown retriever %q", os.Getenv("RETRIEVER"))
+}
+
+// CachedRetriever serves repeated knowledge queries from a cache. Keys
+// include the knowledge base version, which ingestion bumps.
+type CachedRetriever struct {
+	Retriever
+	Name  string // Tells retrievers sharing a cache apart
+	Cache *cache.Cache
+	TTL   time.Duration
+}
+
+// Cached wraps r unless c is nil or ttl is 0
+func Cached(r Retriever, name string, c *cache.Cache, ttl time.Duration) Retriever {
+	if c == nil || ttl <= 0 {
+		return r
+	}
+	return &CachedRetriever{Retriever: r, Name: name, Cache: c, TTL: ttl}
+}
+
+func (r *CachedRetriever) Retrieve(ctx context.Context, query string, k int) ([]Passage, error) {
+	version, err := r.Cache.Version(ctx, cache.Knowledge)
+	if err != nil {
+		return r.Retriever.Retrieve(ctx, query, k)
+	}
+	var passages []Passage
+	key := cache.Key("retrieval", r.Name, version, k, cache.Normalize(query))
+	_, err = r.Cache.LoadJSON(ctx, key, &passages, func(ctx context.Context) (interface{}, time.Duration, error) {
+		passages, err := r.Retriever.Retrieve(ctx, query, k)
+		return passages, r.TTL, err
+	})
+	return passages, err
+}
+
+// meteredRetriever records each search as usage, with the query's
+// estimated tokens
+type meteredRetriever struct {
+	Retriever
+	name  string
+	meter *usage.Meter
+}
+
+// metered records the searches of r in m under name, unless m is nil
+func metered(r Retriever, name string, m *usage.Meter) Retriever {
+	if m == nil {
+		return r
+	}
+	return meteredRetriever{Retriever: r, name: name, meter: m}
+}
+
+func (r meteredRetriever) Retrieve(ctx context.Context, query string, k int) ([]Passage, error) {
+	started := time.Now()
+	passages, err := r.Retriever.Retrieve(ctx, query, k)
+	r.meter.Record(ctx, usage.Call{
+		Feature:      usage.Retrieval,
+		Model:        r.name,
+		PromptTokens: usage.EstimateTokens(query),
+		Estimated:    true,
+		Latency:      time.Since(started),
+		Failed:       err != nil,
+	})
+	return passages, err
+}
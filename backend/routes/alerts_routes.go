@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"backend/controllers"
+	"backend/middleware"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+func AlertsRoutes(router *mux.Router, db *gorm.DB) {
+	alertsController := controllers.NewAlertsController(db)
+
+	protected := router.PathPrefix("/api").Subrouter()
+	protected.Use(middleware.AuthMiddleware)
+
+	protected.HandleFunc("/alerts/rules", alertsController.GetRules).Methods("GET")
+	protected.HandleFunc("/alerts/rules", alertsController.CreateRule).Methods("POST")
+	protected.HandleFunc("/alerts/rules/{id}", alertsController.UpdateRule).Methods("PUT")
+	protected.HandleFunc("/alerts/rules/{id}", alertsController.DeleteRule).Methods("DELETE")
+
+	protected.HandleFunc("/notifications", alertsController.GetNotifications).Methods("GET")
+	protected.HandleFunc("/notifications/read-all", alertsController.MarkAllNotificationsRead).Methods("POST")
+	protected.HandleFunc("/notifications/{id}/read", alertsController.MarkNotificationRead).Methods("POST")
+
+	protected.HandleFunc("/care-team", alertsController.GetCareTeam).Methods("GET")
+	protected.HandleFunc("/care-team", alertsController.AddClinician).Methods("POST")
+	protected.HandleFunc("/care-team/{id}", alertsController.RemoveClinician).Methods("DELETE")
+}
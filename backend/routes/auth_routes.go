@@ -3,6 +3,7 @@ package routes
 import (
 	"backend/controllers"
 	"backend/middleware"
+	"backend/models"
 
 	"github.com/gorilla/mux"
 	"gorm.io/gorm"
@@ -23,4 +24,12 @@ func AuthRoutes(router *mux.Router, db *gorm.DB) {
 	protected.HandleFunc("/user/profile", authController.GetProfile).Methods("GET")
 	protected.HandleFunc("/user/profile", authController.UpdateProfile).Methods("PUT")
 	protected.HandleFunc("/user/update", authController.UpdatePersonalInfo).Methods("POST")
+	protected.HandleFunc("/user/preferences", authController.UpdatePreferences).Methods("PUT")
+
+	// Admin Routes
+	admin := router.PathPrefix("/api/admin").Subrouter()
+	admin.Use(middleware.AuthMiddleware)
+	admin.Use(middleware.RequireRole(db, models.RoleAdmin))
+
+	admin.HandleFunc("/users/{id}/role", authController.UpdateUserRole).Methods("PUT")
 }
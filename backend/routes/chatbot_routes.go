@@ -15,4 +15,15 @@ func ChatbotRoutes(router *mux.Router, db *gorm.DB) {
 	protected.Use(middleware.AuthMiddleware)
 
 	protected.HandleFunc("/chatbot", chatbotController.AskChatbot).Methods("POST")
+	protected.HandleFunc("/chatbot/stream", chatbotController.StreamChatbot).Methods("POST")
+
+	protected.HandleFunc("/knowledge/{id}", chatbotController.GetKnowledgePassage).Methods("GET")
+
+	protected.HandleFunc("/chat/conversations", chatbotController.GetConversations).Methods("GET")
+	protected.HandleFunc("/chat/conversations", chatbotController.CreateConversation).Methods("POST")
+	protected.HandleFunc("/chat/conversations/{id}", chatbotController.GetConversation).Methods("GET")
+	protected.HandleFunc("/chat/conversations/{id}", chatbotController.RenameConversation).Methods("PUT")
+	protected.HandleFunc("/chat/conversations/{id}", chatbotController.DeleteConversation).Methods("DELETE")
+	protected.HandleFunc("/chat/conversations/{id}/export", chatbotController.ExportConversation).Methods("GET")
+	protected.HandleFunc("/chat/conversations/{id}/messages", chatbotController.SendMessage).Methods("POST")
 }
@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"backend/controllers"
+	"backend/middleware"
+	"backend/models"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+func FeedbackRoutes(router *mux.Router, db *gorm.DB) {
+	feedbackController := controllers.NewFeedbackController(db)
+
+	protected := router.PathPrefix("/api").Subrouter()
+	protected.Use(middleware.AuthMiddleware)
+
+	protected.HandleFunc("/chat/conversations/{id}/messages/{messageId}/feedback", feedbackController.RateMessage).Methods("PUT")
+	protected.HandleFunc("/chat/conversations/{id}/messages/{messageId}/feedback", feedbackController.DeleteFeedback).Methods("DELETE")
+
+	admin := router.PathPrefix("/api/admin").Subrouter()
+	admin.Use(middleware.AuthMiddleware)
+	admin.Use(middleware.RequireRole(db, models.RoleAdmin))
+
+	admin.HandleFunc("/chat/feedback", feedbackController.ExportFeedback).Methods("GET")
+}
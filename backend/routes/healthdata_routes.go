@@ -17,6 +17,7 @@ func HealthDataRoutes(router *mux.Router, db *gorm.DB) {
 
 	protected.HandleFunc("/healthdata", healthDataController.AddHealthData).Methods("POST")
 	protected.HandleFunc("/healthdata", healthDataController.GetUserHealthData).Methods("GET")
+	protected.HandleFunc("/healthdata/{id}", healthDataController.GetHealthDataByID).Methods("GET")
 	protected.HandleFunc("/healthdata/{id}", healthDataController.DeleteHealthData).Methods("DELETE")
 	protected.HandleFunc("/healthdata/store", healthDataController.StoreHealthData).Methods("POST")
 	protected.HandleFunc("/health-concerns", healthDataController.StoreHealthConcerns).Methods("POST")
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"backend/controllers"
+	"backend/middleware"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+func ObservationRoutes(router *mux.Router, db *gorm.DB) {
+	observationController := controllers.NewObservationController(db)
+
+	protected := router.PathPrefix("/api").Subrouter()
+	protected.Use(middleware.AuthMiddleware)
+
+	protected.HandleFunc("/observations", observationController.GetObservations).Methods("GET")
+	protected.HandleFunc("/observations/dictionary", observationController.GetDictionary).Methods("GET")
+	protected.HandleFunc("/healthdata/{id}/observations", observationController.GetRecordObservations).Methods("GET")
+	protected.HandleFunc("/healthdata/{id}/observations/extract", observationController.ReparseRecord).Methods("POST")
+}
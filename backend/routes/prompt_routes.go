@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"backend/controllers"
+	"backend/middleware"
+	"backend/models"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+func PromptRoutes(router *mux.Router, db *gorm.DB) {
+	promptController := controllers.NewPromptController(db)
+
+	admin := router.PathPrefix("/api/admin").Subrouter()
+	admin.Use(middleware.AuthMiddleware)
+	admin.Use(middleware.RequireRole(db, models.RoleAdmin))
+
+	admin.HandleFunc("/prompts/{name}", promptController.GetPrompt).Methods("GET")
+	admin.HandleFunc("/prompts/{name}/versions", promptController.CreatePromptVersion).Methods("POST")
+	admin.HandleFunc("/prompts/{name}/rollout", promptController.SetPromptRollout).Methods("PUT")
+}
@@ -11,5 +11,13 @@ func SetupRoutes(router *mux.Router, db *gorm.DB) {
 	HealthDataRoutes(router, db)
 	ChatbotRoutes(router, db)
 	ImageRoutes(router, db)
+	SearchRoutes(router, db)
+	ObservationRoutes(router, db)
+	TrendsRoutes(router, db)
+	AlertsRoutes(router, db)
+	FeedbackRoutes(router, db)
+	PromptRoutes(router, db)
+	TriageRoutes(router, db)
+	UsageRoutes(router, db)
 
 }
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"backend/controllers"
+	"backend/middleware"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+func SearchRoutes(router *mux.Router, db *gorm.DB) {
+	searchController := controllers.NewSearchController(db)
+
+	protected := router.PathPrefix("/api").Subrouter()
+	protected.Use(middleware.AuthMiddleware)
+
+	protected.HandleFunc("/search", searchController.Search).Methods("GET")
+}
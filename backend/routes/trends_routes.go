@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"backend/controllers"
+	"backend/middleware"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+func TrendsRoutes(router *mux.Router, db *gorm.DB) {
+	trendsController := controllers.NewTrendsController(db)
+
+	protected := router.PathPrefix("/api").Subrouter()
+	protected.Use(middleware.AuthMiddleware)
+
+	protected.HandleFunc("/trends", trendsController.ListTrends).Methods("GET")
+	protected.HandleFunc("/trends/{analyte}", trendsController.GetTrend).Methods("GET")
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"backend/controllers"
+	"backend/middleware"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+func TriageRoutes(router *mux.Router, db *gorm.DB) {
+	triageController := controllers.NewTriageController(db)
+
+	protected := router.PathPrefix("/api").Subrouter()
+	protected.Use(middleware.AuthMiddleware)
+
+	protected.HandleFunc("/triage", triageController.StartTriage).Methods("POST")
+	protected.HandleFunc("/triage", triageController.ListTriage).Methods("GET")
+	protected.HandleFunc("/triage/{id}", triageController.GetTriage).Methods("GET")
+	protected.HandleFunc("/triage/{id}/answers", triageController.AnswerTriage).Methods("POST")
+}
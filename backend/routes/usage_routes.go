@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"backend/controllers"
+	"backend/middleware"
+	"backend/models"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+func UsageRoutes(router *mux.Router, db *gorm.DB) {
+	usageController := controllers.NewUsageController(db)
+
+	protected := router.PathPrefix("/api").Subrouter()
+	protected.Use(middleware.AuthMiddleware)
+
+	protected.HandleFunc("/usage", usageController.GetUsage).Methods("GET")
+
+	admin := router.PathPrefix("/api/admin").Subrouter()
+	admin.Use(middleware.AuthMiddleware)
+	admin.Use(middleware.RequireRole(db, models.RoleAdmin))
+
+	admin.HandleFunc("/usage", usageController.UsageReport).Methods("GET")
+	admin.HandleFunc("/usage/users/{id}/budget", usageController.GetUserBudget).Methods("GET")
+	admin.HandleFunc("/usage/users/{id}/budget", usageController.SetUserBudget).Methods("PUT")
+}
@@ -0,0 +1,122 @@
+// safety/guard.go
+package safety
+
+import (
+	"strings"
+)
+
+// Match is a rule that applied to a text
+type Match struct {
+	Rule    *Rule
+	Excerpt string // The text that matched
+}
+
+// Verdict is the outcome of checking a question or an answer
+type Verdict struct {
+	Matches      []Match
+	Action       string   // Strongest action of the matches, "" when none
+	Response     string   // Replaces the answer for emergency and refuse
+	Rule         *Rule    // The strongest match, whose response is given
+	Instructions []string // Added to the system prompt
+	Disclaimers  []string // Appended to the answer
+}
+
+// Blocks reports whether the verdict replaces the answer, so no retrieval or
+// generation is needed
+func (v Verdict) Blocks() bool {
+	return v.Action == ActionEmergency || v.Action == ActionRefuse
+}
+
+// Guard checks questions before generation and answers after it
+type Guard struct {
+	Rules *Rules
+}
+
+// NewGuard creates a guard enforcing rules
+func NewGuard(rules *Rules) *Guard {
+	return &Guard{Rules: rules}
+}
+
+// GuardFromEnv creates a guard with the rules selected by RulesFromEnv
+func GuardFromEnv() (*Guard, error) {
+	rules, err := RulesFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return NewGuard(rules), nil
+}
+
+// CheckQuestion applies the question rules
+func (g *Guard) CheckQuestion(question string) Verdict {
+	return g.check(StageQuestion, question)
+}
+
+// CheckAnswer applies the answer rules
+func (g *Guard) CheckAnswer(answer string) Verdict {
+	return g.check(StageAnswer, answer)
+}
+
+func (g *Guard) check(stage, text string) Verdict {
+	var v Verdict
+	text = normalize(text)
+	var strongest *Rule
+	for _, r := range g.Rules.Rules {
+		if r.Stage != stage {
+			continue
+		}
+		excerpt := r.match(text)
+		if excerpt == "" {
+			continue
+		}
+		v.Matches = append(v.Matches, Match{Rule: r, Excerpt: excerpt})
+		if strongest == nil || actionRank[r.Action] > actionRank[strongest.Action] {
+			strongest = r // The first rule of the strongest action wins
+		}
+		if r.Instruction != "" {
+			v.Instructions = appendUnique(v.Instructions, r.Instruction)
+		}
+		if r.Disclaimer != "" {
+			v.Disclaimers = appendUnique(v.Disclaimers, r.Disclaimer)
+		}
+	}
+	if strongest != nil {
+		v.Action = strongest.Action
+		v.Response = strongest.Response
+		v.Rule = strongest
+	}
+	return v
+}
+
+// Response returns the reply of a blocking verdict in language
+func (g *Guard) Response(v Verdict, language string) string {
+	if v.Rule == nil {
+		return v.Response
+	}
+	return g.Rules.ResponseIn(v.Rule, language)
+}
+
+// WithDisclaimers appends disclaimers not already in text
+func WithDisclaimers(text string, disclaimers []string) string {
+	for _, d := range disclaimers {
+		if !strings.Contains(text, d) {
+			text = strings.TrimRight(text, "\n") + "\n\n_" + d + "_"
+		}
+	}
+	return text
+}
+
+// normalize collapses whitespace and typographic apostrophes so patterns
+// can be written plainly
+func normalize(text string) string {
+	text = strings.NewReplacer("’", "'", "‘", "'").Replace(text)
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, x := range list {
+		if x == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
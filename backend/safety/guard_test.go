@@ -0,0 +1,105 @@
+package safety
+
+import (
+	"strings"
+	"testing"
+)
+
+func defaultGuard(t *testing.T) *Guard {
+	t.Helper()
+	rules, err := DefaultRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewGuard(rules)
+}
+
+func TestCheckQuestion(t *testing.T) {
+	g := defaultGuard(t)
+	tests := []struct {
+		question string
+		action   string
+		rule     string
+	}{
+		{"I have crushing pain in my chest and my left arm is numb", ActionEmergency, "cardiac_crushing_chest_pain"},
+		{"My face   is drooping since this morning", ActionEmergency, "stroke_signs"},
+		{"I can’t breathe properly", ActionEmergency, "breathing_difficulty"},
+		{"I want to kill myself", ActionEmergency, "self_harm"},
+		{"Can I take my friend's prescription pills?", ActionRefuse, "prescription_misuse"},
+		{"How many mg of ibuprofen can I take?", ActionDisclaimer, "dosing_question"},
+		{"Do I have diabetes?", ActionDisclaimer, "diagnosis_question"},
+		{"What does my HbA1c of 5.4% mean?", "", ""},
+	}
+	for _, tt := range tests {
+		v := g.CheckQuestion(tt.question)
+		if v.Action != tt.action {
+			t.Errorf("%q: action %q, want %q", tt.question, v.Action, tt.action)
+			continue
+		}
+		if tt.rule == "" {
+			continue
+		}
+		if v.Rule == nil || v.Rule.ID != tt.rule {
+			t.Errorf("%q: rule %v, want %s", tt.question, v.Rule, tt.rule)
+		}
+		if v.Blocks() != (tt.action != ActionDisclaimer) {
+			t.Errorf("%q: Blocks() = %v", tt.question, v.Blocks())
+		}
+	}
+}
+
+func TestCheckAnswer(t *testing.T) {
+	g := defaultGuard(t)
+	v := g.CheckAnswer("Based on these results you probably have diabetes. Take 500 mg twice a day.")
+	if v.Action != ActionDisclaimer || v.Blocks() {
+		t.Fatalf("action %q, want a disclaimer that does not block", v.Action)
+	}
+	if len(v.Disclaimers) == 0 {
+		t.Fatal("no disclaimers")
+	}
+	answer := WithDisclaimers("Answer.", v.Disclaimers)
+	if again := WithDisclaimers(answer, v.Disclaimers); again != answer {
+		t.Errorf("disclaimers added twice:\n%s", again)
+	}
+}
+
+func TestResponse(t *testing.T) {
+	g := defaultGuard(t)
+	v := g.CheckQuestion("I want to kill myself")
+	english := g.Response(v, "en")
+	if english == "" || english != v.Response {
+		t.Fatalf("English response %q, want the rule's response", english)
+	}
+	tests := []struct {
+		language string
+		prefix   string
+	}{
+		{"es", "**Siento mucho"},
+		{"es-MX", "**Siento mucho"}, // Base language
+		{"ja", english},             // No reviewed reply
+	}
+	for _, tt := range tests {
+		got := g.Response(v, tt.language)
+		if !strings.HasPrefix(got, tt.prefix) {
+			t.Errorf("%s: response %q, want it to start with %q", tt.language, got, tt.prefix)
+		}
+		if tt.prefix != english && !strings.HasSuffix(got, english) {
+			t.Errorf("%s: response does not end with the English text", tt.language)
+		}
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name, json string
+	}{
+		{"no id", `{"rules": [{"stage": "question", "action": "refuse", "patterns": ["x"]}]}`},
+		{"duplicate", `{"rules": [{"id": "a", "stage": "question", "action": "refuse", "patterns": ["x"]}, {"id": "a", "stage": "question", "action": "refuse", "patterns": ["y"]}]}`},
+		{"bad pattern", `{"rules": [{"id": "a", "stage": "question", "action": "refuse", "patterns": ["("]}]}`},
+	}
+	for _, tt := range tests {
+		if _, err := ParseRules([]byte(tt.json)); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
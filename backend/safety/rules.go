@@ -0,0 +1,200 @@
+// safety/rules.go
+package safety
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"backend/lang"
+)
+
+// Stages a rule is checked at
+const (
+	StageQuestion = "question" // Before retrieval and generation
+	StageAnswer   = "answer"   // On the generated text
+)
+
+// Actions a rule can take, strongest first
+const (
+	ActionEmergency  = "emergency"  // Reply with emergency-care advice instead of an answer
+	ActionRefuse     = "refuse"     // Reply with a refusal instead of an answer
+	ActionDisclaimer = "disclaimer" // Answer, with extra instructions and a disclaimer
+)
+
+var actionRank = map[string]int{ActionEmergency: 3, ActionRefuse: 2, ActionDisclaimer: 1}
+
+// Rule matches text when any of Patterns and all of Requires match. Patterns
+// are regular expressions matched case-insensitively against the text with
+// whitespace collapsed.
+type Rule struct {
+	ID          string            `json:"id"`
+	Category    string            `json:"category"` // e.g. emergency, self_harm, dosing, diagnosis
+	Stage       string            `json:"stage"`
+	Action      string            `json:"action"`
+	Patterns    []string          `json:"patterns"`
+	Requires    []string          `json:"requires,omitempty"`
+	Response    string            `json:"response,omitempty"`    // Reply for emergency and refuse
+	Responses   map[string]string `json:"responses,omitempty"`   // Reviewed translations of Response, by language tag or base language
+	Instruction string            `json:"instruction,omitempty"` // Added to the system prompt
+	Disclaimer  string            `json:"disclaimer,omitempty"`  // Appended to the answer
+
+	patterns []*regexp.Regexp
+	requires []*regexp.Regexp
+}
+
+// Rules is a validated, compiled rule file
+type Rules struct {
+	Rules []*Rule `json:"rules"`
+	// Responses are reviewed short replies per category and language, given
+	// ahead of the English response of rules not translated themselves
+	Responses map[string]map[string]string `json:"responses,omitempty"`
+}
+
+// ResponseIn returns the reply of a blocking rule in language. Replies are
+// never machine translated: a rule's own reviewed translation is used, or
+// else the reviewed reply for its category followed by the English text.
+func (r *Rules) ResponseIn(rule *Rule, language string) string {
+	if lang.IsEnglish(language) {
+		return rule.Response
+	}
+	if text := inLanguage(rule.Responses, language); text != "" {
+		return text
+	}
+	if text := inLanguage(r.Responses[rule.Category], language); text != "" {
+		return text + "\n\n---\n\n" + rule.Response
+	}
+	return rule.Response
+}
+
+// inLanguage looks up language, then its base language, in texts
+func inLanguage(texts map[string]string, language string) string {
+	if text, ok := texts[language]; ok {
+		return text
+	}
+	return texts[lang.Base(language)]
+}
+
+//go:embed rules.json
+var defaultRules []byte
+
+// DefaultRules returns the rules shipped with the backend
+func DefaultRules() (*Rules, error) {
+	return ParseRules(defaultRules)
+}
+
+// LoadRules reads a rule file
+func LoadRules(path string) (*Rules, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := ParseRules(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// RulesFromEnv loads the rule file named by SAFETY_RULES, or the default
+// rules when it is unset
+func RulesFromEnv() (*Rules, error) {
+	if path := os.Getenv("SAFETY_RULES"); path != "" {
+		return LoadRules(path)
+	}
+	return DefaultRules()
+}
+
+// ParseRules decodes and validates a JSON rule file
+func ParseRules(data []byte) (*Rules, error) {
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, r := range rules.Rules {
+		if r.ID == "" {
+			return nil, fmt.Errorf("rule without id")
+		}
+		if seen[r.ID] {
+			return nil, fmt.Errorf("duplicate rule %q", r.ID)
+		}
+		seen[r.ID] = true
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("rule %q: %w", r.ID, err)
+		}
+	}
+	return &rules, nil
+}
+
+func (r *Rule) compile() error {
+	switch r.Stage {
+	case StageQuestion:
+	case StageAnswer:
+		// Streamed answers have already been sent, so they can only be
+		// followed by a disclaimer
+		if r.Action != ActionDisclaimer {
+			return fmt.Errorf("answer rules can only add a disclaimer")
+		}
+	default:
+		return fmt.Errorf("unknown stage %q", r.Stage)
+	}
+	switch r.Action {
+	case ActionEmergency, ActionRefuse:
+		if strings.TrimSpace(r.Response) == "" {
+			return fmt.Errorf("%s rules need a response", r.Action)
+		}
+	case ActionDisclaimer:
+		if r.Disclaimer == "" && r.Instruction == "" {
+			return fmt.Errorf("disclaimer rules need a disclaimer or instruction")
+		}
+	default:
+		return fmt.Errorf("unknown action %q", r.Action)
+	}
+	if len(r.Patterns) == 0 {
+		return fmt.Errorf("no patterns")
+	}
+
+	var err error
+	if r.patterns, err = compileAll(r.Patterns); err != nil {
+		return err
+	}
+	r.requires, err = compileAll(r.Requires)
+	return err
+}
+
+func compileAll(patterns []string) ([]*regexp.Regexp, error) {
+	out := make([]*regexp.Regexp, len(patterns))
+	for i, p := range patterns {
+		re, err := regexp.Compile("(?i)" + p)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = re
+	}
+	return out, nil
+}
+
+// match returns the text matched by the rule, or "" when it does not apply
+func (r *Rule) match(text string) string {
+	var excerpt string
+	for _, re := range r.patterns {
+		if m := re.FindString(text); m != "" {
+			excerpt = m
+			break
+		}
+	}
+	if excerpt == "" {
+		return ""
+	}
+	for _, re := range r.requires {
+		if !re.MatchString(text) {
+			return ""
+		}
+	}
+	return excerpt
+}
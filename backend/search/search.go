@@ -0,0 +1,407 @@
+// search/search.go
+package search
+
+import (
+	"encoding/json"
+	"html"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Snippet markers used while building highlights. They are swapped for
+// <mark> tags only after the snippet text has been HTML-escaped, so OCR text
+// can never inject markup into the UI.
+const (
+	markStart = "\x02"
+	markStop  = "\x03"
+)
+
+// Hit is a single ranked search result
+type Hit struct {
+	Kind      string     `json:"kind"` // health_record, health_concern, image, conversation
+	ID        string     `json:"id"`
+	Title     string     `json:"title"`
+	Snippet   string     `json:"snippet"`
+	Rank      float64    `json:"rank"`
+	Link      string     `json:"link"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+}
+
+// source searches one kind of user-owned record
+type source func(s *Searcher, userID, query string, limit int) ([]Hit, error)
+
+// Searcher runs a query across every searchable source of a user
+type Searcher struct {
+	DB      *gorm.DB
+	sources []source
+}
+
+// NewSearcher creates a searcher over health data, images and chatbot conversations
+func NewSearcher(db *gorm.DB) *Searcher {
+	return &Searcher{
+		DB:      db,
+		sources: []source{searchHealthData, searchImages, searchConversations},
+	}
+}
+
+// Search returns the best hits for query across all sources, highest rank first
+func (s *Searcher) Search(userID, query string, limit int) ([]Hit, error) {
+	hits := []Hit{}
+	for _, src := range s.sources {
+		found, err := src(s, userID, query, limit)
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, found...)
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Rank > hits[j].Rank })
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	for i := range hits {
+		hits[i].Snippet = renderSnippet(hits[i].Snippet)
+	}
+	return hits, nil
+}
+
+// usePostgres reports whether full-text search is available
+func (s *Searcher) usePostgres() bool {
+	return s.DB.Dialector.Name() == "postgres"
+}
+
+// headlineOptions configures ts_headline to emit our internal markers
+const headlineOptions = "StartSel=\x02, StopSel=\x03, MaxFragments=2, MaxWords=25, MinWords=8, FragmentDelimiter=\" … \""
+
+type healthDataRow struct {
+	ID       string
+	Type     string
+	FileName string
+	Rank     float64
+	Snippet  string
+}
+
+func searchHealthData(s *Searcher, userID, query string, limit int) ([]Hit, error) {
+	var rows []healthDataRow
+
+	if s.usePostgres() {
+		// The WHERE expression matches idx_health_data_fts so the GIN index is used
+		err := s.DB.Raw(`
+			SELECT hd.id,
+				COALESCE(hd.data->>'type', '') AS type,
+				COALESCE(hd.data->>'file_name', '') AS file_name,
+				ts_rank(jsonb_to_tsvector('english', hd.data, '["string"]'), q) AS rank,
+				ts_headline('english',
+					(SELECT string_agg(value, ' ') FROM jsonb_each_text(hd.data)),
+					q, ?) AS snippet
+			FROM health_data hd, websearch_to_tsquery('english', ?) q
+			WHERE hd.user_id = ?
+				AND jsonb_to_tsvector('english', hd.data, '["string"]') @@ q
+			ORDER BY rank DESC
+			LIMIT ?`, headlineOptions, query, userID, limit).Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var records []struct {
+			ID   string
+			Data string
+		}
+		db := s.DB.Table("health_data").Select("id, data").Where("user_id = ?", userID)
+		for _, term := range terms(query) {
+			db = db.Where("LOWER(CAST(data AS TEXT)) LIKE ?", "%"+term+"%")
+		}
+		if err := db.Scan(&records).Error; err != nil {
+			return nil, err
+		}
+
+		for _, rec := range records {
+			var data map[string]interface{}
+			if err := json.Unmarshal([]byte(rec.Data), &data); err != nil {
+				continue
+			}
+			text := flattenStrings(data)
+			typ, _ := data["type"].(string)
+			fileName, _ := data["file_name"].(string)
+			rows = append(rows, healthDataRow{
+				ID:       rec.ID,
+				Type:     typ,
+				FileName: fileName,
+				Rank:     likeRank(text, query),
+				Snippet:  likeSnippet(text, query),
+			})
+		}
+	}
+
+	hits := make([]Hit, 0, len(rows))
+	for _, row := range rows {
+		hit := Hit{
+			Kind:    "health_record",
+			ID:      row.ID,
+			Title:   row.FileName,
+			Snippet: row.Snippet,
+			Rank:    row.Rank,
+			Link:    "/api/healthdata/" + row.ID,
+		}
+		if row.Type == "health_concerns" {
+			hit.Kind = "health_concern"
+			hit.Title = "Health concerns"
+		}
+		if hit.Title == "" {
+			hit.Title = "Health record"
+		}
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
+
+type imageRow struct {
+	ID        string
+	ImageName string
+	Rank      float64
+	Snippet   string
+	CreatedAt time.Time
+}
+
+func searchImages(s *Searcher, userID, query string, limit int) ([]Hit, error) {
+	var rows []imageRow
+
+	if s.usePostgres() {
+		// File names rarely contain prose, so split on separators and skip
+		// stemming. The vector expression matches idx_user_images_fts.
+		const doc = `regexp_replace(COALESCE(ui.image_name, ''), '[._-]+', ' ', 'g')`
+		err := s.DB.Raw(`
+			SELECT ui.id, ui.image_name, ui.created_at,
+				ts_rank(to_tsvector('simple', `+doc+`), q) AS rank,
+				ts_headline('simple', `+doc+`, q, ?) AS snippet
+			FROM user_images ui, websearch_to_tsquery('simple', ?) q
+			WHERE ui.user_id = ? AND to_tsvector('simple', `+doc+`) @@ q
+			ORDER BY rank DESC
+			LIMIT ?`, headlineOptions, query, userID, limit).Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		db := s.DB.Table("user_images").Select("id, image_name, created_at").Where("user_id = ?", userID)
+		for _, term := range terms(query) {
+			db = db.Where("LOWER(image_name) LIKE ?", "%"+term+"%")
+		}
+		if err := db.Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for i := range rows {
+			rows[i].Rank = likeRank(rows[i].ImageName, query)
+			rows[i].Snippet = likeSnippet(rows[i].ImageName, query)
+		}
+	}
+
+	hits := make([]Hit, 0, len(rows))
+	for _, row := range rows {
+		createdAt := row.CreatedAt
+		hits = append(hits, Hit{
+			Kind:      "image",
+			ID:        row.ID,
+			Title:     row.ImageName,
+			Snippet:   row.Snippet,
+			Rank:      row.Rank,
+			Link:      "/api/images/" + row.ID,
+			CreatedAt: &createdAt,
+		})
+	}
+	return hits, nil
+}
+
+type messageRow struct {
+	ConversationID string
+	Title          string
+	Content        string
+	Rank           float64
+	Snippet        string
+	CreatedAt      time.Time
+}
+
+// searchConversations matches chatbot messages and returns the best message
+// of each conversation
+func searchConversations(s *Searcher, userID, query string, limit int) ([]Hit, error) {
+	var rows []messageRow
+
+	if s.usePostgres() {
+		// The vector expression matches idx_messages_fts
+		err := s.DB.Raw(`
+			SELECT m.conversation_id, c.title, m.created_at,
+				ts_rank(to_tsvector('english', m.content), q) AS rank,
+				ts_headline('english', m.content, q, ?) AS snippet
+			FROM messages m
+			JOIN conversations c ON c.id = m.conversation_id,
+				websearch_to_tsquery('english', ?) q
+			WHERE m.user_id = ? AND to_tsvector('english', m.content) @@ q
+			ORDER BY rank DESC
+			LIMIT ?`, headlineOptions, query, userID, limit*3).Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		db := s.DB.Table("messages m").
+			Select("m.conversation_id, c.title, m.content, m.created_at").
+			Joins("JOIN conversations c ON c.id = m.conversation_id").
+			Where("m.user_id = ?", userID)
+		for _, term := range terms(query) {
+			db = db.Where("LOWER(m.content) LIKE ?", "%"+term+"%")
+		}
+		if err := db.Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for i := range rows {
+			rows[i].Rank = likeRank(rows[i].Content, query)
+			rows[i].Snippet = likeSnippet(rows[i].Content, query)
+		}
+		sort.SliceStable(rows, func(i, j int) bool { return rows[i].Rank > rows[j].Rank })
+	}
+
+	hits := []Hit{}
+	seen := map[string]bool{}
+	for _, row := range rows {
+		if seen[row.ConversationID] || len(hits) == limit {
+			continue
+		}
+		seen[row.ConversationID] = true
+		createdAt := row.CreatedAt
+		title := row.Title
+		if title == "" {
+			title = "Conversation"
+		}
+		hits = append(hits, Hit{
+			Kind:      "conversation",
+			ID:        row.ConversationID,
+			Title:     title,
+			Snippet:   row.Snippet,
+			Rank:      row.Rank,
+			Link:      "/api/chat/conversations/" + row.ConversationID,
+			CreatedAt: &createdAt,
+		})
+	}
+	return hits, nil
+}
+
+// terms splits a query into lowercase words for the LIKE fallback
+func terms(query string) []string {
+	var out []string
+	for _, f := range strings.Fields(strings.ToLower(query)) {
+		f = strings.Trim(f, `"'`)
+		if f != "" && f != "or" && f != "and" && !strings.HasPrefix(f, "-") {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// flattenStrings joins every string value of a decoded JSON document
+func flattenStrings(v interface{}) string {
+	var parts []string
+	var walk func(interface{})
+	walk = func(v interface{}) {
+		switch t := v.(type) {
+		case string:
+			parts = append(parts, t)
+		case map[string]interface{}:
+			keys := make([]string, 0, len(t))
+			for k := range t {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				walk(t[k])
+			}
+		case []interface{}:
+			for _, item := range t {
+				walk(item)
+			}
+		}
+	}
+	walk(v)
+	return strings.Join(parts, " ")
+}
+
+// likeRank approximates relevance by term frequency normalized by length
+func likeRank(text, query string) float64 {
+	lower := strings.ToLower(text)
+	count := 0
+	for _, term := range terms(query) {
+		count += strings.Count(lower, term)
+	}
+	if count == 0 {
+		return 0
+	}
+	return float64(count) / float64(1+len(strings.Fields(lower))/50)
+}
+
+// likeSnippet cuts a window around the first matching term and marks all matches
+func likeSnippet(text, query string) string {
+	const radius = 80
+
+	ts := terms(query)
+	lower := strings.ToLower(text)
+	if len(lower) != len(text) {
+		// Case folding changed byte offsets; fall back to matching as-is
+		lower = text
+	}
+	first := -1
+	for _, term := range ts {
+		if i := strings.Index(lower, term); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+	if first < 0 {
+		first = 0
+	}
+
+	start, end := first-radius, first+radius
+	prefix, suffix := "… ", " …"
+	if start <= 0 {
+		start, prefix = 0, ""
+	}
+	if end >= len(text) {
+		end, suffix = len(text), ""
+	}
+	// Avoid cutting multi-byte characters in half
+	for start > 0 && !isRuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !isRuneStart(text[end]) {
+		end++
+	}
+
+	window := text[start:end]
+	lowerWindow := lower[start:end]
+	var b strings.Builder
+	for i := 0; i < len(window); {
+		matched := ""
+		for _, term := range ts {
+			if strings.HasPrefix(lowerWindow[i:], term) && len(term) > len(matched) {
+				matched = term
+			}
+		}
+		if matched != "" {
+			b.WriteString(markStart + window[i:i+len(matched)] + markStop)
+			i += len(matched)
+			continue
+		}
+		b.WriteByte(window[i])
+		i++
+	}
+	return prefix + strings.Join(strings.Fields(b.String()), " ") + suffix
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// renderSnippet escapes snippet text and turns internal markers into <mark> tags
+func renderSnippet(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, markStart, "<mark>")
+	return strings.ReplaceAll(escaped, markStop, "</mark>")
+}
@@ -0,0 +1,202 @@
+// storage/s3.go
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"backend/upstream"
+)
+
+// S3 keeps objects in a bucket of an S3 compatible service such as AWS S3
+// or MinIO. Requests are signed with AWS Signature Version 4.
+type S3 struct {
+	Endpoint  string // e.g. http://localhost:9000
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool // Address the bucket as /bucket/key rather than bucket.host/key
+	Client    *upstream.Client
+
+	base *url.URL
+}
+
+// init parses the endpoint and creates the client
+func (s *S3) init(timeout time.Duration) (*S3, error) {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", s.Endpoint)
+	}
+	s.base = u
+	if s.Client == nil {
+		s.Client = upstream.New("blobs "+s.Endpoint, upstream.Options{Timeout: timeout})
+	}
+	return s, nil
+}
+
+func (s *S3) Name() string { return "s3:" + s.Endpoint + "/" + s.Bucket }
+
+// objectURL addresses key in the bucket
+func (s *S3) objectURL(key string) (*url.URL, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	u := *s.base
+	if s.PathStyle {
+		u.Path = strings.TrimRight(u.Path, "/") + "/" + s.Bucket + "/" + key
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+		u.Path = strings.TrimRight(u.Path, "/") + "/" + key
+	}
+	u.RawPath = uriEncode(u.Path, false)
+	return &u, nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return err
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	resp, err := s.do(ctx, http.MethodPut, u, data, map[string]string{"Content-Type": contentType})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(ctx, http.MethodGet, u, nil, nil)
+	if err != nil {
+		var status *upstream.StatusError
+		if errors.As(err, &status) && status.StatusCode == http.StatusNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodDelete, u, nil, nil)
+	if err != nil {
+		var status *upstream.StatusError
+		if errors.As(err, &status) && status.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do signs and sends a request. Every S3 object call is idempotent, so
+// failed attempts are retried.
+func (s *S3) do(ctx context.Context, method string, u *url.URL, body []byte, headers map[string]string) (*http.Response, error) {
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	sum := sha256.Sum256(body)
+	headers["X-Amz-Content-Sha256"] = hex.EncodeToString(sum[:])
+	headers["X-Amz-Date"] = time.Now().UTC().Format("20060102T150405Z")
+	headers["Authorization"] = s.authorization(method, u, headers)
+	return s.Client.Do(ctx, upstream.Request{Method: method, URL: u.String(), Header: headers, Body: body, Idempotent: true})
+}
+
+// authorization computes the Signature Version 4 Authorization header over
+// the host and the given headers, which must include X-Amz-Date and
+// X-Amz-Content-Sha256
+func (s *S3) authorization(method string, u *url.URL, headers map[string]string) string {
+	amzDate := headers["X-Amz-Date"]
+	scope := amzDate[:8] + "/" + s.Region + "/s3/aws4_request"
+
+	canonical := map[string]string{"host": u.Host}
+	for k, v := range headers {
+		canonical[strings.ToLower(k)] = strings.Join(strings.Fields(v), " ")
+	}
+	names := make([]string, 0, len(canonical))
+	for k := range canonical {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + canonical[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	request := strings.Join([]string{
+		method,
+		uriEncode(u.Path, false),
+		canonicalQuery(u.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		headers["X-Amz-Content-Sha256"],
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(request))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + s.SecretKey)
+	for _, part := range []string{amzDate[:8], s.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	return fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func canonicalQuery(q url.Values) string {
+	pairs := make([]string, 0, len(q))
+	for k, vs := range q {
+		for _, v := range vs {
+			pairs = append(pairs, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes everything but unreserved characters, and
+// slashes unless encodeSlash is set, as Signature Version 4 requires
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
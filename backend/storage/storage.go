@@ -0,0 +1,75 @@
+// storage/storage.go
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned for keys with no object
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps file contents outside the database, under keys such as
+// "images/<user id>/<image id>". Tables keep the metadata and the key.
+type BlobStore interface {
+	// Name identifies the store in logs, e.g. "local:/var/lib/medibuddy"
+	Name() string
+	// Put stores data under key, replacing any object already there
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get opens the object under key, or returns ErrNotFound. The caller
+	// closes it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object under key. Missing objects are not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// FromEnv returns the store selected by BLOB_STORE: "local" (default) keeps
+// objects in BLOB_DIR (default ./data/blobs); "s3" uses the bucket
+// S3_BUCKET at S3_ENDPOINT (default https://s3.amazonaws.com) in S3_REGION
+// (default us-east-1) with S3_ACCESS_KEY and S3_SECRET_KEY. Buckets are
+// addressed by path, as MinIO expects, unless S3_PATH_STYLE=false.
+func FromEnv() (BlobStore, error) {
+	switch strings.ToLower(os.Getenv("BLOB_STORE")) {
+	case "", "local":
+		return NewLocal(envOr("BLOB_DIR", "./data/blobs"))
+	case "s3":
+		s := &S3{
+			Endpoint:  strings.TrimRight(envOr("S3_ENDPOINT", "https://s3.amazonaws.com"), "/"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    envOr("S3_REGION", "us-east-1"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			PathStyle: !strings.EqualFold(os.Getenv("S3_PATH_STYLE"), "false"),
+		}
+		if s.Bucket == "" || s.AccessKey == "" || s.SecretKey == "" {
+			return nil, fmt.Errorf("s3 blob store needs S3_BUCKET, S3_ACCESS_KEY and S3_SECRET_KEY")
+		}
+		return s.init(time.Minute)
+	}
+	return nil, fmt.Errorf("unknown blob store %q", os.Getenv("BLOB_STORE"))
+}
+
+// checkKey rejects keys that could escape the store's root or bucket
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("invalid blob key %q", key)
+		}
+	}
+	return nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,184 @@
+// transcript/font.go
+package transcript
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Fonts are the PDF standard fonts, which every reader has, so nothing is
+// embedded. They cover Western European text in WinAnsiEncoding.
+const (
+	regular = iota
+	bold
+	oblique
+)
+
+var fontNames = []string{"Helvetica", "Helvetica-Bold", "Helvetica-Oblique"}
+
+// Advance widths of the printable ASCII characters, in thousandths of the
+// font size, from the Adobe font metrics. Oblique shares the regular widths.
+var asciiWidths = [2][95]int{
+	{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278, // space to /
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556, // 0 to ?
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778, // @ to O
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556, // P to _
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556, // ` to o
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584, // p to ~
+	},
+	{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	},
+}
+
+// winAnsiExtra are the characters WinAnsiEncoding places in 0x80-0x9F,
+// with their width
+var winAnsiExtra = map[rune]struct {
+	code  byte
+	width int
+}{
+	'€': {0x80, 556}, '‚': {0x82, 222}, 'ƒ': {0x83, 556}, '„': {0x84, 333}, '…': {0x85, 1000},
+	'†': {0x86, 556}, '‡': {0x87, 556}, 'ˆ': {0x88, 333}, '‰': {0x89, 1000}, 'Š': {0x8A, 667},
+	'‹': {0x8B, 333}, 'Œ': {0x8C, 1000}, 'Ž': {0x8E, 611}, '‘': {0x91, 222}, '’': {0x92, 222},
+	'“': {0x93, 333}, '”': {0x94, 333}, '•': {0x95, 350}, '–': {0x96, 556}, '—': {0x97, 1000},
+	'˜': {0x98, 333}, '™': {0x99, 1000}, 'š': {0x9A, 500}, '›': {0x9B, 333}, 'œ': {0x9C, 944},
+	'ž': {0x9E, 500}, 'Ÿ': {0x9F, 667},
+}
+
+// greek spells out the Greek letters medical text uses for units, receptors,
+// blockers and the like. Mu is left out: it becomes the micro sign, which
+// WinAnsiEncoding has.
+var greek = map[rune]string{
+	'α': "alpha", 'β': "beta", 'γ': "gamma", 'δ': "delta", 'ε': "epsilon", 'ζ': "zeta",
+	'η': "eta", 'θ': "theta", 'ι': "iota", 'κ': "kappa", 'λ': "lambda", 'ν': "nu",
+	'ξ': "xi", 'ο': "omicron", 'π': "pi", 'ρ': "rho", 'σ': "sigma", 'ς': "sigma",
+	'τ': "tau", 'υ': "upsilon", 'φ': "phi", 'χ': "chi", 'ψ': "psi", 'ω': "omega",
+	'Α': "Alpha", 'Β': "Beta", 'Γ': "Gamma", 'Δ': "Delta", 'Ε': "Epsilon", 'Ζ': "Zeta",
+	'Η': "Eta", 'Θ': "Theta", 'Ι': "Iota", 'Κ': "Kappa", 'Λ': "Lambda", 'Μ': "Mu",
+	'Ν': "Nu", 'Ξ': "Xi", 'Ο': "Omicron", 'Π': "Pi", 'Ρ': "Rho", 'Σ': "Sigma",
+	'Τ': "Tau", 'Υ': "Upsilon", 'Φ': "Phi", 'Χ': "Chi", 'Ψ': "Psi", 'Ω': "Omega",
+}
+
+// spellGreek returns the spelling of a Greek letter, accented or not. The
+// ohm sign decomposes to omega, so it is spelled too.
+func spellGreek(r rune) (string, bool) {
+	if s, ok := greek[r]; ok {
+		return s, true
+	}
+	base, _ := utf8.DecodeRuneInString(norm.NFD.String(string(r)))
+	s, ok := greek[base]
+	return s, ok
+}
+
+// encode converts text to WinAnsiEncoding. Greek letters are spelled out
+// and accented letters outside it are written without their accents; other
+// characters become '?'.
+func encode(text string) []byte {
+	out := make([]byte, 0, len(text))
+	for _, r := range text {
+		var ok bool
+		if out, ok = appendEncoded(out, r); !ok {
+			out = append(out, '?')
+		}
+	}
+	return out
+}
+
+// appendEncoded appends the encoding of r to out, reporting whether r has
+// one
+func appendEncoded(out []byte, r rune) ([]byte, bool) {
+	if r == 'μ' { // Greek mu, as typed for micro in "μg"
+		r = 'µ'
+	}
+	if c, ok := encodeApprox(r); ok {
+		return append(out, c), true
+	}
+	if s, ok := spellGreek(r); ok {
+		return append(out, s...), true
+	}
+	return out, false
+}
+
+// unencodable returns the letters and digits of text that encode would
+// replace with '?', at most max of them. Symbols such as emoji are not
+// counted; losing them does not make the text unreadable.
+func unencodable(text string, max int) []rune {
+	var missing []rune
+	for _, r := range text {
+		if len(missing) == max {
+			break
+		}
+		if _, ok := appendEncoded(nil, r); !ok && unicode.In(r, unicode.L, unicode.N) {
+			missing = append(missing, r)
+		}
+	}
+	return missing
+}
+
+// encodeApprox encodes r, or failing that its base letter
+func encodeApprox(r rune) (byte, bool) {
+	if c, ok := encodeRune(r); ok {
+		return c, true
+	}
+	base, _ := utf8.DecodeRuneInString(norm.NFD.String(string(r)))
+	if base == r {
+		return 0, false
+	}
+	return encodeRune(base)
+}
+
+func encodeRune(r rune) (byte, bool) {
+	switch {
+	case r == '\t':
+		return ' ', true
+	case r >= 0x20 && r < 0x7F, r >= 0xA0 && r <= 0xFF:
+		return byte(r), true
+	}
+	if e, ok := winAnsiExtra[r]; ok {
+		return e.code, true
+	}
+	return 0, false
+}
+
+// width is the advance of encoded text in thousandths of the font size.
+// Latin-1 letters take the width of their base letter.
+func width(font int, text []byte) int {
+	metrics := &asciiWidths[0]
+	if font == bold {
+		metrics = &asciiWidths[1]
+	}
+	w := 0
+	for _, c := range text {
+		switch {
+		case c >= 0x20 && c < 0x7F:
+			w += metrics[c-0x20]
+		case c >= 0xA0:
+			base, _ := utf8.DecodeRuneInString(norm.NFD.String(string(rune(c))))
+			if base >= 0x20 && base < 0x7F {
+				w += metrics[base-0x20]
+			} else {
+				w += 667
+			}
+		default:
+			w += extraWidth(c)
+		}
+	}
+	return w
+}
+
+func extraWidth(c byte) int {
+	for _, e := range winAnsiExtra {
+		if e.code == c {
+			return e.width
+		}
+	}
+	return 556
+}
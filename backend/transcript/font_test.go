@@ -0,0 +1,82 @@
+package transcript
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"Glucose 5.4 mmol/L", "Glucose 5.4 mmol/L"},
+		{"Vitamin B12 250 μg", "Vitamin B12 250 \xb5g"}, // Greek mu as micro
+		{"Vitamin B12 250 µg", "Vitamin B12 250 \xb5g"},
+		{"β-blocker", "beta-blocker"},
+		{"α1-antitrypsin and TNF-α", "alpha1-antitrypsin and TNF-alpha"},
+		{"Δ 12%", "Delta 12%"},
+		{"10 kΩ", "10 kOmega"},
+		{"café – ŝ", "caf\xe9 \x96 s"},
+		{"Привет", "??????"},
+	}
+	for _, tt := range tests {
+		if got := string(encode(tt.text)); got != tt.want {
+			t.Errorf("encode(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestUnencodable(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"Take 5 μg of β-carotene", ""},
+		{"Ferritin ↑ 😀", ""}, // Symbols are not counted
+		{"Сахар в крови", "Сахар"},
+		{"血糖", "血糖"},
+	}
+	for _, tt := range tests {
+		if got := string(unencodable(tt.text, 5)); got != tt.want {
+			t.Errorf("unencodable(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestPDFScripts(t *testing.T) {
+	at := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+	transcript := func(patient, question, answer string) Transcript {
+		return Transcript{
+			Title:    "Blood test",
+			Patient:  patient,
+			Started:  at,
+			Exported: at,
+			Messages: []Message{
+				{Speaker: patient, Content: question, Time: at},
+				{Speaker: "MediBuddy", Assistant: true, Content: answer, Time: at},
+			},
+		}
+	}
+	tests := []struct {
+		name string
+		t    Transcript
+		err  error
+	}{
+		{"latin", transcript("Zoë Müller", "Is 5.4 mmol/L normal?", "Yes, it is **normal**."), nil},
+		{"greek letters", transcript("Ana", "What does a β-blocker do?", "It blocks β1 receptors; take 50 μg."), nil},
+		{"patient name", transcript("Иван Петров", "Is 5.4 mmol/L normal?", "Yes."), nil},
+		{"cyrillic text", transcript("Ivan", "Сахар 5.4 в норме?", "Да."), ErrUnsupportedScript},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		err := PDF(&buf, tt.t)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: PDF error %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if err == nil && !bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")) {
+			t.Errorf("%s: output is not a PDF", tt.name)
+		}
+	}
+}
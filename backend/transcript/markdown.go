@@ -0,0 +1,49 @@
+// transcript/markdown.go
+package transcript
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Markdown writes the transcript as Markdown. Answers are kept as the
+// chatbot wrote them, including their disclaimers; the patient's messages
+// are quoted so their text is not read as formatting.
+func Markdown(w io.Writer, t Transcript) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "# %s\n\n", t.Title)
+	if t.Patient != "" {
+		fmt.Fprintf(b, "**Patient:** %s  \n", t.Patient)
+	}
+	fmt.Fprintf(b, "**Conversation started:** %s  \n", Time(t.Started))
+	fmt.Fprintf(b, "**Exported:** %s\n\n", Time(t.Exported))
+	fmt.Fprintf(b, "> %s\n", Notice)
+
+	for _, m := range t.Messages {
+		fmt.Fprintf(b, "\n---\n\n### %s · %s\n\n", m.Speaker, Time(m.Time))
+		if m.Assistant {
+			fmt.Fprintf(b, "%s\n", m.Content)
+		} else {
+			for _, line := range strings.Split(m.Content, "\n") {
+				fmt.Fprintf(b, "> %s\n", strings.TrimRight(line, " "))
+			}
+		}
+		if m.Truncated {
+			b.WriteString("\n_This answer was cut off before it was finished._\n")
+		}
+		if len(m.Sources) > 0 {
+			b.WriteString("\n**Sources**\n\n")
+			for _, c := range m.Sources {
+				title, quote := describe(c)
+				fmt.Fprintf(b, "- %s", title)
+				if quote != "" {
+					fmt.Fprintf(b, "  \n  “%s”", quote)
+				}
+				b.WriteString("\n")
+			}
+		}
+	}
+	return b.Flush()
+}
@@ -0,0 +1,339 @@
+// transcript/pdf.go
+package transcript
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// A4 in points, with 2 cm margins
+const (
+	pageWidth    = 595.0
+	pageHeight   = 842.0
+	margin       = 56.0
+	footerHeight = 24.0
+)
+
+// ErrUnsupportedScript is returned for transcripts in scripts the PDF
+// fonts cannot show, such as Devanagari, Arabic, Chinese or Cyrillic
+var ErrUnsupportedScript = errors.New("text the PDF fonts cannot show")
+
+// PDF writes the transcript as a PDF document. Answers are laid out from
+// their Markdown: headings and list items are kept, emphasis markers are
+// dropped and disclaimers are set in italics. The standard fonts used only
+// cover Western European scripts, so transcripts with letters they lack,
+// other than Greek letters, which are spelled out, and the patient's name,
+// fail with ErrUnsupportedScript rather than print as '?'; Markdown keeps
+// any language as written.
+func PDF(w io.Writer, t Transcript) error {
+	if missing := t.unencodable(); len(missing) > 0 {
+		return fmt.Errorf("%w: %q", ErrUnsupportedScript, string(missing))
+	}
+	l := &layout{}
+	l.newPage()
+
+	l.paragraph(t.Title, style{font: bold, size: 16, after: 6})
+	if t.Patient != "" {
+		l.paragraph("Patient: "+t.Patient, style{font: regular, size: 10})
+	}
+	l.paragraph("Conversation started: "+Time(t.Started), style{font: regular, size: 10})
+	l.paragraph("Exported: "+Time(t.Exported), style{font: regular, size: 10, after: 8})
+	l.paragraph(Notice, style{font: oblique, size: 9, after: 6})
+
+	for _, m := range t.Messages {
+		l.rule()
+		l.paragraph(m.Speaker+" · "+Time(m.Time), style{font: bold, size: 10, after: 4, keep: 3})
+		if m.Assistant {
+			l.markdown(m.Content)
+		} else {
+			for _, line := range strings.Split(m.Content, "\n") {
+				l.paragraph(line, style{font: regular, size: 10, indent: 10})
+			}
+		}
+		if m.Truncated {
+			l.paragraph("This answer was cut off before it was finished.", style{font: oblique, size: 9, before: 4})
+		}
+		if len(m.Sources) > 0 {
+			l.paragraph("Sources", style{font: bold, size: 9, before: 6, keep: 2})
+			for _, c := range m.Sources {
+				title, quote := describe(c)
+				l.paragraph(title, style{font: regular, size: 8.5, indent: 10, before: 2})
+				if quote != "" {
+					l.paragraph("“"+quote+"”", style{font: oblique, size: 8, indent: 20})
+				}
+			}
+		}
+	}
+	return l.write(w, t)
+}
+
+// unencodable returns up to a few letters of the transcript the fonts lack.
+// The patient's name is left out: a name the fonts cannot show is printed
+// as best they can rather than keep the patient from a PDF at all.
+func (t Transcript) unencodable() []rune {
+	const max = 5
+	texts := []string{t.Title}
+	for _, m := range t.Messages {
+		texts = append(texts, m.Content)
+		if m.Assistant {
+			texts = append(texts, m.Speaker)
+		}
+		for _, c := range m.Sources {
+			title, quote := describe(c)
+			texts = append(texts, title, quote)
+		}
+	}
+	var missing []rune
+	for _, text := range texts {
+		missing = append(missing, unencodable(text, max-len(missing))...)
+		if len(missing) == max {
+			break
+		}
+	}
+	return missing
+}
+
+// style is how a paragraph is set. Hang is a prefix such as a bullet set
+// in the indent, with the text wrapped after it.
+type style struct {
+	font          int
+	size          float64
+	indent        float64
+	hang          string
+	before, after float64
+	keep          int // Lines of what follows to keep on the same page
+}
+
+func (s style) leading() float64 {
+	return s.size * 1.35
+}
+
+// layout places text on pages from the top down
+type layout struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func (l *layout) newPage() {
+	l.pages = append(l.pages, &bytes.Buffer{})
+	l.y = pageHeight - margin
+}
+
+func (l *layout) page() *bytes.Buffer {
+	return l.pages[len(l.pages)-1]
+}
+
+// room starts a new page unless height fits above the footer
+func (l *layout) room(height float64) {
+	if l.y-height < margin+footerHeight {
+		l.newPage()
+	}
+}
+
+func (l *layout) text(font int, size, x, y float64, text []byte) {
+	fmt.Fprintf(l.page(), "BT /F%d %.1f Tf %.2f %.2f Td %s Tj ET\n", font+1, size, x, y, literal(text))
+}
+
+// paragraph wraps text to the page width; an empty one is a gap
+func (l *layout) paragraph(text string, s style) {
+	lead := s.leading()
+	text = strings.TrimSpace(text)
+	if text == "" {
+		l.y -= lead / 2
+		return
+	}
+	l.y -= s.before
+
+	x := margin + s.indent
+	hang := encode(s.hang)
+	if len(hang) > 0 {
+		x += float64(width(s.font, hang)) * s.size / 1000
+	}
+	lines := wrap(encode(text), s.font, s.size, pageWidth-margin-x)
+	l.room(lead * float64(min(len(lines), 2)+s.keep))
+	for i, line := range lines {
+		l.room(lead)
+		l.y -= lead
+		if i == 0 && len(hang) > 0 {
+			l.text(s.font, s.size, margin+s.indent, l.y, hang)
+		}
+		l.text(s.font, s.size, x, l.y, line)
+	}
+	l.y -= s.after
+}
+
+// rule draws a separator between messages
+func (l *layout) rule() {
+	l.room(40)
+	l.y -= 8
+	fmt.Fprintf(l.page(), "0.75 G 0.5 w %.2f %.2f m %.2f %.2f l S 0 G\n", margin, l.y, pageWidth-margin, l.y)
+	l.y -= 6
+}
+
+var (
+	mdHeading  = regexp.MustCompile(`^#{1,6}\s+`)
+	mdBullet   = regexp.MustCompile(`^(\s*)[-*+]\s+`)
+	mdNumbered = regexp.MustCompile(`^(\s*)(\d+[.)])\s+`)
+	mdItalic   = regexp.MustCompile(`^[_*]([^_*].*[^_*])[_*]$`)
+	mdStrong   = strings.NewReplacer("**", "", "__", "", "`", "")
+)
+
+// markdown sets an answer line by line
+func (l *layout) markdown(content string) {
+	body := style{font: regular, size: 10}
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, " ")
+		s := body
+		switch {
+		case mdHeading.MatchString(line):
+			line = mdHeading.ReplaceAllString(line, "")
+			s.font, s.before, s.keep = bold, 4, 1
+		case mdBullet.MatchString(line):
+			m := mdBullet.FindStringSubmatch(line)
+			s.indent, s.hang = 10+float64(len(m[1]))*4, "•  "
+			line = line[len(m[0]):]
+		case mdNumbered.MatchString(line):
+			m := mdNumbered.FindStringSubmatch(line)
+			s.indent, s.hang = 10+float64(len(m[1]))*4, m[2]+" "
+			line = line[len(m[0]):]
+		}
+		if m := mdItalic.FindStringSubmatch(line); m != nil {
+			line, s.font = m[1], oblique // Disclaimers
+			if s.hang == "" {
+				s.before = 2
+			}
+		}
+		l.paragraph(mdStrong.Replace(line), s)
+	}
+}
+
+// wrap breaks text into lines no wider than maxWidth points, splitting
+// words that do not fit on a line of their own
+func wrap(text []byte, font int, size, maxWidth float64) [][]byte {
+	limit := int(maxWidth * 1000 / size)
+	var lines [][]byte
+	var line []byte
+	for _, word := range bytes.Fields(text) {
+		candidate := word
+		if len(line) > 0 {
+			candidate = append(append(append([]byte{}, line...), ' '), word...)
+		}
+		if width(font, candidate) <= limit {
+			line = candidate
+			continue
+		}
+		if len(line) > 0 {
+			lines = append(lines, line)
+		}
+		for width(font, word) > limit {
+			n := 1
+			for n < len(word) && width(font, word[:n+1]) <= limit {
+				n++
+			}
+			lines = append(lines, word[:n])
+			word = word[n:]
+		}
+		line = word
+	}
+	if len(line) > 0 {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// literal is a PDF string literal
+func literal(text []byte) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, c := range text {
+		switch {
+		case c == '(' || c == ')' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7F:
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// write adds page footers and writes the document: catalog, page tree,
+// fonts and info, then a page and its content stream per page, and the
+// cross-reference table
+func (l *layout) write(w io.Writer, t Transcript) error {
+	for i, page := range l.pages {
+		footer := encode(fmt.Sprintf("%s · Page %d of %d", t.Title, i+1, len(l.pages)))
+		if width(regular, footer)*8/1000 > int(pageWidth-2*margin) {
+			footer = encode(fmt.Sprintf("Page %d of %d", i+1, len(l.pages)))
+		}
+		fmt.Fprintf(page, "0.4 g BT /F1 8.0 Tf %.2f %.2f Td %s Tj ET 0 g\n", margin, margin, literal(footer))
+	}
+
+	out := &countingWriter{w: bufio.NewWriter(w)}
+	var offsets []int64
+	object := func(body string) {
+		offsets = append(offsets, out.n)
+		fmt.Fprintf(out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	const firstPage = 7 // After the catalog, page tree, info and three fonts
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	kids := make([]string, len(l.pages))
+	for i := range l.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(l.pages)))
+	object(fmt.Sprintf("<< /Title %s /Producer (MediBuddy) /CreationDate (D:%s) >>",
+		literal(encode(t.Title)), t.Exported.UTC().Format("20060102150405Z")))
+	for _, name := range fontNames {
+		object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", name))
+	}
+	for i, page := range l.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] "+
+			"/Resources << /Font << /F1 4 0 R /F2 5 0 R /F3 6 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, firstPage+2*i+1))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", page.Len(), page.Bytes()))
+	}
+
+	xref := out.n
+	fmt.Fprintf(out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(out, "trailer\n<< /Size %d /Root 1 0 R /Info 3 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	if out.err != nil {
+		return out.err
+	}
+	return out.w.Flush()
+}
+
+// countingWriter tracks the offset of each object for the cross-reference
+// table
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+func (c *countingWriter) WriteString(s string) (int, error) {
+	return c.Write([]byte(s))
+}
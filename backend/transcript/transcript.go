@@ -0,0 +1,130 @@
+// transcript/transcript.go
+package transcript
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"backend/chatbot"
+	"backend/models"
+)
+
+// Notice is printed at the top of every export, so whoever reads it knows
+// where the answers came from
+const Notice = "This transcript was exported from MediBuddy, an AI health assistant. " +
+	"Its answers are general information, not a diagnosis or medical advice; " +
+	"please discuss them with a healthcare professional."
+
+const timeLayout = "2 Jan 2006 15:04 MST"
+
+// Transcript is a conversation prepared for export
+type Transcript struct {
+	Title    string
+	Patient  string
+	Started  time.Time
+	Exported time.Time
+	Messages []Message
+}
+
+// Message is one turn with the sources it cites
+type Message struct {
+	Speaker   string
+	Assistant bool
+	Content   string
+	Time      time.Time
+	Sources   []chatbot.Citation
+	Truncated bool
+}
+
+// New prepares a conversation and its messages, oldest first. Times are
+// shown in loc.
+func New(conv *models.Conversation, patient string, now time.Time, loc *time.Location) Transcript {
+	t := Transcript{
+		Title:    strings.TrimSpace(conv.Title),
+		Patient:  strings.TrimSpace(patient),
+		Started:  conv.CreatedAt.In(loc),
+		Exported: now.In(loc),
+	}
+	if t.Title == "" {
+		t.Title = "MediBuddy conversation"
+	}
+	speaker := t.Patient
+	if speaker == "" {
+		speaker = "Patient"
+	}
+	for _, m := range conv.Messages {
+		msg := Message{Speaker: speaker, Content: strings.TrimSpace(m.Content), Time: m.CreatedAt.In(loc), Truncated: m.Truncated}
+		if m.Role == models.MessageRoleAssistant {
+			msg.Speaker, msg.Assistant = "MediBuddy", true
+			msg.Sources = sources(m.Citations)
+		}
+		t.Messages = append(t.Messages, msg)
+	}
+	return t
+}
+
+// sources returns the citations an answer refers to. Answers saved before
+// citations were marked as referenced list all of them.
+func sources(data []byte) []chatbot.Citation {
+	var citations []chatbot.Citation
+	if len(data) == 0 || json.Unmarshal(data, &citations) != nil {
+		return nil
+	}
+	var cited []chatbot.Citation
+	for _, c := range citations {
+		if c.Cited {
+			cited = append(cited, c)
+		}
+	}
+	if len(cited) == 0 {
+		return citations
+	}
+	return cited
+}
+
+// Filename names the exported file, e.g. medibuddy-conversation-2024-05-01.pdf
+func (t Transcript) Filename(ext string) string {
+	return "medibuddy-conversation-" + t.Started.Format("2006-01-02") + "." + ext
+}
+
+// Time formats a timestamp as shown in the export
+func Time(t time.Time) string {
+	return t.Format(timeLayout)
+}
+
+// describe is a source as listed under an answer: title, kind and date,
+// then the quoted passage
+func describe(c chatbot.Citation) (string, string) {
+	kind := "Reference"
+	switch c.Kind {
+	case "health_record":
+		kind = "Health record"
+	case "health_concern":
+		kind = "Health concerns"
+	}
+	if c.RecordedAt != nil {
+		kind += ", recorded " + c.RecordedAt.Format("2 Jan 2006")
+	}
+	title := strings.TrimSpace(c.Title)
+	if title == "" {
+		title = "Untitled source"
+	}
+	return fmt.Sprintf("[%d] %s (%s)", c.Number, title, kind), excerpt(c.Snippet, 240)
+}
+
+// excerpt collapses whitespace and shortens text to at most n runes
+func excerpt(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+	runes := []rune(text)
+	cut := strings.TrimRight(string(runes[:n]), " ")
+	if i := strings.LastIndex(cut, " "); i > n/2 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
@@ -0,0 +1,38 @@
+// trends/series.go
+package trends
+
+import (
+	"backend/labs"
+	"backend/models"
+	"backend/units"
+)
+
+// Series converts an analyte's observations to points in unit, sorted oldest
+// first. Observations stored in a unit that cannot be converted are skipped;
+// points without their own reference range get the analyte's.
+func Series(analyte *labs.Analyte, observations []models.Observation, unit string) []Point {
+	refLow := labs.ConvertBound(analyte, analyte.RefLow, analyte.Unit, unit)
+	refHigh := labs.ConvertBound(analyte, analyte.RefHigh, analyte.Unit, unit)
+
+	points := make([]Point, 0, len(observations))
+	for _, obs := range observations {
+		value, err := analyte.Convert(obs.Value, obs.Unit, unit)
+		if err != nil {
+			continue // Stored in a unit we cannot compare
+		}
+		p := Point{
+			Time:     obs.EffectiveAt,
+			Value:    units.Round(value, 3),
+			Flag:     obs.Flag,
+			RefLow:   labs.ConvertBound(analyte, obs.RefLow, obs.Unit, unit),
+			RefHigh:  labs.ConvertBound(analyte, obs.RefHigh, obs.Unit, unit),
+			SourceID: obs.HealthDataID.String(),
+		}
+		if p.RefLow == nil && p.RefHigh == nil {
+			p.RefLow, p.RefHigh = refLow, refHigh
+		}
+		points = append(points, p)
+	}
+	Sort(points)
+	return points
+}
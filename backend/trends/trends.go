@@ -0,0 +1,208 @@
+// trends/trends.go
+package trends
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Point is one value in a time series. Downsampled points stand for Count
+// original values.
+type Point struct {
+	Time     time.Time `json:"time"`
+	Value    float64   `json:"value"`
+	Flag     string    `json:"flag,omitempty"`
+	RefLow   *float64  `json:"ref_low,omitempty"`
+	RefHigh  *float64  `json:"ref_high,omitempty"`
+	SourceID string    `json:"source_id,omitempty"` // Health record the value came from
+	Count    int       `json:"count,omitempty"`
+}
+
+// OutOfRange reports whether the point is flagged or outside its range
+func (p Point) OutOfRange() bool {
+	if p.Flag != "" {
+		return true
+	}
+	return (p.RefHigh != nil && p.Value > *p.RefHigh) || (p.RefLow != nil && p.Value < *p.RefLow)
+}
+
+// Stats summarizes a series
+type Stats struct {
+	Count            int      `json:"count"`
+	Latest           *Point   `json:"latest,omitempty"`
+	Min              *Point   `json:"min,omitempty"`
+	Max              *Point   `json:"max,omitempty"`
+	Mean             float64  `json:"mean"`
+	SlopePerYear     float64  `json:"slope_per_year"`           // Least squares slope, units per year
+	PercentChange    *float64 `json:"percent_change,omitempty"` // First to latest value
+	Direction        string   `json:"direction"`                // rising, falling, stable or insufficient_data
+	OutOfRange       int      `json:"out_of_range"`
+	LatestOutOfRange bool     `json:"latest_out_of_range"`
+}
+
+// stableThreshold is the relative change over the series span below which a
+// trend is reported as stable
+const stableThreshold = 0.05
+
+// Sort orders points oldest first
+func Sort(points []Point) {
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+}
+
+// Analyze computes summary statistics for points sorted oldest first
+func Analyze(points []Point) Stats {
+	stats := Stats{Count: len(points), Direction: "insufficient_data"}
+	if len(points) == 0 {
+		return stats
+	}
+
+	sum := 0.0
+	minIdx, maxIdx := 0, 0
+	for i, p := range points {
+		sum += p.Value
+		if p.Value < points[minIdx].Value {
+			minIdx = i
+		}
+		if p.Value > points[maxIdx].Value {
+			maxIdx = i
+		}
+		if p.OutOfRange() {
+			stats.OutOfRange++
+		}
+	}
+	first, latest := points[0], points[len(points)-1]
+	stats.Mean = round(sum / float64(len(points)))
+	stats.Latest = &latest
+	stats.Min = &points[minIdx]
+	stats.Max = &points[maxIdx]
+	stats.LatestOutOfRange = latest.OutOfRange()
+
+	if len(points) < 2 {
+		return stats
+	}
+	if first.Value != 0 {
+		change := round((latest.Value - first.Value) / math.Abs(first.Value) * 100)
+		stats.PercentChange = &change
+	}
+
+	slopePerDay, ok := slope(points)
+	if !ok {
+		return stats
+	}
+	stats.SlopePerYear = round(slopePerDay * 365.25)
+
+	spanDays := latest.Time.Sub(first.Time).Hours() / 24
+	expected := slopePerDay * spanDays
+	switch {
+	case stats.Mean == 0 || math.Abs(expected/stats.Mean) < stableThreshold:
+		stats.Direction = "stable"
+	case expected > 0:
+		stats.Direction = "rising"
+	default:
+		stats.Direction = "falling"
+	}
+	return stats
+}
+
+// slope fits value = a + b*days by least squares and returns b
+func slope(points []Point) (float64, bool) {
+	t0 := points[0].Time
+	n := float64(len(points))
+	var sx, sy, sxx, sxy float64
+	for _, p := range points {
+		x := p.Time.Sub(t0).Hours() / 24
+		sx += x
+		sy += p.Value
+		sxx += x * x
+		sxy += x * p.Value
+	}
+	den := n*sxx - sx*sx
+	if den == 0 {
+		return 0, false // all values on the same day
+	}
+	return (n*sxy - sx*sy) / den, true
+}
+
+// MovingAverage returns the trailing mean over window points for each point
+func MovingAverage(points []Point, window int) []Point {
+	if window < 1 {
+		window = 1
+	}
+	out := make([]Point, 0, len(points))
+	sum := 0.0
+	for i, p := range points {
+		sum += p.Value
+		if i >= window {
+			sum -= points[i-window].Value
+		}
+		n := window
+		if i+1 < window {
+			n = i + 1
+		}
+		out = append(out, Point{Time: p.Time, Value: round(sum / float64(n)), Count: n})
+	}
+	return out
+}
+
+// Downsample reduces a long series to at most max points using
+// largest-triangle-three-buckets, which keeps peaks and dips visible.
+// Out-of-range points are preferred within a bucket so abnormal values are
+// not hidden.
+func Downsample(points []Point, max int) []Point {
+	if max < 3 || len(points) <= max {
+		return points
+	}
+
+	out := make([]Point, 0, max)
+	out = append(out, points[0])
+	bucket := float64(len(points)-2) / float64(max-2)
+	prev := 0
+
+	for i := 0; i < max-2; i++ {
+		start := int(float64(i)*bucket) + 1
+		end := int(float64(i+1)*bucket) + 1
+		if end > len(points)-1 {
+			end = len(points) - 1
+		}
+
+		// Average of the next bucket is the third triangle vertex
+		nextStart, nextEnd := end, int(float64(i+2)*bucket)+1
+		if nextEnd > len(points) {
+			nextEnd = len(points)
+		}
+		if nextEnd <= nextStart {
+			nextStart, nextEnd = len(points)-1, len(points)
+		}
+		var avgX, avgY float64
+		for _, p := range points[nextStart:nextEnd] {
+			avgX += float64(p.Time.Unix())
+			avgY += p.Value
+		}
+		cnt := float64(nextEnd - nextStart)
+		avgX, avgY = avgX/cnt, avgY/cnt
+
+		ax, ay := float64(points[prev].Time.Unix()), points[prev].Value
+		best, bestArea := start, -1.0
+		for j := start; j < end; j++ {
+			bx, by := float64(points[j].Time.Unix()), points[j].Value
+			area := math.Abs((ax-avgX)*(by-ay)-(ax-bx)*(avgY-ay)) / 2
+			if points[j].OutOfRange() && !points[best].OutOfRange() {
+				area = math.Inf(1)
+			}
+			if area > bestArea {
+				best, bestArea = j, area
+			}
+		}
+		p := points[best]
+		p.Count = end - start
+		out = append(out, p)
+		prev = best
+	}
+
+	return append(out, points[len(points)-1])
+}
+
+func round(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
@@ -0,0 +1,87 @@
+package trends
+
+import (
+	"testing"
+	"time"
+)
+
+func series(values ...float64) []Point {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	points := make([]Point, len(values))
+	for i, v := range values {
+		points[i] = Point{Time: start.AddDate(0, i, 0), Value: v}
+	}
+	return points
+}
+
+func TestAnalyze(t *testing.T) {
+	high := 6.0
+	flagged := series(5.0, 5.5, 6.5)
+	flagged[2].RefHigh = &high
+
+	tests := []struct {
+		name       string
+		points     []Point
+		direction  string
+		outOfRange int
+	}{
+		{"empty", nil, "insufficient_data", 0},
+		{"single", series(5), "insufficient_data", 0},
+		{"rising", series(5, 6, 7, 8), "rising", 0},
+		{"falling", series(8, 7, 6, 5), "falling", 0},
+		{"stable", series(5, 5.05, 4.98, 5.02), "stable", 0},
+		{"out of range", flagged, "rising", 1},
+	}
+	for _, tt := range tests {
+		stats := Analyze(tt.points)
+		if stats.Direction != tt.direction || stats.OutOfRange != tt.outOfRange || stats.Count != len(tt.points) {
+			t.Errorf("%s: got %s with %d of %d out of range, want %s with %d",
+				tt.name, stats.Direction, stats.OutOfRange, stats.Count, tt.direction, tt.outOfRange)
+		}
+	}
+
+	stats := Analyze(series(4, 5))
+	if stats.PercentChange == nil || *stats.PercentChange != 25 {
+		t.Errorf("percent change %v, want 25", stats.PercentChange)
+	}
+	if stats.Min.Value != 4 || stats.Max.Value != 5 || stats.Latest.Value != 5 || stats.Mean != 4.5 {
+		t.Errorf("got min %v, max %v, latest %v, mean %v", stats.Min.Value, stats.Max.Value, stats.Latest.Value, stats.Mean)
+	}
+}
+
+func TestMovingAverage(t *testing.T) {
+	got := MovingAverage(series(1, 2, 3, 4), 2)
+	want := []float64{1, 1.5, 2.5, 3.5}
+	for i, p := range got {
+		if p.Value != want[i] {
+			t.Errorf("point %d: %v, want %v", i, p.Value, want[i])
+		}
+	}
+}
+
+func TestDownsampleKeepsOutOfRange(t *testing.T) {
+	values := make([]float64, 200)
+	for i := range values {
+		values[i] = 5
+	}
+	values[97] = 5.1 // Flagged, though barely a peak
+	values[150] = 9  // A peak
+	points := series(values...)
+	points[97].Flag = "H"
+
+	got := Downsample(points, 20)
+	if len(got) != 20 {
+		t.Fatalf("%d points, want 20", len(got))
+	}
+	if got[0].Time != points[0].Time || got[19].Time != points[199].Time {
+		t.Error("first and last points not kept")
+	}
+	var flag, peak bool
+	for _, p := range got {
+		flag = flag || p.Flag == "H"
+		peak = peak || p.Value == 9
+	}
+	if !flag || !peak {
+		t.Errorf("flagged point kept: %v, peak kept: %v", flag, peak)
+	}
+}
@@ -0,0 +1,259 @@
+// triage/engine.go
+package triage
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidAnswer is returned for an answer the current question does not
+// accept
+var ErrInvalidAnswer = errors.New("invalid answer")
+
+// Answer is a recorded answer to a question
+type Answer struct {
+	QuestionID string `json:"question_id"`
+	Question   string `json:"question"`
+	Value      string `json:"value"`
+	Label      string `json:"label"`               // Value as shown, e.g. the option label or "3 days"
+	Prefilled  bool   `json:"prefilled,omitempty"` // Taken from the user's health concerns
+}
+
+// State is where a triage stands after its answers
+type State struct {
+	Concern Concern
+	Answers []Answer
+	Current *Question // Next question; nil when the triage is done
+	Urgency string    // Highest urgency raised so far
+	Reasons []string  // Why urgency was raised
+}
+
+// Done reports whether no questions are left
+func (s State) Done() bool {
+	return s.Current == nil
+}
+
+// Concern is what the user already told in their health concerns
+type Concern struct {
+	Symptoms  string
+	StartDate *time.Time
+}
+
+// Begin starts a triage. Questions the concern answers are filled in here
+// and whenever the flow reaches them; prefilled answers can be changed like
+// any other.
+func (f *Flow) Begin(concern Concern) State {
+	s := State{Concern: concern, Current: f.byID[f.Start], Urgency: SelfCare}
+	f.prefill(&s)
+	return s
+}
+
+// prefill answers questions from the concern until one needs the user
+func (f *Flow) prefill(s *State) {
+	for s.Current != nil {
+		value, ok := prefill(s.Current, s.Concern, time.Now())
+		if !ok {
+			return
+		}
+		answer, branch, err := s.Current.accept(value)
+		if err != nil {
+			return
+		}
+		answer.Prefilled = true
+		f.apply(s, answer, branch)
+	}
+}
+
+// Replay rebuilds the state of a triage from its concern and answers
+func (f *Flow) Replay(concern Concern, answers []Answer) (State, error) {
+	s := State{Concern: concern, Current: f.byID[f.Start], Urgency: SelfCare}
+	for _, a := range answers {
+		if s.Current == nil || s.Current.ID != a.QuestionID {
+			return s, fmt.Errorf("answer to %q does not fit the flow", a.QuestionID)
+		}
+		answer, branch, err := s.Current.accept(a.Value)
+		if err != nil {
+			return s, err
+		}
+		answer.Prefilled = a.Prefilled
+		f.apply(&s, answer, branch)
+	}
+	return s, nil
+}
+
+// Answer records the answer to questionID. Answering an earlier question
+// again discards the answers after it, as the path may change.
+func (f *Flow) Answer(s State, questionID, value string) (State, error) {
+	answers := s.Answers
+	if s.Current == nil || s.Current.ID != questionID {
+		i := 0
+		for i < len(answers) && answers[i].QuestionID != questionID {
+			i++
+		}
+		if i == len(answers) {
+			return s, fmt.Errorf("%w: question %q is not open", ErrInvalidAnswer, questionID)
+		}
+		var err error
+		if s, err = f.Replay(s.Concern, answers[:i]); err != nil {
+			return s, err
+		}
+	}
+	answer, branch, err := s.Current.accept(value)
+	if err != nil {
+		return s, err
+	}
+	f.apply(&s, answer, branch)
+	f.prefill(&s)
+	return s, nil
+}
+
+func (f *Flow) apply(s *State, answer Answer, branch Branch) {
+	s.Answers = append(s.Answers, answer)
+	if urgencyRank[branch.Urgency] > urgencyRank[s.Urgency] {
+		s.Urgency = branch.Urgency
+	}
+	if branch.Urgency != "" && branch.Reason != "" {
+		s.Reasons = append(s.Reasons, branch.Reason)
+	}
+	next := branch.Next
+	if next == "" {
+		next = s.Current.Next
+	}
+	if branch.Stop || next == "" {
+		s.Current = nil
+		return
+	}
+	s.Current = f.byID[next]
+}
+
+// accept checks a value against the question and returns the branch it
+// takes
+func (q *Question) accept(value string) (Answer, Branch, error) {
+	value = strings.TrimSpace(value)
+	answer := Answer{QuestionID: q.ID, Question: q.Text, Value: value, Label: value}
+	switch q.Type {
+	case TypeChoice:
+		for _, o := range q.Options {
+			if o.Value == value {
+				answer.Label = o.Label
+				return answer, o.Branch, nil
+			}
+		}
+		return answer, Branch{}, fmt.Errorf("%w: expected one of %s", ErrInvalidAnswer, strings.Join(q.values(), ", "))
+	case TypeNumber:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || (q.Min != nil && v < *q.Min) || (q.Max != nil && v > *q.Max) {
+			return answer, Branch{}, fmt.Errorf("%w: expected a number%s", ErrInvalidAnswer, q.bounds())
+		}
+		if q.Unit != "" {
+			answer.Label = value + " " + q.Unit
+		}
+		for _, r := range q.Ranges {
+			if r.contains(v) {
+				return answer, r.Branch, nil
+			}
+		}
+		return answer, Branch{}, nil
+	default:
+		if value == "" && !q.Optional {
+			return answer, Branch{}, fmt.Errorf("%w: an answer is required", ErrInvalidAnswer)
+		}
+		return answer, Branch{}, nil
+	}
+}
+
+func (q *Question) values() []string {
+	values := make([]string, len(q.Options))
+	for i, o := range q.Options {
+		values[i] = o.Value
+	}
+	return values
+}
+
+func (q *Question) bounds() string {
+	switch {
+	case q.Min != nil && q.Max != nil:
+		return fmt.Sprintf(" from %g to %g", *q.Min, *q.Max)
+	case q.Min != nil:
+		return fmt.Sprintf(" of at least %g", *q.Min)
+	case q.Max != nil:
+		return fmt.Sprintf(" of at most %g", *q.Max)
+	}
+	return ""
+}
+
+// prefill answers a question from the concern when it can tell the answer
+// unambiguously
+func prefill(q *Question, c Concern, now time.Time) (string, bool) {
+	switch q.Prefill {
+	case PrefillSymptoms:
+		text := strings.ToLower(c.Symptoms)
+		match := ""
+		for _, o := range q.Options {
+			for _, k := range o.Keywords {
+				if regexp.MustCompile(`\b` + regexp.QuoteMeta(strings.ToLower(k))).MatchString(text) {
+					if match != "" && match != o.Value {
+						return "", false // Several symptoms; let the user pick
+					}
+					match = o.Value
+					break
+				}
+			}
+		}
+		return match, match != ""
+	case PrefillDurationDays:
+		if c.StartDate == nil || c.StartDate.After(now) {
+			return "", false
+		}
+		return strconv.Itoa(int(now.Sub(*c.StartDate).Hours() / 24)), true
+	}
+	return "", false
+}
+
+// Step is a question as shown to the user
+type Step struct {
+	ID       string   `json:"id"`
+	Text     string   `json:"text"`
+	Type     string   `json:"type"`
+	Options  []Choice `json:"options,omitempty"`
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+	Unit     string   `json:"unit,omitempty"`
+	Optional bool     `json:"optional,omitempty"`
+}
+
+// Choice is an option as shown to the user
+type Choice struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+}
+
+// Step returns the question without its branches
+func (q *Question) Step() *Step {
+	step := &Step{ID: q.ID, Text: q.Text, Type: q.Type, Min: q.Min, Max: q.Max, Unit: q.Unit, Optional: q.Optional}
+	for _, o := range q.Options {
+		step.Options = append(step.Options, Choice{Value: o.Value, Label: o.Label})
+	}
+	return step
+}
+
+// Summary describes a finished triage for the user's records
+func (f *Flow) Summary(s State, completed time.Time) string {
+	outcome := f.Outcome(s.Urgency)
+	var b strings.Builder
+	fmt.Fprintf(&b, "Symptom triage on %s: %s\n", completed.Format("2006-01-02"), outcome.Title)
+	for _, a := range s.Answers {
+		if a.Label != "" {
+			fmt.Fprintf(&b, "%s %s\n", a.Question, a.Label)
+		}
+	}
+	if len(s.Reasons) > 0 {
+		fmt.Fprintf(&b, "Reasons: %s\n", strings.Join(s.Reasons, "; "))
+	}
+	fmt.Fprintf(&b, "Advice: %s\n", outcome.Advice)
+	return b.String()
+}
@@ -0,0 +1,242 @@
+// triage/flow.go
+package triage
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Urgency levels, least urgent first
+const (
+	SelfCare  = "self_care" // Can be managed at home
+	GP        = "gp"        // See a GP or primary care doctor within a few days
+	Urgent    = "urgent"    // Get medical advice today
+	Emergency = "emergency" // Call emergency services now
+)
+
+var urgencyRank = map[string]int{SelfCare: 0, GP: 1, Urgent: 2, Emergency: 3}
+
+// Question types
+const (
+	TypeChoice = "choice" // One of Options
+	TypeNumber = "number" // A number, branched on by Ranges
+	TypeText   = "text"   // Free text, recorded for the summary
+)
+
+// Prefills answer a question from the health concerns triage starts from
+const (
+	PrefillSymptoms     = "symptoms"      // The option whose keywords the symptoms mention
+	PrefillDurationDays = "duration_days" // Days since the concern started
+)
+
+// Branch is what an answer leads to. Urgency raises the outcome to at
+// least that level; Stop ends the flow there.
+type Branch struct {
+	Next    string `json:"next,omitempty"`
+	Urgency string `json:"urgency,omitempty"`
+	Stop    bool   `json:"stop,omitempty"`
+	Reason  string `json:"reason,omitempty"` // Why the urgency was raised, for the summary
+}
+
+// Option is an answer to a choice question
+type Option struct {
+	Value    string   `json:"value"`
+	Label    string   `json:"label"`
+	Keywords []string `json:"keywords,omitempty"` // Matched against free-text symptoms
+	Branch
+}
+
+// Range matches numbers from Min (inclusive) up to Max (exclusive). Either
+// bound may be left open.
+type Range struct {
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+	Branch
+}
+
+func (r Range) contains(v float64) bool {
+	return (r.Min == nil || v >= *r.Min) && (r.Max == nil || v < *r.Max)
+}
+
+// Question is one step of the flow. Answers without a branch of their own
+// go on to Next; the flow ends after a question without one.
+type Question struct {
+	ID       string   `json:"id"`
+	Text     string   `json:"text"`
+	Type     string   `json:"type"`
+	Options  []Option `json:"options,omitempty"`
+	Ranges   []Range  `json:"ranges,omitempty"`
+	Min      *float64 `json:"min,omitempty"` // Accepted numbers
+	Max      *float64 `json:"max,omitempty"`
+	Unit     string   `json:"unit,omitempty"`
+	Optional bool     `json:"optional,omitempty"` // Text questions that may be left empty
+	Prefill  string   `json:"prefill,omitempty"`
+	Next     string   `json:"next,omitempty"`
+}
+
+// Outcome is the advice given for an urgency level
+type Outcome struct {
+	Title  string `json:"title"`
+	Advice string `json:"advice"`
+}
+
+// Flow is a validated triage decision tree
+type Flow struct {
+	Start     string             `json:"start"`
+	Questions []*Question        `json:"questions"`
+	Outcomes  map[string]Outcome `json:"outcomes"`
+
+	byID map[string]*Question
+}
+
+//go:embed flow.json
+var defaultFlow []byte
+
+// DefaultFlow returns the flow shipped with the backend
+func DefaultFlow() (*Flow, error) {
+	return ParseFlow(defaultFlow)
+}
+
+// LoadFlow reads a flow file
+func LoadFlow(path string) (*Flow, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	flow, err := ParseFlow(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return flow, nil
+}
+
+// FlowFromEnv loads the flow file named by TRIAGE_FLOW, or the default flow
+// when it is unset
+func FlowFromEnv() (*Flow, error) {
+	if path := os.Getenv("TRIAGE_FLOW"); path != "" {
+		return LoadFlow(path)
+	}
+	return DefaultFlow()
+}
+
+// ParseFlow decodes and validates a flow: every branch must lead to a
+// known question, and the flow must not loop
+func ParseFlow(data []byte) (*Flow, error) {
+	var f Flow
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	f.byID = map[string]*Question{}
+	for _, q := range f.Questions {
+		if q.ID == "" || strings.TrimSpace(q.Text) == "" {
+			return nil, fmt.Errorf("questions need an id and text")
+		}
+		if f.byID[q.ID] != nil {
+			return nil, fmt.Errorf("duplicate question %q", q.ID)
+		}
+		f.byID[q.ID] = q
+	}
+	if f.byID[f.Start] == nil {
+		return nil, fmt.Errorf("unknown start question %q", f.Start)
+	}
+	for level := range urgencyRank {
+		if strings.TrimSpace(f.Outcomes[level].Advice) == "" {
+			return nil, fmt.Errorf("missing advice for %s", level)
+		}
+	}
+
+	for _, q := range f.Questions {
+		var branches []Branch
+		switch q.Type {
+		case TypeChoice:
+			if len(q.Options) == 0 {
+				return nil, fmt.Errorf("question %q: choices need options", q.ID)
+			}
+			seen := map[string]bool{}
+			for _, o := range q.Options {
+				if o.Value == "" || o.Label == "" || seen[o.Value] {
+					return nil, fmt.Errorf("question %q: options need a unique value and a label", q.ID)
+				}
+				seen[o.Value] = true
+				branches = append(branches, o.Branch)
+			}
+		case TypeNumber:
+			for _, r := range q.Ranges {
+				branches = append(branches, r.Branch)
+			}
+		case TypeText:
+		default:
+			return nil, fmt.Errorf("question %q: unknown type %q", q.ID, q.Type)
+		}
+		switch q.Prefill {
+		case "", PrefillSymptoms, PrefillDurationDays:
+		default:
+			return nil, fmt.Errorf("question %q: unknown prefill %q", q.ID, q.Prefill)
+		}
+		branches = append(branches, Branch{Next: q.Next})
+		for _, b := range branches {
+			if b.Next != "" && f.byID[b.Next] == nil {
+				return nil, fmt.Errorf("question %q: unknown next question %q", q.ID, b.Next)
+			}
+			if _, ok := urgencyRank[b.Urgency]; b.Urgency != "" && !ok {
+				return nil, fmt.Errorf("question %q: unknown urgency %q", q.ID, b.Urgency)
+			}
+		}
+	}
+	if err := f.checkLoops(f.Start, map[string]int{}); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// checkLoops walks the flow depth first; state is 1 while a question is on
+// the current path and 2 once all paths from it end
+func (f *Flow) checkLoops(id string, state map[string]int) error {
+	switch state[id] {
+	case 1:
+		return fmt.Errorf("question %q is reachable from itself", id)
+	case 2:
+		return nil
+	}
+	state[id] = 1
+	for _, next := range f.byID[id].nexts() {
+		if err := f.checkLoops(next, state); err != nil {
+			return err
+		}
+	}
+	state[id] = 2
+	return nil
+}
+
+// nexts lists the questions an answer to q can lead to
+func (q *Question) nexts() []string {
+	var out []string
+	for _, o := range q.Options {
+		if !o.Stop && o.Next != "" {
+			out = append(out, o.Next)
+		}
+	}
+	for _, r := range q.Ranges {
+		if !r.Stop && r.Next != "" {
+			out = append(out, r.Next)
+		}
+	}
+	if q.Next != "" {
+		out = append(out, q.Next) // Where the other answers go
+	}
+	return out
+}
+
+// Question returns the question with id, nil when there is none
+func (f *Flow) Question(id string) *Question {
+	return f.byID[id]
+}
+
+// Outcome returns the advice for an urgency level
+func (f *Flow) Outcome(urgency string) Outcome {
+	return f.Outcomes[urgency]
+}
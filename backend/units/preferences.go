@@ -0,0 +1,91 @@
+// units/preferences.go
+package units
+
+import (
+	"math"
+
+	"backend/models"
+)
+
+// Measurement systems for height and weight
+const (
+	Metric   = "metric"
+	Imperial = "imperial"
+)
+
+// Lab unit conventions
+const (
+	Conventional = "conventional" // mg/dL, as printed on most of our users' reports
+	SI           = "si"           // mmol/L and friends
+)
+
+// Preferences decide how values are shown to a user
+type Preferences struct {
+	System   string `json:"unitSystem"`
+	LabUnits string `json:"labUnits"`
+}
+
+// PreferencesOf reads a user's display preferences, filling in defaults
+func PreferencesOf(user models.User) Preferences {
+	p := Preferences{System: user.UnitSystem, LabUnits: user.LabUnits}
+	if !ValidSystem(p.System) {
+		p.System = Metric
+	}
+	if !ValidLabUnits(p.LabUnits) {
+		p.LabUnits = Conventional
+	}
+	return p
+}
+
+func ValidSystem(s string) bool {
+	return s == Metric || s == Imperial
+}
+
+func ValidLabUnits(s string) bool {
+	return s == Conventional || s == SI
+}
+
+// ToCentimeters converts a height entered in any length unit.
+// An empty unit means the default unit of the given system.
+func ToCentimeters(value float64, unit, system string) (float64, error) {
+	if unit == "" {
+		unit = "cm"
+		if system == Imperial {
+			unit = "[in_i]"
+		}
+	}
+	return Convert(value, unit, "cm")
+}
+
+// ToKilograms converts a weight entered in any mass unit.
+// An empty unit means the default unit of the given system.
+func ToKilograms(value float64, unit, system string) (float64, error) {
+	if unit == "" {
+		unit = "kg"
+		if system == Imperial {
+			unit = "[lb_av]"
+		}
+	}
+	return Convert(value, unit, "kg")
+}
+
+// LocalizeUser converts the stored centimeters and kilograms of a user to
+// their preferred system for an API response. It must not be saved afterwards.
+func LocalizeUser(user *models.User) {
+	prefs := PreferencesOf(*user)
+	user.UnitSystem, user.LabUnits = prefs.System, prefs.LabUnits
+	user.HeightUnit, user.WeightUnit = "cm", "kg"
+	if prefs.System == Imperial {
+		user.Height, _ = Convert(user.Height, "cm", "[in_i]")
+		user.Weight, _ = Convert(user.Weight, "kg", "[lb_av]")
+		user.HeightUnit, user.WeightUnit = "in", "lb"
+	}
+	user.Height = Round(user.Height, 1)
+	user.Weight = Round(user.Weight, 1)
+}
+
+// Round rounds to a number of decimal places
+func Round(v float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(v*p) / p
+}
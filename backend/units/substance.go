@@ -0,0 +1,76 @@
+// units/substance.go
+package units
+
+import "fmt"
+
+// Substance carries the analyte properties needed to cross between mass,
+// molar and equivalent concentrations, e.g. glucose in mg/dL and mmol/L.
+type Substance struct {
+	MolarMass float64 // g/mol
+	Valence   int     // Charge, for mEq/L
+	// Custom handles conversions that are not proportional, such as HbA1c
+	// between NGSP percent and IFCC mmol/mol. It reports false to defer.
+	Custom func(value float64, from, to string) (float64, bool)
+}
+
+var (
+	massConcentration   = Dimension{Mass: 1, Length: -3}
+	amountConcentration = Dimension{Amount: 1, Length: -3}
+	equivConcentration  = Dimension{Equivalents: 1, Length: -3}
+)
+
+// ConvertFor converts value between units for a specific substance, falling
+// back to plain dimensional conversion when no substance data is needed.
+func ConvertFor(value float64, from, to string, sub Substance) (float64, error) {
+	fu, err := Parse(from)
+	if err != nil {
+		return 0, err
+	}
+	tu, err := Parse(to)
+	if err != nil {
+		return 0, err
+	}
+	if sub.Custom != nil {
+		if v, ok := sub.Custom(value, fu.Code, tu.Code); ok {
+			return v, nil
+		}
+	}
+	if fu.Compatible(tu) {
+		return Convert(value, fu.Code, tu.Code)
+	}
+
+	molar, ok := toMolar(value, fu, sub)
+	if !ok {
+		return 0, fmt.Errorf("cannot convert %s to %s", fu.Code, tu.Code)
+	}
+	v, ok := fromMolar(molar, tu, sub)
+	if !ok {
+		return 0, fmt.Errorf("cannot convert %s to %s", fu.Code, tu.Code)
+	}
+	return v, nil
+}
+
+// toMolar expresses a concentration in mol per cubic meter
+func toMolar(value float64, u Unit, sub Substance) (float64, bool) {
+	switch {
+	case u.Dim == amountConcentration:
+		return value * u.Factor, true
+	case u.Dim == massConcentration && sub.MolarMass > 0:
+		return value * u.Factor / sub.MolarMass, true
+	case u.Dim == equivConcentration && sub.Valence > 0:
+		return value * u.Factor / float64(sub.Valence), true
+	}
+	return 0, false
+}
+
+func fromMolar(molar float64, u Unit, sub Substance) (float64, bool) {
+	switch {
+	case u.Dim == amountConcentration:
+		return molar / u.Factor, true
+	case u.Dim == massConcentration && sub.MolarMass > 0:
+		return molar * sub.MolarMass / u.Factor, true
+	case u.Dim == equivConcentration && sub.Valence > 0:
+		return molar * float64(sub.Valence) / u.Factor, true
+	}
+	return 0, false
+}
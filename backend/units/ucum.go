@@ -0,0 +1,315 @@
+// units/ucum.go
+package units
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Dimension holds base-unit exponents
+type Dimension struct {
+	Mass, Length, Time, Amount, Equivalents, Enzyme, International, Temperature, Pressure int8
+}
+
+// Unit is a parsed UCUM-style unit expression
+type Unit struct {
+	Code   string    // Canonical UCUM code, e.g. "mg/dL" or "[lb_av]"
+	Factor float64   // Magnitude relative to the base units of Dim
+	Dim    Dimension //
+}
+
+type atom struct {
+	code   string
+	factor float64
+	dim    Dimension
+}
+
+// atoms are keyed by lower case so OCR text like "MG/DL" still parses
+var atoms = map[string]atom{
+	"g":       {"g", 1, Dimension{Mass: 1}},
+	"l":       {"L", 1e-3, Dimension{Length: 3}},
+	"m":       {"m", 1, Dimension{Length: 1}},
+	"s":       {"s", 1, Dimension{Time: 1}},
+	"min":     {"min", 60, Dimension{Time: 1}},
+	"h":       {"h", 3600, Dimension{Time: 1}},
+	"d":       {"d", 86400, Dimension{Time: 1}},
+	"mol":     {"mol", 1, Dimension{Amount: 1}},
+	"eq":      {"eq", 1, Dimension{Equivalents: 1}},
+	"u":       {"U", 1, Dimension{Enzyme: 1}},
+	"[iu]":    {"[IU]", 1, Dimension{International: 1}},
+	"iu":      {"[IU]", 1, Dimension{International: 1}},
+	"%":       {"%", 0.01, Dimension{}},
+	"[lb_av]": {"[lb_av]", 453.59237, Dimension{Mass: 1}},
+	"[oz_av]": {"[oz_av]", 28.349523125, Dimension{Mass: 1}},
+	"[st_av]": {"[st_av]", 6350.29318, Dimension{Mass: 1}},
+	"[in_i]":  {"[in_i]", 0.0254, Dimension{Length: 1}},
+	"[ft_i]":  {"[ft_i]", 0.3048, Dimension{Length: 1}},
+	"cel":     {"Cel", 1, Dimension{Temperature: 1}},
+	"[degf]":  {"[degF]", 5.0 / 9.0, Dimension{Temperature: 1}},
+	"mm[hg]":  {"mm[Hg]", 1, Dimension{Pressure: 1}},
+}
+
+var prefixes = map[string]struct {
+	code   string
+	factor float64
+}{
+	"k": {"k", 1e3},
+	"d": {"d", 1e-1},
+	"c": {"c", 1e-2},
+	"m": {"m", 1e-3},
+	"u": {"u", 1e-6},
+	"n": {"n", 1e-9},
+	"p": {"p", 1e-12},
+	"f": {"f", 1e-15},
+}
+
+// synonyms maps spellings seen on reports and forms to UCUM codes
+var synonyms = map[string]string{
+	"lb": "[lb_av]", "lbs": "[lb_av]", "pound": "[lb_av]", "pounds": "[lb_av]",
+	"oz": "[oz_av]", "st": "[st_av]", "stone": "[st_av]",
+	"kgs": "kg", "kilogram": "kg", "kilograms": "kg", "gram": "g", "grams": "g",
+	"in": "[in_i]", "inch": "[in_i]", "inches": "[in_i]", `"`: "[in_i]",
+	"ft": "[ft_i]", "feet": "[ft_i]", "foot": "[ft_i]", "'": "[ft_i]",
+	"cms": "cm", "centimeter": "cm", "centimeters": "cm", "metre": "m", "meter": "m", "meters": "m",
+	"°c": "Cel", "degc": "Cel", "c": "Cel", "celsius": "Cel",
+	"°f": "[degF]", "degf": "[degF]", "f": "[degF]", "fahrenheit": "[degF]",
+	"mmhg": "mm[Hg]", "bpm": "/min", "beats/min": "/min", "breaths/min": "/min",
+	"iu": "[IU]", "cc": "mL", "cumm": "mm3",
+}
+
+// countPrefixes are the case-sensitive spellings of cell counts, checked
+// before the unit is lowercased: "M/uL" is millions per microliter, while
+// "m/uL" would be meters
+var countPrefixes = []struct{ prefix, code string }{
+	{"K/", "10*3/"}, {"k/", "10*3/"}, {"M/", "10*6/"},
+}
+
+// fragment spellings replaced inside larger expressions
+var fragmentReplacer = strings.NewReplacer(
+	"µ", "u", "μ", "u", "mcg", "ug", "cumm", "mm3", "thou/", "10*3/", "mil/", "10*6/",
+)
+
+var (
+	powerOfTen  = regexp.MustCompile(`^(?:x\s?)?10(?:\^|\*|e)?([0-9]+)$`)
+	leadingNum  = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)(.*)$`)
+	trailingExp = regexp.MustCompile(`^(.*?[a-z\]%])(-?[0-9]+)$`)
+	annotation  = regexp.MustCompile(`\{[^}]*\}`)
+)
+
+// Normalize returns the canonical UCUM code for a unit spelling, or the
+// trimmed input when it cannot be parsed.
+func Normalize(s string) string {
+	u, err := Parse(s)
+	if err != nil {
+		return strings.TrimSpace(s)
+	}
+	return u.Code
+}
+
+// Parse reads a UCUM-style unit such as "mg/dL", "10*3/uL", "mL/min/1.73m2"
+// or a common spelling such as "lbs", "K/uL", "M/uL" or "mmol/l".
+func Parse(s string) (Unit, error) {
+	raw := strings.TrimSpace(s)
+	if raw == "" {
+		return Unit{}, fmt.Errorf("empty unit")
+	}
+	compact := strings.ReplaceAll(raw, " ", "")
+	// K/uL and M/uL are thousands and millions per microliter
+	for _, p := range countPrefixes {
+		if strings.HasPrefix(compact, p.prefix) {
+			compact = p.code + compact[len(p.prefix):]
+			break
+		}
+	}
+	lower := strings.ToLower(compact)
+	if syn, ok := synonyms[lower]; ok {
+		lower = strings.ToLower(syn)
+	}
+	lower = annotation.ReplaceAllString(lower, "")
+	lower = fragmentReplacer.Replace(lower)
+
+	unit := Unit{Factor: 1}
+	var numerator, denominator []string
+	for i, term := range strings.Split(lower, "/") {
+		if term == "" && i == 0 {
+			continue // "/min"
+		}
+		for _, comp := range strings.Split(term, ".") {
+			if comp == "" {
+				continue
+			}
+			if i == 0 {
+				numerator = append(numerator, comp)
+			} else {
+				denominator = append(denominator, comp)
+			}
+		}
+	}
+	// "1.73m2" is split by the dot above; glue numeric fragments back on
+	numerator = joinDecimals(numerator)
+	denominator = joinDecimals(denominator)
+
+	var codes []string
+	for _, comp := range numerator {
+		code, factor, dim, err := parseComponent(comp)
+		if err != nil {
+			return Unit{}, fmt.Errorf("unit %q: %w", raw, err)
+		}
+		unit.Factor *= factor
+		unit.Dim = unit.Dim.add(dim, 1)
+		codes = append(codes, code)
+	}
+	code := strings.Join(codes, ".")
+	for _, comp := range denominator {
+		c, factor, dim, err := parseComponent(comp)
+		if err != nil {
+			return Unit{}, fmt.Errorf("unit %q: %w", raw, err)
+		}
+		unit.Factor /= factor
+		unit.Dim = unit.Dim.add(dim, -1)
+		code += "/" + c
+	}
+	unit.Code = code
+	return unit, nil
+}
+
+func joinDecimals(parts []string) []string {
+	var out []string
+	for i := 0; i < len(parts); i++ {
+		p := parts[i]
+		if _, err := strconv.Atoi(p); err == nil && i+1 < len(parts) && len(parts[i+1]) > 0 && parts[i+1][0] >= '0' && parts[i+1][0] <= '9' {
+			p = p + "." + parts[i+1]
+			i++
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// parseComponent handles one factor such as "mg", "10*3", "1.73m2" or "[lb_av]"
+func parseComponent(comp string) (string, float64, Dimension, error) {
+	if m := powerOfTen.FindStringSubmatch(comp); m != nil {
+		exp, _ := strconv.Atoi(m[1])
+		return "10*" + m[1], math.Pow(10, float64(exp)), Dimension{}, nil
+	}
+
+	factor := 1.0
+	prefixCode := ""
+	if m := leadingNum.FindStringSubmatch(comp); m != nil {
+		factor, _ = strconv.ParseFloat(m[1], 64)
+		prefixCode = m[1]
+		comp = m[2]
+		if comp == "" {
+			return prefixCode, factor, Dimension{}, nil
+		}
+	}
+
+	exp := 1
+	if _, _, _, ok := lookupAtom(comp); !ok {
+		if m := trailingExp.FindStringSubmatch(comp); m != nil {
+			exp, _ = strconv.Atoi(m[2])
+			comp = m[1]
+		}
+	}
+
+	code, f, dim, ok := lookupAtom(comp)
+	if !ok {
+		return "", 0, Dimension{}, fmt.Errorf("unknown unit component %q", comp)
+	}
+	suffix := ""
+	if exp != 1 {
+		suffix = strconv.Itoa(exp)
+	}
+	return prefixCode + code + suffix, factor * math.Pow(f, float64(exp)), dim.scale(int8(exp)), nil
+}
+
+// lookupAtom resolves a bare or prefixed atom, preferring the bare atom so
+// "min" is minutes and "d" is days rather than milli-inches or deci-nothing
+func lookupAtom(s string) (string, float64, Dimension, bool) {
+	if a, ok := atoms[s]; ok {
+		return a.code, a.factor, a.dim, true
+	}
+	if len(s) < 2 {
+		return "", 0, Dimension{}, false
+	}
+	p, ok := prefixes[s[:1]]
+	if !ok {
+		return "", 0, Dimension{}, false
+	}
+	a, ok := atoms[s[1:]]
+	// Customary units and temperatures take no prefix; IU is the exception
+	customary := strings.HasPrefix(a.code, "[") && a.code != "[IU]"
+	if !ok || customary || a.dim.Temperature != 0 || a.code == "%" {
+		return "", 0, Dimension{}, false
+	}
+	return p.code + a.code, p.factor * a.factor, a.dim, true
+}
+
+func (d Dimension) add(o Dimension, sign int8) Dimension {
+	return Dimension{
+		Mass:          d.Mass + sign*o.Mass,
+		Length:        d.Length + sign*o.Length,
+		Time:          d.Time + sign*o.Time,
+		Amount:        d.Amount + sign*o.Amount,
+		Equivalents:   d.Equivalents + sign*o.Equivalents,
+		Enzyme:        d.Enzyme + sign*o.Enzyme,
+		International: d.International + sign*o.International,
+		Temperature:   d.Temperature + sign*o.Temperature,
+		Pressure:      d.Pressure + sign*o.Pressure,
+	}
+}
+
+func (d Dimension) scale(n int8) Dimension {
+	return Dimension{}.add(d, n)
+}
+
+// Compatible reports whether two units measure the same kind of quantity
+func (u Unit) Compatible(o Unit) bool {
+	return u.Dim == o.Dim
+}
+
+// Convert converts a value between two dimensionally compatible units
+func Convert(value float64, from, to string) (float64, error) {
+	fu, err := Parse(from)
+	if err != nil {
+		return 0, err
+	}
+	tu, err := Parse(to)
+	if err != nil {
+		return 0, err
+	}
+	if fu.Code == tu.Code {
+		return value, nil
+	}
+	if !fu.Compatible(tu) {
+		return 0, fmt.Errorf("cannot convert %s to %s", fu.Code, tu.Code)
+	}
+	if fu.Dim.Temperature != 0 {
+		return convertTemperature(value, fu.Code, tu.Code)
+	}
+	return value * fu.Factor / tu.Factor, nil
+}
+
+// convertTemperature handles the offset scales, which cannot be expressed as a factor
+func convertTemperature(value float64, from, to string) (float64, error) {
+	switch {
+	case from == "Cel" && to == "[degF]":
+		return value*9/5 + 32, nil
+	case from == "[degF]" && to == "Cel":
+		return (value - 32) * 5 / 9, nil
+	}
+	return 0, fmt.Errorf("cannot convert %s to %s", from, to)
+}
+
+var symbolReplacer = strings.NewReplacer(
+	"[lb_av]", "lb", "[oz_av]", "oz", "[st_av]", "st", "[in_i]", "in", "[ft_i]", "ft",
+	"[degF]", "°F", "Cel", "°C", "[IU]", "IU", "mm[Hg]", "mmHg", "10*", "10^",
+)
+
+// Symbol renders a UCUM code the way people write it, e.g. "[lb_av]" as "lb"
+func Symbol(code string) string {
+	return symbolReplacer.Replace(code)
+}
@@ -0,0 +1,80 @@
+package units
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in, code string
+	}{
+		{"mg/dL", "mg/dL"},
+		{"mmol/l", "mmol/L"},
+		{"K/uL", "10*3/uL"},
+		{"k/µL", "10*3/uL"},
+		{"M/uL", "10*6/uL"},
+		{"M/µL", "10*6/uL"},
+		{"10^6/uL", "10*6/uL"},
+		{"x10^3/uL", "10*3/uL"},
+		{"mil/cumm", "10*6/mm3"},
+		{"mcg/L", "ug/L"},
+		{"μg/L", "ug/L"},
+		{"mL/min/1.73m2", "mL/min/1.73m2"},
+		{"lbs", "[lb_av]"},
+	}
+	for _, tt := range tests {
+		u, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if u.Code != tt.code {
+			t.Errorf("Parse(%q) = %q, want %q", tt.in, u.Code, tt.code)
+		}
+	}
+}
+
+func TestCellCountsAreNotLengths(t *testing.T) {
+	millions, err := Parse("M/uL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	meters, err := Parse("m/uL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if millions.Compatible(meters) {
+		t.Errorf("M/uL (%s) is compatible with m/uL (%s)", millions.Code, meters.Code)
+	}
+	v, err := Convert(4.85, "M/uL", "10*12/L")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(v-4.85) > 1e-9 {
+		t.Errorf("4.85 M/uL = %v 10*12/L, want 4.85", v)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		value    float64
+		from, to string
+		want     float64
+	}{
+		{154, "lbs", "kg", 69.853},
+		{6, "ft", "cm", 182.88},
+		{98.6, "°F", "Cel", 37},
+		{7500, "/uL", "K/uL", 7.5},
+	}
+	for _, tt := range tests {
+		got, err := Convert(tt.value, tt.from, tt.to)
+		if err != nil {
+			t.Errorf("Convert(%v %s to %s): %v", tt.value, tt.from, tt.to, err)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-3 {
+			t.Errorf("Convert(%v %s to %s) = %v, want %v", tt.value, tt.from, tt.to, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// upstream/breaker.go
+package upstream
+
+import (
+	"sync"
+	"time"
+)
+
+// Breaker states
+const (
+	StateClosed   = "closed"    // Calls go through
+	StateOpen     = "open"      // Calls fail fast until the cooldown has passed
+	StateHalfOpen = "half_open" // One probe call decides whether to close again
+)
+
+// Breaker is a circuit breaker. It opens after Threshold consecutive
+// failures, so callers stop waiting on a service that is down, and lets a
+// single probe through once Cooldown has passed.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewBreaker creates a closed breaker
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{Threshold: threshold, Cooldown: cooldown, state: StateClosed}
+}
+
+// Allow reports whether a call may be made now
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case StateOpen:
+		if time.Since(b.openedAt) < b.Cooldown {
+			return false
+		}
+		b.state = StateHalfOpen
+		b.probing = true
+		return true
+	case StateHalfOpen:
+		if b.probing {
+			return false // Another call is already probing
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// Success records a call that reached a healthy service
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state, b.failures, b.probing = StateClosed, 0, false
+}
+
+// Failure records a call that failed because of the service
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.state == StateHalfOpen || b.failures >= b.Threshold {
+		b.state, b.openedAt = StateOpen, time.Now()
+	}
+}
+
+// Release ends a probe that neither succeeded nor failed, e.g. because the
+// caller gave up
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// State returns the breaker's current state
+func (b *Breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateOpen && time.Since(b.openedAt) >= b.Cooldown {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+var (
+	breakersMu sync.Mutex
+	breakers   = map[string]*Breaker{}
+)
+
+// breakerFor returns the breaker shared by every client of a service
+func breakerFor(service string, threshold int, cooldown time.Duration) *Breaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	b, ok := breakers[service]
+	if !ok {
+		b = NewBreaker(threshold, cooldown)
+		breakers[service] = b
+	}
+	return b
+}
@@ -0,0 +1,275 @@
+// upstream/client.go
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling a service that has been failing
+var ErrCircuitOpen = errors.New("service unavailable: circuit open")
+
+// StatusError is a response with a non-2xx status
+type StatusError struct {
+	Service    string
+	StatusCode int
+	Body       string        // Start of the response body
+	RetryAfter time.Duration // From the Retry-After header, if any
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s returned %d: %s", e.Service, e.StatusCode, e.Body)
+}
+
+// Temporary reports whether the same call may succeed later
+func (e *StatusError) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Unavailable reports whether err means the service could not be reached or
+// is overloaded, as opposed to rejecting the request
+func Unavailable(err error) bool {
+	if errors.Is(err, ErrCircuitOpen) {
+		return true
+	}
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.Temporary() || status.StatusCode >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// Options tune a client. Zero values use the defaults.
+type Options struct {
+	Timeout    time.Duration // Per attempt, including reading the body (default 30s)
+	Retries    int           // Extra attempts for idempotent calls (default 2, -1 for none)
+	Backoff    time.Duration // First retry delay, doubled each time (default 250ms)
+	MaxBackoff time.Duration // Longest retry delay (default 5s)
+	Threshold  int           // Consecutive failures that open the circuit (default 5)
+	Cooldown   time.Duration // Time the circuit stays open (default 30s)
+}
+
+func (o Options) withDefaults() Options {
+	if o.Timeout <= 0 {
+		o.Timeout = 30 * time.Second
+	}
+	if o.Retries == 0 {
+		o.Retries = 2
+	} else if o.Retries < 0 {
+		o.Retries = 0
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = 250 * time.Millisecond
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = 5 * time.Second
+	}
+	if o.Threshold <= 0 {
+		o.Threshold = 5
+	}
+	if o.Cooldown <= 0 {
+		o.Cooldown = 30 * time.Second
+	}
+	return o
+}
+
+// transport pools connections for every client
+var transport = &http.Transport{
+	Proxy:                 http.ProxyFromEnvironment,
+	DialContext:           (&net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   16,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ExpectContinueTimeout: time.Second,
+}
+
+// Client calls one service such as a model server. Every call gets a
+// deadline within the caller's context, idempotent calls are retried with
+// backoff, and a circuit breaker shared by all clients of the service stops
+// calls while it is down.
+type Client struct {
+	Service string // Names the service in errors and logs, and keys its breaker
+	HTTP    *http.Client
+	Options Options
+	Breaker *Breaker
+}
+
+// New creates a client for service, e.g. "llm openai http://localhost:8081"
+func New(service string, opts Options) *Client {
+	opts = opts.withDefaults()
+	return &Client{
+		Service: service,
+		HTTP:    &http.Client{Transport: transport},
+		Options: opts,
+		Breaker: breakerFor(service, opts.Threshold, opts.Cooldown),
+	}
+}
+
+// Request is one call
+type Request struct {
+	Method     string
+	URL        string
+	Header     map[string]string
+	Body       []byte
+	Idempotent bool // Safe to send again after a failure
+}
+
+// Do sends req and returns a 2xx response, whose body the caller closes.
+// Other statuses are returned as *StatusError.
+func (c *Client) Do(ctx context.Context, req Request) (*http.Response, error) {
+	attempts := 1
+	if req.Idempotent {
+		attempts += c.Options.Retries
+	}
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if !sleep(ctx, c.delay(attempt, err)) {
+				return nil, err // Keep the last failure rather than the cancellation
+			}
+		}
+		var resp *http.Response
+		resp, err = c.attempt(ctx, req)
+		if err == nil {
+			return resp, nil
+		}
+		if !retryable(ctx, err) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+func (c *Client) attempt(ctx context.Context, req Request) (*http.Response, error) {
+	if !c.Breaker.Allow() {
+		return nil, fmt.Errorf("%s: %w", c.Service, ErrCircuitOpen)
+	}
+
+	actx, cancel := context.WithTimeout(ctx, c.Options.Timeout)
+	httpReq, err := http.NewRequestWithContext(actx, req.Method, req.URL, bytes.NewReader(req.Body))
+	if err != nil {
+		cancel()
+		c.Breaker.Release()
+		return nil, err
+	}
+	if req.Body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range req.Header {
+		httpReq.Header.Set(k, v)
+	}
+
+	resp, err := c.HTTP.Do(httpReq)
+	if err != nil {
+		cancel()
+		if ctx.Err() != nil {
+			c.Breaker.Release() // The caller gave up; says nothing about the service
+			return nil, ctx.Err()
+		}
+		c.Breaker.Failure()
+		return nil, fmt.Errorf("%s: %w", c.Service, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 200))
+		resp.Body.Close()
+		cancel()
+		statusErr := &StatusError{
+			Service:    c.Service,
+			StatusCode: resp.StatusCode,
+			Body:       string(body),
+			RetryAfter: retryAfter(resp.Header.Get("Retry-After")),
+		}
+		if resp.StatusCode >= 500 {
+			c.Breaker.Failure()
+		} else {
+			c.Breaker.Success() // The service answered; the request was the problem
+		}
+		return nil, statusErr
+	}
+	c.Breaker.Success()
+	resp.Body = cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// retryable reports whether a failed attempt is worth repeating
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.Temporary()
+	}
+	return true // Connection errors and attempt timeouts
+}
+
+// delay is exponential backoff with full jitter, or the server's
+// Retry-After when it asked for one
+func (c *Client) delay(attempt int, err error) time.Duration {
+	var status *StatusError
+	if errors.As(err, &status) && status.RetryAfter > 0 {
+		if status.RetryAfter > c.Options.MaxBackoff {
+			return c.Options.MaxBackoff
+		}
+		return status.RetryAfter
+	}
+	d := c.Options.Backoff << uint(attempt-1)
+	if d <= 0 || d > c.Options.MaxBackoff {
+		d = c.Options.MaxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(header); err == nil && s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// sleep waits for d unless ctx ends first
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// cancelOnClose releases the attempt's deadline once the body is read
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,111 @@
+// usage/budget.go
+package usage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"backend/models"
+
+	"github.com/google/uuid"
+)
+
+// ErrBudgetExceeded is returned for users who have used up a budget
+var ErrBudgetExceeded = errors.New("usage budget exceeded")
+
+// Budget limits a user's usage. 0 means unlimited.
+type Budget struct {
+	DailyTokens int64   `json:"daily_tokens"` // Prompt and completion tokens per UTC day
+	MonthlyCost float64 `json:"monthly_cost"` // USD per UTC calendar month
+}
+
+// Status is a user's usage against their budget
+type Status struct {
+	Budget        Budget  `json:"budget"`
+	TokensToday   int64   `json:"tokens_today"`
+	CostThisMonth float64 `json:"cost_this_month"`
+}
+
+// Exceeded names the budget that is used up, or returns "" when there is
+// room left
+func (s Status) Exceeded() string {
+	switch {
+	case s.Budget.DailyTokens > 0 && s.TokensToday >= s.Budget.DailyTokens:
+		return "daily token"
+	case s.Budget.MonthlyCost > 0 && s.CostThisMonth >= s.Budget.MonthlyCost:
+		return "monthly cost"
+	}
+	return ""
+}
+
+// Budget returns the budget of a user: their own limits where set, the
+// defaults otherwise
+func (m *Meter) Budget(ctx context.Context, userID uuid.UUID) (Budget, error) {
+	if m == nil {
+		return Budget{}, nil
+	}
+	budget := m.Defaults
+	var own models.UsageBudget
+	if err := m.DB.WithContext(ctx).Where("user_id = ?", userID).Limit(1).Find(&own).Error; err != nil {
+		return budget, err
+	}
+	if own.DailyTokens != nil {
+		budget.DailyTokens = *own.DailyTokens
+	}
+	if own.MonthlyCost != nil {
+		budget.MonthlyCost = *own.MonthlyCost
+	}
+	return budget, nil
+}
+
+// Status returns a user's usage today and this month against their budget
+func (m *Meter) Status(ctx context.Context, userID uuid.UUID) (Status, error) {
+	var s Status
+	if m == nil {
+		return s, nil
+	}
+	var err error
+	if s.Budget, err = m.Budget(ctx, userID); err != nil {
+		return s, err
+	}
+	return m.totals(ctx, userID, s)
+}
+
+func (m *Meter) totals(ctx context.Context, userID uuid.UUID, s Status) (Status, error) {
+	today := day(time.Now())
+	month := today.AddDate(0, 0, 1-today.Day())
+	var totals struct {
+		Tokens int64
+		Cost   float64
+	}
+	err := m.DB.WithContext(ctx).Model(&models.UsageDay{}).
+		Select("COALESCE(SUM(CASE WHEN day = ? THEN prompt_tokens + completion_tokens END), 0) AS tokens, "+
+			"COALESCE(SUM(cost), 0) AS cost", today).
+		Where("user_id = ? AND day >= ?", userID, month).Scan(&totals).Error
+	s.TokensToday, s.CostThisMonth = totals.Tokens, totals.Cost
+	return s, err
+}
+
+// Check returns ErrBudgetExceeded when the user has used up a budget. A
+// failing lookup lets the user through rather than blocking them.
+func (m *Meter) Check(ctx context.Context, userID uuid.UUID) error {
+	if m == nil {
+		return nil
+	}
+	budget, err := m.Budget(ctx, userID)
+	if err == nil && budget == (Budget{}) {
+		return nil // Unlimited
+	}
+	s, err := m.totals(ctx, userID, Status{Budget: budget})
+	if err != nil {
+		log.Printf("usage: checking the budget of %s: %v", userID, err)
+		return nil
+	}
+	if exceeded := s.Exceeded(); exceeded != "" {
+		return fmt.Errorf("%w: %s budget used up", ErrBudgetExceeded, exceeded)
+	}
+	return nil
+}
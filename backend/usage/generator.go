@@ -0,0 +1,68 @@
+// usage/generator.go
+package usage
+
+import (
+	"context"
+	"time"
+
+	"backend/llm"
+)
+
+// Generator records the tokens, latency and cost of every call to Next
+// under Feature and the generator's name, which prices are keyed by. Token
+// counts the backend does not report are estimated.
+type Generator struct {
+	Next    llm.Generator
+	Feature string
+	Meter   *Meter
+}
+
+// WrapGenerator meters g under feature. A nil meter returns g unchanged.
+func WrapGenerator(g llm.Generator, feature string, m *Meter) llm.Generator {
+	if m == nil {
+		return g
+	}
+	return &Generator{Next: g, Feature: feature, Meter: m}
+}
+
+func (g *Generator) Name() string {
+	return g.Next.Name()
+}
+
+func (g *Generator) SupportsTools() bool {
+	return llm.SupportsTools(g.Next)
+}
+
+func (g *Generator) Generate(ctx context.Context, req llm.Request) (*llm.Response, error) {
+	started := time.Now()
+	resp, err := g.Next.Generate(ctx, req)
+	g.record(ctx, req, resp, err, started)
+	return resp, err
+}
+
+func (g *Generator) Stream(ctx context.Context, req llm.Request, onToken func(string)) (*llm.Response, error) {
+	started := time.Now()
+	resp, err := g.Next.Stream(ctx, req, onToken)
+	g.record(ctx, req, resp, err, started)
+	return resp, err
+}
+
+func (g *Generator) record(ctx context.Context, req llm.Request, resp *llm.Response, err error, started time.Time) {
+	call := Call{Feature: g.Feature, Model: g.Next.Name(), Latency: time.Since(started), Failed: err != nil}
+	if resp == nil {
+		g.Meter.Record(ctx, call) // Failed before the backend did any work
+		return
+	}
+	call.PromptTokens, call.CompletionTokens = resp.PromptTokens, resp.CompletionTokens
+	if call.PromptTokens == 0 {
+		for _, m := range req.Messages {
+			call.PromptTokens += EstimateTokens(m.Content)
+		}
+		call.Estimated = true
+	}
+	if call.CompletionTokens == 0 && resp.Text != "" {
+		call.CompletionTokens = EstimateTokens(resp.Text)
+		call.Estimated = true
+	}
+	g.Meter.Record(ctx, call)
+}
@@ -0,0 +1,86 @@
+// usage/prices.go
+package usage
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// Price is what a model charges, in USD per million tokens
+type Price struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// Prices maps model names, as reported by generators and embedders (e.g.
+// "openai:gpt-4o-mini"), to their price. "provider:*" prices every model of
+// a provider and "*" any other model; models without a price cost nothing,
+// as with locally hosted ones.
+type Prices map[string]Price
+
+//go:embed prices.json
+var defaultPrices []byte
+
+// DefaultPrices returns the prices shipped with the backend
+func DefaultPrices() (Prices, error) {
+	return ParsePrices(defaultPrices)
+}
+
+// LoadPrices reads a prices file
+func LoadPrices(path string) (Prices, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	prices, err := ParsePrices(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return prices, nil
+}
+
+// PricesFromEnv loads the prices file named by USAGE_PRICES, or the default
+// prices when it is unset
+func PricesFromEnv() (Prices, error) {
+	if path := os.Getenv("USAGE_PRICES"); path != "" {
+		return LoadPrices(path)
+	}
+	return DefaultPrices()
+}
+
+// ParsePrices decodes and validates prices
+func ParsePrices(data []byte) (Prices, error) {
+	var p Prices
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	for model, price := range p {
+		if price.Prompt < 0 || price.Completion < 0 {
+			return nil, fmt.Errorf("negative price for %s", model)
+		}
+	}
+	return p, nil
+}
+
+// Price returns the price of model
+func (p Prices) Price(model string) Price {
+	if price, ok := p[model]; ok {
+		return price
+	}
+	if i := strings.Index(model, ":"); i > 0 {
+		if price, ok := p[model[:i]+":*"]; ok {
+			return price
+		}
+	}
+	return p["*"]
+}
+
+// Cost returns the cost of a call in USD
+func (p Prices) Cost(model string, promptTokens, completionTokens int) float64 {
+	price := p.Price(model)
+	return (float64(promptTokens)*price.Prompt + float64(completionTokens)*price.Completion) / 1e6
+}
@@ -0,0 +1,194 @@
+// usage/usage.go
+package usage
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Features calls are totalled under, besides the generator features such
+// as "chat" (see llm.ConfigFromEnv)
+const (
+	Embedding = "embedding" // Texts embedded for indexing or search
+	Retrieval = "retrieval" // Knowledge or record searches
+)
+
+type userKey struct{}
+
+// WithUser attributes the calls made with ctx to a user
+func WithUser(ctx context.Context, userID uuid.UUID) context.Context {
+	return context.WithValue(ctx, userKey{}, userID)
+}
+
+// User returns the user calls made with ctx are attributed to
+func User(ctx context.Context) (uuid.UUID, bool) {
+	id, ok := ctx.Value(userKey{}).(uuid.UUID)
+	return id, ok
+}
+
+// Call is one call to measure
+type Call struct {
+	Feature          string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	Estimated        bool // Token counts were estimated with EstimateTokens
+	Latency          time.Duration
+	Failed           bool
+}
+
+// EstimateTokens approximates the token count of text at four bytes a
+// token, for backends that do not report usage
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// Meter records calls with their cost, and the per user and day totals
+// budgets are checked against. A nil *Meter records nothing and allows
+// everything.
+type Meter struct {
+	DB       *gorm.DB
+	Prices   Prices
+	Defaults Budget // Budgets of users without their own
+}
+
+// NewMeter creates a meter pricing calls with prices
+func NewMeter(db *gorm.DB, prices Prices) *Meter {
+	return &Meter{DB: db, Prices: prices}
+}
+
+// Record stores a call made with ctx. It is stored even when ctx has been
+// cancelled, since the backend did the work; failures are only logged.
+func (m *Meter) Record(ctx context.Context, call Call) {
+	if m == nil {
+		return
+	}
+	now := time.Now()
+	event := models.UsageEvent{
+		ID:               uuid.New(),
+		Feature:          call.Feature,
+		Model:            call.Model,
+		PromptTokens:     call.PromptTokens,
+		CompletionTokens: call.CompletionTokens,
+		Estimated:        call.Estimated,
+		LatencyMs:        call.Latency.Milliseconds(),
+		Cost:             m.Prices.Cost(call.Model, call.PromptTokens, call.CompletionTokens),
+		Failed:           call.Failed,
+		CreatedAt:        now,
+	}
+	total := models.UsageDay{
+		Day:              day(now),
+		Feature:          event.Feature,
+		Model:            event.Model,
+		Calls:            1,
+		PromptTokens:     int64(event.PromptTokens),
+		CompletionTokens: int64(event.CompletionTokens),
+		LatencyMs:        event.LatencyMs,
+		Cost:             event.Cost,
+		UpdatedAt:        now,
+	}
+	if userID, ok := User(ctx); ok {
+		event.UserID, total.UserID = &userID, userID
+	}
+
+	err := m.DB.WithContext(context.WithoutCancel(ctx)).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&event).Error; err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "user_id"}, {Name: "day"}, {Name: "feature"}, {Name: "model"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"calls":             gorm.Expr("usage_days.calls + 1"),
+				"prompt_tokens":     gorm.Expr("usage_days.prompt_tokens + ?", total.PromptTokens),
+				"completion_tokens": gorm.Expr("usage_days.completion_tokens + ?", total.CompletionTokens),
+				"latency_ms":        gorm.Expr("usage_days.latency_ms + ?", total.LatencyMs),
+				"cost":              gorm.Expr("usage_days.cost + ?", total.Cost),
+				"updated_at":        now,
+			}),
+		}).Create(&total).Error
+	})
+	if err != nil {
+		log.Printf("usage: recording %s call to %s: %v", call.Feature, call.Model, err)
+	}
+}
+
+// day is the UTC day of t, which usage is totalled by
+func day(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Purge deletes events older than retention. The daily totals are kept.
+func (m *Meter) Purge(ctx context.Context, retention time.Duration) error {
+	return m.DB.WithContext(ctx).Where("created_at < ?", time.Now().Add(-retention)).
+		Delete(&models.UsageEvent{}).Error
+}
+
+// PurgeEvery purges old events in the background at the given interval
+func (m *Meter) PurgeEvery(retention, interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			if err := m.Purge(context.Background(), retention); err != nil {
+				log.Printf("usage: purging events: %v", err)
+			}
+		}
+	}()
+}
+
+var (
+	sharedOnce sync.Once
+	shared     *Meter
+)
+
+// FromEnv returns the process-wide meter. Calls are priced from the file
+// named by USAGE_PRICES, or the built-in prices; USAGE_DAILY_TOKENS and
+// USAGE_MONTHLY_COST (USD) set the default budgets, unlimited when unset.
+// Events are kept for USAGE_RETENTION (default 90 days); totals are kept
+// for good. USAGE_METERING=off turns metering off.
+func FromEnv(db *gorm.DB) *Meter {
+	sharedOnce.Do(func() {
+		if os.Getenv("USAGE_METERING") == "off" {
+			return
+		}
+		prices, err := PricesFromEnv()
+		if err != nil {
+			log.Fatal("Failed to load usage prices: ", err)
+		}
+		m := NewMeter(db, prices)
+		if v := os.Getenv("USAGE_DAILY_TOKENS"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				log.Fatalf("Invalid USAGE_DAILY_TOKENS %q", v)
+			}
+			m.Defaults.DailyTokens = n
+		}
+		if v := os.Getenv("USAGE_MONTHLY_COST"); v != "" {
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil || n < 0 {
+				log.Fatalf("Invalid USAGE_MONTHLY_COST %q", v)
+			}
+			m.Defaults.MonthlyCost = n
+		}
+		retention := 90 * 24 * time.Hour
+		if v := os.Getenv("USAGE_RETENTION"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				log.Fatalf("Invalid USAGE_RETENTION %q", v)
+			}
+			retention = d
+		}
+		m.PurgeEvery(retention, time.Hour)
+		shared = m
+	})
+	return shared
+}
@@ -1,6 +1,6 @@
 import React, { useState, useRef, useEffect } from 'react';
 import ReactMarkdown from 'react-markdown';
-import { Send } from 'lucide-react';
+import { Send, ThumbsUp, ThumbsDown } from 'lucide-react';
 import Navbar from "./Navbar"
 import { useNavigate } from 'react-router-dom';
 
@@ -10,6 +10,7 @@ const MediBuddyChatbot = () => {
   ]);
   const [input, setInput] = useState('');
   const [isLoading, setIsLoading] = useState(false);
+  const [conversationId, setConversationId] = useState(null);
   const messagesEndRef = useRef(null);
   const chatContainerRef = useRef(null);
   const navigate = useNavigate();
@@ -43,7 +44,7 @@ const MediBuddyChatbot = () => {
           'Content-Type': 'application/json',
           'Authorization': `Bearer ${token}`,
         },
-        body: JSON.stringify({ question: userMessage }),
+        body: JSON.stringify({ question: userMessage, conversation_id: conversationId || undefined }),
         credentials: 'same-origin',
       });
   
@@ -53,10 +54,16 @@ const MediBuddyChatbot = () => {
       }
   
       const data = await response.json();
+      if (data.conversation_id) {
+        setConversationId(data.conversation_id);
+      }
       const aiResponse = data.generated_text || 'Sorry, I couldn\'t process your request.';
       const markdownResponse = convertToMarkdown(aiResponse);
   
-      setMessages((prevMessages) => [...prevMessages, { role: 'assistant', content: markdownResponse }]);
+      setMessages((prevMessages) => [
+        ...prevMessages,
+        { role: 'assistant', content: markdownResponse, messageId: data.message_id, conversationId: data.conversation_id },
+      ]);
     } catch (error) {
       console.error('Error:', error);
       setMessages((prevMessages) => [
@@ -73,6 +80,30 @@ const MediBuddyChatbot = () => {
     }
   };
 
+  const rateAnswer = async (index, rating) => {
+    const message = messages[index];
+    try {
+      const token = localStorage.getItem('token');
+      const response = await fetch(
+        `http://localhost:8080/api/chat/conversations/${message.conversationId}/messages/${message.messageId}/feedback`,
+        {
+          method: 'PUT',
+          headers: {
+            'Content-Type': 'application/json',
+            'Authorization': `Bearer ${token}`,
+          },
+          body: JSON.stringify({ rating }),
+        }
+      );
+      if (!response.ok) {
+        throw new Error(await response.text());
+      }
+      setMessages((prevMessages) => prevMessages.map((m, i) => (i === index ? { ...m, rating } : m)));
+    } catch (error) {
+      console.error('Error rating answer:', error);
+    }
+  };
+
   const convertToMarkdown = (text) => {
     let markdownText = text.trim();
     markdownText = markdownText.replace(/(\d+)\.\s+([^\n]+)/g, "$1. $2\n");
@@ -108,6 +139,24 @@ const MediBuddyChatbot = () => {
                   {message.role === 'assistant' ? (
                     <div className="markdown-content prose prose-sm max-w-none">
                       <ReactMarkdown>{message.content}</ReactMarkdown>
+                      {message.messageId && (
+                        <div className="flex space-x-2 mt-2 not-prose">
+                          <button
+                            onClick={() => rateAnswer(index, 'up')}
+                            className={message.rating === 'up' ? 'text-green-600' : 'text-gray-400 hover:text-gray-600'}
+                            aria-label="Helpful answer"
+                          >
+                            <ThumbsUp size={16} />
+                          </button>
+                          <button
+                            onClick={() => rateAnswer(index, 'down')}
+                            className={message.rating === 'down' ? 'text-red-600' : 'text-gray-400 hover:text-gray-600'}
+                            aria-label="Unhelpful answer"
+                          >
+                            <ThumbsDown size={16} />
+                          </button>
+                        </div>
+                      )}
                     </div>
                   ) : (
                     <div>{message.content}</div>
@@ -1,4 +1,6 @@
-from flask import Flask, request, jsonify
+import json
+
+from flask import Flask, Response, request, jsonify, stream_with_context
 from huggingface_hub import InferenceClient
 
 app = Flask(__name__)
@@ -8,54 +10,42 @@ client = InferenceClient(
     api_key="hugging_face_token"
 )
 
-def generate_response(user_query, relevant_text, health_data):
-    print("User Query:", user_query)
-    print("Relevant Text:", relevant_text)
-    print("Health Data:", health_data)
-    
-    prompt = f"""
-You are MediBuddy, a helpful medical assistant chatbot. Answer the user's question based on their relevant medical data.
-
-- Be clear, accurate, and concise.
-- Use markdown for easy reading.
-- Emphasize important points using *bold*.
-- Provide actionable advice when applicable.
-
-User's Medical Data: {health_data}
-Relevant Context: {relevant_text}
-User's Question: {user_query}
-
-Your response:
-"""
-
-    try:
-        # Call the model using Hugging Face API
-        response = client.text_generation(
-            model="mistralai/Mistral-7B-Instruct-v0.3",
-            prompt=prompt,
-            max_new_tokens=500,
-            temperature=0.7
-        )
-        return response
-    except Exception as e:
-        return str(e)
-
-@app.route('/generate', methods=['POST'])
-def generate():
-    try:
-        data = request.get_json()
-        user_query = data.get('user_query')
-        relevant_text = data.get('relevant_text')
-        health_data = data.get('health_data')
-
-        if not user_query or not relevant_text or not health_data:
-            return jsonify({"error": "Missing required fields"}), 400
-
-        response_text = generate_response(user_query, relevant_text, health_data)
-        return jsonify({"generated_text": response_text})
-
-    except Exception as e:
-        return jsonify({"error": str(e)}), 500
+MODEL = "mistralai/Mistral-7B-Instruct-v0.3"
+
+# Chat endpoint used by the Go backend, which owns the prompt. With
+# "stream": true the reply is newline-delimited JSON: {"token": ...} lines,
+# or a final {"error": ...} line when generation fails part way.
+@app.route('/chat', methods=['POST'])
+def chat():
+    data = request.get_json()
+    messages = data.get('messages')
+    if not messages:
+        return jsonify({"error": "Missing required fields"}), 400
+
+    options = dict(
+        model=MODEL,
+        messages=messages,
+        max_tokens=data.get('max_tokens', 500),
+        temperature=data.get('temperature', 0.7),
+    )
+
+    if not data.get('stream'):
+        try:
+            response = client.chat_completion(**options)
+            return jsonify({"generated_text": response.choices[0].message.content, "model": MODEL})
+        except Exception as e:
+            return jsonify({"error": str(e)}), 500
+
+    def tokens():
+        try:
+            for chunk in client.chat_completion(stream=True, **options):
+                token = chunk.choices[0].delta.content
+                if token:
+                    yield json.dumps({"token": token, "model": MODEL}) + "\n"
+        except Exception as e:
+            yield json.dumps({"error": str(e)}) + "\n"
+
+    return Response(stream_with_context(tokens()), mimetype='application/x-ndjson')
 
 if __name__ == '__main__':
     app.run(port=5001)